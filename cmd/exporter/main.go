@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v2"
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/referalrepo"
+	"github.com/zrp9/launchl/internal/repos/surveyrepo"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+	"github.com/zrp9/launchl/internal/services/export"
+)
+
+func init() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("no .env file found")
+	}
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config %v", err)
+	}
+
+	dbcon, err := store.DBCon(cfg.Database)
+	if err != nil {
+		log.Fatalf("could not connect to database")
+		return
+	}
+
+	dbStore := store.NewBuilder().SetDB(dbcon).SetBunDB().RegisterModels().Build()
+	exporter := export.New(userrepo.New(dbStore), referalrepo.NewReferalRepo(dbStore), surveyrepo.NewResponseRepo(dbStore))
+
+	app := &cli.App{
+		Name:  "export",
+		Usage: "stream launch list data as csv or ndjson",
+		Commands: []*cli.Command{
+			newExportCmd(exporter, export.Users, "subscribers"),
+			newExportCmd(exporter, export.Referals, "referals with referer and referee emails"),
+			newExportCmd(exporter, export.Responses, "flattened survey responses"),
+		},
+	}
+	if err := app.Run(os.Args); err != nil {
+		log.Fatalf("error running export cli %v", err)
+	}
+}
+
+func newExportCmd(e export.Exporter, d export.Dataset, usage string) *cli.Command {
+	return &cli.Command{
+		Name:      string(d),
+		Usage:     "export " + usage,
+		ArgsUsage: "[filter query, e.g. 'wouldUse=true&sort=-createdAt']",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "format", Aliases: []string{"f"}, Value: string(export.CSV), Usage: "csv or ndjson"},
+			&cli.StringFlag{Name: "out", Aliases: []string{"o"}, Usage: "file to write, stdout when empty"},
+		},
+		Action: func(ctx *cli.Context) error {
+			format, err := export.ParseFormat(ctx.String("format"))
+			if err != nil {
+				return err
+			}
+
+			fields, err := e.Fields(d)
+			if err != nil {
+				return err
+			}
+
+			params, err := url.ParseQuery(ctx.Args().First())
+			if err != nil {
+				return err
+			}
+
+			spec, err := repos.ParseQuery(params, fields)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if path := ctx.String("out"); path != "" {
+				f, err := os.Create(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close() //nolint:errcheck
+				out = f
+			}
+
+			count, err := e.Export(ctx.Context, d, spec, out, format)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stderr, "exported %d %s\n", count, d)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v2"
+	"github.com/zrp9/launchl/internal/app"
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/services/launch"
+	"github.com/zrp9/launchl/internal/services/valkaree"
+)
+
+func init() {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("no .env file found")
+	}
+}
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config %v", err)
+	}
+
+	dbcon, err := store.DBCon(cfg.Database)
+	if err != nil {
+		log.Fatalf("could not connect to database")
+		return
+	}
+
+	dbStore := store.NewBuilder().SetDB(dbcon).SetBunDB().RegisterModels().Build()
+	container := app.New(cfg, dbStore, crane.DefaultLogger)
+
+	cliApp := &cli.App{
+		Name:      "import",
+		Usage:     "import subscribers from another waitlist tool's csv export",
+		ArgsUsage: "<file.csv>",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "map", Aliases: []string{"m"}, Usage: "field=csv header, e.g. --map email='Email Address' --map createdAt='Signed Up'"},
+			&cli.IntFlag{Name: "batch-size", Value: 500, Usage: "rows inserted per transaction"},
+			&cli.BoolFlag{Name: "send-welcome", Usage: "queue the welcome email for every imported subscriber"},
+		},
+		Action: func(ctx *cli.Context) error {
+			path := ctx.Args().First()
+			if path == "" {
+				return fmt.Errorf("a csv file is required")
+			}
+
+			mapping := make(map[string]string)
+			for _, m := range ctx.StringSlice("map") {
+				field, header, ok := strings.Cut(m, "=")
+				if !ok {
+					return fmt.Errorf("mapping %q must look like field=header", m)
+				}
+				mapping[field] = header
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close() //nolint:errcheck
+
+			// welcome emails go out through the stream, only connect to valkey when they're wanted
+			if ctx.Bool("send-welcome") {
+				vk, err := valkaree.NewValkeyService(ctx.Context)
+				if err != nil {
+					return err
+				}
+				defer vk.Client().Close()
+				container.WithStream(valkaree.NewStream(vk.Client(), cfg.Valkey.Stream, cfg.Valkey.StreamMaxLen, *crane.DefaultLogger))
+			}
+
+			report, err := container.LaunchService().ImportSubscribers(ctx.Context, f, launch.ImportOptions{
+				Mapping:     mapping,
+				BatchSize:   ctx.Int("batch-size"),
+				SendWelcome: ctx.Bool("send-welcome"),
+			})
+			// the welcome jobs are queued in the background, let them finish before exiting
+			if werr := container.Tasks().Wait(ctx.Context); werr != nil {
+				return werr
+			}
+
+			if report != nil {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			}
+
+			return err
+		},
+	}
+	if err := cliApp.Run(os.Args); err != nil {
+		log.Fatalf("error running import cli %v", err)
+	}
+}
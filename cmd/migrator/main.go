@@ -10,9 +10,9 @@ import (
 	"github.com/uptrace/bun/extra/bundebug"
 	"github.com/uptrace/bun/migrate"
 	"github.com/urfave/cli/v2"
-	"github.com/zrp9/launchl/cmd/migrator/migrations"
 	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/migrations"
 )
 
 func init() {
@@ -1,21 +1,24 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
 	"log"
-	"net/http"
 
 	"github.com/zrp9/launchl/internal/api"
 	"github.com/zrp9/launchl/internal/app"
 	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/crane"
 	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/metrics"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+	"github.com/zrp9/launchl/internal/services/retention"
+	"github.com/zrp9/launchl/internal/services/valkaree"
+	"github.com/zrp9/launchl/internal/telemetry"
 )
 
 func main() {
-	fmt.Println("running on 8090")
-	services := []string{"launch"}
+	services := []string{"health", "launch", "survey", "feature", "export"}
 	cfg, err := config.Load()
 	if err != nil {
 		log.Println("failed to load database config exiting...")
@@ -24,30 +27,89 @@ func main() {
 
 	conn, err := store.DBCon(cfg.Database)
 	if err != nil {
-		log.Printf("an erro occurred while connecting to db %v", err)
+		log.Fatalf("an error occurred while connecting to db %v", err)
 	}
-	if err := run(cfg.Server, conn, services); err != nil {
-		log.Printf("an error occurred while running server %v", err)
+	if err := run(cfg, conn, services); err != nil {
+		log.Fatalf("an error occurred while running server %v", err)
 	}
 }
 
-func run(serverCfg config.ServerCfg, con *sql.DB, services []string) error {
+func run(cfg *config.Config, con *sql.DB, services []string) error {
 	logger := crane.DefaultLogger
 	dbStore := store.NewBuilder().SetDB(con).SetBunDB().RegisterModels().Build()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdownTracing, err := telemetry.Setup(ctx, cfg.Telemetry)
+	if err != nil {
+		logger.MustDebugErr(err)
+		return err
+	}
+	defer shutdownTracing(context.Background()) //nolint:errcheck
+
+	vk, err := valkaree.NewValkeyService(ctx)
+	if err != nil {
+		logger.MustDebugErr(err)
+		return err
+	}
+	stream := valkaree.NewStream(vk.Client(), cfg.Valkey.Stream, cfg.Valkey.StreamMaxLen, *logger)
+
+	if err := metrics.RegisterDB(con, cfg.Database.Name); err != nil {
+		logger.MustDebugErr(err)
+		return err
+	}
+	if err := metrics.RegisterStream(stream.Key, stream); err != nil {
+		logger.MustDebugErr(err)
+		return err
+	}
 	// userRepo := urepo.New(dbStore)
 	// usrService := usr.New(userRepo)
 	// userApi := usr.Initialize(usrService, logger)
 
-	container := app.New(dbStore, logger)
+	container := app.New(cfg, dbStore, logger).WithStream(stream).WithValkey(vk.Client())
+
+	// refuse to start without the database and valkey, the consumer group is made here so
+	// readiness doesn't wait on the first consumer to start
+	if err := container.Health().Startup(ctx); err != nil {
+		logger.MustDebugErr(err)
+		return err
+	}
+	if err := stream.Admin(cfg.Valkey.Group, "").CreateGroup(ctx); err != nil {
+		logger.MustDebugErr(err)
+		return err
+	}
 	if err := container.RegisterServices(services); err != nil {
 		logger.MustDebugErr(err)
 		return err
 	}
-	server := api.NewServer(serverCfg, container.Endpoints())
-
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	server, err := api.NewServer(cfg.Server, container.Endpoints())
+	if err != nil {
 		logger.MustDebugErr(err)
 		return err
 	}
-	return nil
+
+	// the database closes before valkey so nothing still writing to it can queue a job that's lost
+	lifecycle := app.NewLifecycle(server, cfg.Server.ShutdownTimeout, logger).
+		AddWorker("retention", retention.New(userrepo.New(dbStore), cfg.Retention, logger))
+	if cfg.Server.MetricsAddr != "" {
+		lifecycle.AddWorker("metrics", api.NewMetricsServer(cfg.Server.MetricsAddr))
+	}
+	if config.LoadEmailConfig().Consume {
+		consumer, err := container.EmailConsumer()
+		if err != nil {
+			logger.MustDebugErr(err)
+			return err
+		}
+		lifecycle.AddWorker("email", consumer)
+	}
+
+	return lifecycle.
+		Track(container.Tasks()).
+		OnClose("postgres", con.Close).
+		OnClose("valkey", func() error {
+			vk.Client().Close()
+			return nil
+		}).
+		Run(ctx)
 }
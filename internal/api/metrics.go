@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/zrp9/launchl/internal/metrics"
+)
+
+// metricsShutdown is how long a scrape in progress gets to finish when the server stops
+const metricsShutdown = 5 * time.Second
+
+// MetricsServer serves /metrics on its own address so prometheus scrapes an internal port and the
+// public api never exposes route, pool or stream stats
+type MetricsServer struct {
+	server *http.Server
+}
+
+func NewMetricsServer(addr string) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metrics.Handler())
+	return &MetricsServer{
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Run serves until ctx is done, it runs as a lifecycle worker so it stops with the rest of the app
+func (m *MetricsServer) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdown)
+	defer cancel()
+	if err := m.server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return ctx.Err()
+}
@@ -5,31 +5,65 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/zrp9/launchl/internal/auth"
 	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/metrics"
 	"github.com/zrp9/launchl/internal/middleware"
 	"github.com/zrp9/launchl/internal/request"
 	"github.com/zrp9/launchl/internal/services"
+	"github.com/zrp9/launchl/internal/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func NewServer(cfg config.ServerCfg, apis []services.Service) *http.Server {
+func NewServer(cfg config.ServerCfg, apis []services.Service) (*http.Server, error) {
+	proxies, err := request.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	mux := http.NewServeMux()
-	mwChain := middleware.MiddlewareChain(handlePanic, loggerMiddleware, AddJsonHeader, headerMiddleware, contextMiddleware)
+	cors, err := middleware.CORS(cfg.CORS, routeMethods(mux))
+	if err != nil {
+		return nil, err
+	}
+
+	mwChain := middleware.MiddlewareChain(requestIDMiddleware, clientIPMiddleware(proxies), handlePanic, loggerMiddleware, AddJsonHeader, cors, contextMiddleware)
 	registerRoutes(mux, apis)
 	server := &http.Server{
-		Addr:         cfg.Host,
-		ReadTimeout:  time.Second * time.Duration(cfg.ReadTimeout),
-		WriteTimeout: time.Second * time.Duration(cfg.WriteTimeout),
-		Handler:      mwChain(mux),
+		Addr:         net.JoinHostPort(cfg.Host, cfg.Port),
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		Handler:      otelhttp.NewHandler(mwChain(observeRoutes(mux)), "http.server"),
+	}
+	return server, nil
+}
+
+// corsMethods are the methods a preflight can ask about
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// routeMethods asks the mux which methods it has a route for at the requests path
+func routeMethods(mux *http.ServeMux) middleware.MethodResolver {
+	return func(r *http.Request) []string {
+		methods := make([]string, 0, len(corsMethods))
+		probe := r.Clone(r.Context())
+		for _, m := range corsMethods {
+			probe.Method = m
+			if _, pattern := mux.Handler(probe); pattern != "" {
+				methods = append(methods, m)
+			}
+		}
+		return methods
 	}
-	return server
 }
 
 func registerRoutes(mux *http.ServeMux, apis []services.Service) {
@@ -74,29 +108,6 @@ func AddJsonHeader(next http.Handler) http.HandlerFunc {
 	})
 }
 
-func headerMiddleware(next http.Handler) http.HandlerFunc {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		crane.DefaultLogger.MustDebug(fmt.Sprintf("orign: %v", origin))
-		// log.Printf("🔍 Incoming request: %s %s", r.Method, r.URL.Path)
-		// log.Printf("Headers: %v", r.Header)
-
-		if isValidOrigin(origin) {
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		}
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		//w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
-	})
-}
-
 func contextMiddleware(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		timeout := 10 * time.Minute
@@ -107,56 +118,93 @@ func contextMiddleware(next http.Handler) http.HandlerFunc {
 	})
 }
 
-func loggerMiddleware(next http.Handler) http.HandlerFunc {
+// requestIDMiddleware keeps the X-Request-ID a proxy or client sent or makes one, echoes it on the
+// response and puts it on the context for handlers, logs, audit entries and stream jobs
+func requestIDMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(request.RequestIDHeader)
+		if !request.ValidRequestID(id) {
+			id = request.NewRequestID()
+		}
+
+		w.Header().Set(request.RequestIDHeader, id)
+		ctx := request.WithRequestID(r.Context(), id)
+		fields := crane.Zfields{"requestId": id}
+		if traceID := telemetry.TraceID(ctx); traceID != "" {
+			fields["traceId"] = traceID
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+		ctx = crane.ContextWithFields(ctx, fields)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// observeRoutes names the request span after the route pattern the mux matched and records the
+// request metrics under it, so spans and series group by route instead of by raw path
+func observeRoutes(mux *http.ServeMux) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		wrapped := &middleware.WrappedWriter{
 			ResponseWriter: w,
 			StatusCode:     http.StatusOK,
 		}
-		next.ServeHTTP(wrapped, r)
-		crane.DefaultLogger.MustDebug(fmt.Sprintf("Method: %s, URI: %s, IP: %s, Duration: %v, Status: %v", r.Method, r.RequestURI, r.RemoteAddr, start, wrapped.StatusCode))
+		mux.ServeHTTP(wrapped, r)
+
+		route := metrics.UnmatchedRoute
+		if r.Pattern != "" {
+			// patterns look like "GET /features/{id}", the route is only the path part
+			route = r.Pattern
+			if _, path, ok := strings.Cut(route, " "); ok {
+				route = path
+			}
+
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		metrics.ObserveRequest(r.Method, route, wrapped.StatusCode, time.Since(start))
 	})
 }
 
-func HandleShutdown(server *http.Server) {
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
-	<-stop
-	crane.DefaultLogger.MustDebug("Shutting down server")
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		crane.DefaultLogger.MustFatal(fmt.Sprintf("Server forced shutdown: %v", err))
+// clientIPMiddleware puts the callers ip on the context, looking past the trusted proxies it came through
+func clientIPMiddleware(proxies request.TrustedProxies) middleware.Middleware {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := request.WithClientIP(r.Context(), proxies.ClientIP(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
 	}
-	crane.DefaultLogger.MustDebug("Server exited")
+}
+
+func loggerMiddleware(next http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &middleware.WrappedWriter{
+			ResponseWriter: w,
+			StatusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(wrapped, r)
+		crane.DefaultLogger.Ctx(r.Context()).With(crane.Zfields{
+			"method":     r.Method,
+			"uri":        r.RequestURI,
+			"ip":         request.ClientIP(r.Context()),
+			"status":     wrapped.StatusCode,
+			"durationMs": float64(time.Since(start).Microseconds()) / 1000,
+		}).MustInfo("request handled")
+	})
 }
 
 func handlePanic(next http.Handler) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				crane.DefaultLogger.MustDebug(fmt.Sprintf("panic recovered %v", rec))
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				err := fmt.Errorf("panic recovered %v", rec)
+				crane.DefaultLogger.Ctx(r.Context()).MustError(err)
+				request.WriteErr(w, http.StatusInternalServerError, err)
 				return
 			}
 		}()
 		next.ServeHTTP(w, r)
 	})
 }
-
-func isValidOrigin(origin string) bool {
-	return true
-	//	validOrigin := map[string]bool{
-	//		"http://localhost:3000":      true,
-	//		"https://localhost:3000":     true,
-	//		"http://zrp3.dev":      true,
-	//		"https://zrp3.dev":     true,
-	//		"http://www.zrp3.dev":  true,
-	//		"https://www.zrp3.dev": true,
-	//		"www.zrp3.dev":         true,
-	//	}
-	//
-	// return validOrigin[origin]
-}
@@ -2,23 +2,54 @@
 package app
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/uptrace/bun/migrate"
+	"github.com/valkey-io/valkey-go"
+	"github.com/zrp9/launchl/internal/blob"
+	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/crane"
 	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/idempotency"
+	"github.com/zrp9/launchl/internal/migrations"
+	"github.com/zrp9/launchl/internal/ratelimit"
+	"github.com/zrp9/launchl/internal/repos/auditrepo"
 	"github.com/zrp9/launchl/internal/repos/configrepo"
 	"github.com/zrp9/launchl/internal/repos/referalrepo"
 	"github.com/zrp9/launchl/internal/repos/surveyrepo"
 	"github.com/zrp9/launchl/internal/repos/userrepo"
 	"github.com/zrp9/launchl/internal/services"
+	"github.com/zrp9/launchl/internal/services/audit"
+	"github.com/zrp9/launchl/internal/services/export"
+	"github.com/zrp9/launchl/internal/services/feature"
+	"github.com/zrp9/launchl/internal/services/health"
 	"github.com/zrp9/launchl/internal/services/launch"
+	"github.com/zrp9/launchl/internal/services/noti"
+	"github.com/zrp9/launchl/internal/services/reward"
+	"github.com/zrp9/launchl/internal/services/survey"
 	"github.com/zrp9/launchl/internal/services/valkaree"
 )
 
+// consumer read settings, block is how long a read waits for new entries before checking for shutdown
+const (
+	consumerBlock   = 5 * time.Second
+	consumerTimeout = 30 * time.Second
+	consumerMinIdle = time.Minute
+)
+
 type Container struct {
+	cfg       *config.Config
 	store     store.Persister
 	logger    *crane.Zlogrus
+	stream    *valkaree.Stream
+	tasks     *services.Tasks
+	valkey    valkey.Client
+	limits    *ratelimit.Limits
+	idem      *idempotency.Guard
 	endpoints []services.Service
 }
 
@@ -26,14 +57,43 @@ func (c Container) Endpoints() []services.Service {
 	return c.endpoints
 }
 
-func New(s store.Persister, l *crane.Zlogrus) *Container {
+func New(cfg *config.Config, s store.Persister, l *crane.Zlogrus) *Container {
 	return &Container{
+		cfg:    cfg,
 		store:  s,
 		logger: l,
+		tasks:  services.NewTasks(),
 	}
 }
 
-func (c Container) RegisterServices(names []string) error {
+// Tasks tracks the goroutines services start in the background so shutdown can wait for them
+func (c Container) Tasks() *services.Tasks {
+	return c.tasks
+}
+
+// WithStream sets the stream jobs like welcome emails are queued on
+func (c *Container) WithStream(s *valkaree.Stream) *Container {
+	c.stream = s
+	return c
+}
+
+// WithValkey sets the client shared state is kept in, idempotency keys always and rate limits when
+// the config asks for valkey
+func (c *Container) WithValkey(client valkey.Client) *Container {
+	c.valkey = client
+	return c
+}
+
+func (c *Container) RegisterServices(names []string) error {
+	store, err := ratelimit.New(c.cfg.RateLimit, c.valkey)
+	if err != nil {
+		return err
+	}
+	c.limits = ratelimit.NewLimits(store, c.cfg.RateLimit.Policies, c.logger)
+	if c.valkey != nil {
+		c.idem = idempotency.New(idempotency.NewValkeyStore(c.valkey), c.cfg.Idempotency, c.logger)
+	}
+
 	for _, name := range names {
 		service, err := c.createService(name)
 		if err != nil {
@@ -45,18 +105,73 @@ func (c Container) RegisterServices(names []string) error {
 	return nil
 }
 
-func (c Container) createService(name string) (services.Service, error) {
+// LaunchService builds the launch service on its own for commands that run without the http api
+func (c Container) LaunchService() launch.LaunchService {
 	v := validator.New(validator.WithRequiredStructEnabled())
-	configRepo := configrepo.NewRoleRepo(c.store)
+	userRepo := userrepo.New(c.store)
+	questionRepo := surveyrepo.NewResponseRepo(c.store)
+	refRepo := referalrepo.NewReferalRepo(c.store)
+	s := c.stream
+	if s == nil {
+		s = &valkaree.Stream{}
+	}
+	sw := s.Writer()
+	recorder := audit.New(auditrepo.New(c.store))
+	return launch.New(c.store, userRepo, surveyrepo.NewSurveyRepo(c.store), questionRepo, surveyrepo.NewSubmissionRepo(c.store), refRepo, configrepo.NewRoleRepo(c.store), sw, v, recorder, c.rewarder(), c.tasks, c.cfg.Survey.Campaign)
+}
+
+// Health checks the database and migrations, and the valkey server and consumer group when a stream is set
+func (c Container) Health() health.Checker {
+	checks := []health.Check{
+		health.Postgres(c.store.DB()),
+		health.Migrations(migrate.NewMigrator(c.store.BnDB(), migrations.New())),
+	}
+	if c.stream != nil {
+		checks = append(checks, health.Valkey(c.stream), health.StreamGroup(c.stream, c.cfg.Valkey.Group))
+	}
+	return health.New(checks...)
+}
+
+// EmailConsumer reads welcome and other email jobs off the stream, it needs a stream to be set
+func (c Container) EmailConsumer() (noti.EmailQueConsumer, error) {
+	if c.stream == nil {
+		return noti.EmailQueConsumer{}, errors.New("email consumer needs a stream")
+	}
+
+	name, err := os.Hostname()
+	if err != nil {
+		return noti.EmailQueConsumer{}, err
+	}
+
+	emailCfg := config.LoadEmailConfig()
+	reader := c.stream.Reader(c.cfg.Valkey.Group, name, consumerBlock, int64(emailCfg.Workers))
+	return noti.NewEmailConsumer(reader, noti.EmailNoti{}, emailCfg.Attempts, emailCfg.Workers, consumerTimeout, consumerMinIdle), nil
+}
+
+func (c Container) rewarder() reward.Rewarder {
+	return reward.New(userrepo.New(c.store), audit.New(auditrepo.New(c.store)), c.cfg.Rewards)
+}
+
+func (c Container) createService(name string) (services.Service, error) {
 	switch name {
 	case "launch":
-		userRepo := userrepo.New(c.store)
-		questionRepo := surveyrepo.NewResponseRepo(c.store)
-		refRepo := referalrepo.NewReferalRepo(c.store)
-		s := valkaree.Stream{}
-		sw := s.Writer()
-		launchService := launch.New(userRepo, questionRepo, refRepo, configRepo, sw, v)
-		return launch.Initialize(launchService, c.logger), nil
+		return launch.Initialize(c.LaunchService(), c.logger, c.limits, c.idem), nil
+	case "survey":
+		recorder := audit.New(auditrepo.New(c.store))
+		surveyService := survey.New(c.store, surveyrepo.NewSurveyRepo(c.store), surveyrepo.NewSurveyQuestionRepo(c.store), surveyrepo.NewQuestionOptionRepo(c.store), surveyrepo.NewResultsRepo(c.store), recorder)
+		return survey.Initialize(surveyService, c.logger, c.idem), nil
+	case "feature":
+		images, err := blob.New(c.cfg.Blob, c.cfg.AWS)
+		if err != nil {
+			return nil, err
+		}
+		featureService := feature.New(c.store, configrepo.NewFeatureRepo(c.store), configrepo.NewVoteRepo(c.store), userrepo.New(c.store), audit.New(auditrepo.New(c.store)), c.rewarder(), images, c.cfg.Blob)
+		return feature.Initialize(featureService, c.logger, c.idem), nil
+	case "health":
+		return health.Initialize(c.Health()), nil
+	case "export":
+		exporter := export.New(userrepo.New(c.store), referalrepo.NewReferalRepo(c.store), surveyrepo.NewResponseRepo(c.store))
+		return export.Initialize(exporter, c.logger), nil
 	default:
 		return nil, fmt.Errorf("unknown service %v", name)
 	}
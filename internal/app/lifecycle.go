@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/services"
+)
+
+// Worker is a background job that runs until its context is done, like the retention job or a stream consumer
+type Worker interface {
+	Run(ctx context.Context) error
+}
+
+type namedWorker struct {
+	name string
+	w    Worker
+}
+
+type closer struct {
+	name string
+	fn   func() error
+}
+
+// Lifecycle runs the http server and background workers until SIGINT or SIGTERM and then shuts them
+// down in order: stop accepting requests and drain the in-flight ones, stop the workers, wait for
+// tracked goroutines and finally close clients like the database and valkey. Everything before the
+// clients are closed shares one deadline so a stuck request can't hold the process up forever.
+type Lifecycle struct {
+	server  *http.Server
+	timeout time.Duration
+	logger  *crane.Zlogrus
+	workers []namedWorker
+	tasks   []*services.Tasks
+	closers []closer
+}
+
+func NewLifecycle(server *http.Server, timeout time.Duration, l *crane.Zlogrus) *Lifecycle {
+	return &Lifecycle{
+		server:  server,
+		timeout: timeout,
+		logger:  l,
+	}
+}
+
+// AddWorker starts w with the server, it is cancelled once the server stops accepting requests
+func (lc *Lifecycle) AddWorker(name string, w Worker) *Lifecycle {
+	lc.workers = append(lc.workers, namedWorker{name: name, w: w})
+	return lc
+}
+
+// Track waits for the goroutines in t after the workers stop
+func (lc *Lifecycle) Track(t *services.Tasks) *Lifecycle {
+	lc.tasks = append(lc.tasks, t)
+	return lc
+}
+
+// OnClose runs fn once everything else has stopped, closers run in the order they were added
+func (lc *Lifecycle) OnClose(name string, fn func() error) *Lifecycle {
+	lc.closers = append(lc.closers, closer{name: name, fn: fn})
+	return lc
+}
+
+// Run blocks until ctx is done, a shutdown signal arrives or the server fails and returns once
+// shutdown is complete. The error joins everything that went wrong along the way.
+func (lc *Lifecycle) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// workers outlive ctx so in-flight requests can still queue jobs while the server drains
+	workerCtx, cancelWorkers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWorkers()
+
+	var workers sync.WaitGroup
+	for _, nw := range lc.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if err := nw.w.Run(workerCtx); err != nil && !errors.Is(err, context.Canceled) {
+				lc.logger.MustError(fmt.Errorf("worker %s stopped %w", nw.name, err))
+			}
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		lc.logger.MustInfo(fmt.Sprintf("server listening on %s", lc.server.Addr))
+		if err := lc.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		lc.logger.MustInfo("shutting down")
+	case err := <-serveErr:
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server failed %w", err))
+		}
+	}
+	stop()
+
+	deadline, cancel := context.WithTimeout(context.Background(), lc.timeout)
+	defer cancel()
+
+	if err := lc.server.Shutdown(deadline); err != nil {
+		errs = append(errs, fmt.Errorf("server did not drain %w", err))
+	}
+
+	cancelWorkers()
+	if err := waitGroup(deadline, &workers); err != nil {
+		errs = append(errs, fmt.Errorf("workers did not stop %w", err))
+	}
+
+	for _, t := range lc.tasks {
+		if err := t.Wait(deadline); err != nil {
+			errs = append(errs, fmt.Errorf("background tasks did not finish %w", err))
+		}
+	}
+
+	for _, c := range lc.closers {
+		if err := c.fn(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s %w", c.name, err))
+		}
+	}
+
+	lc.logger.MustInfo("shutdown complete")
+	return errors.Join(errs...)
+}
+
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
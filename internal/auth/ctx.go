@@ -0,0 +1,16 @@
+package auth
+
+import "context"
+
+type claimsKey struct{}
+
+// WithClaims stores the authenticated callers claims on the context
+func WithClaims(ctx context.Context, claims *UserClaims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims set by the authorization middleware, ok is false for anonymous requests
+func ClaimsFromContext(ctx context.Context) (*UserClaims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*UserClaims)
+	return claims, ok
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -41,10 +42,49 @@ func (e ErrExpiredToken) Error() string {
 	return fmt.Sprintf("invalid token expired at %v", e.ExpireyDate)
 }
 
+// SubscriberRole is the role claim of the tokens subscribers are issued
+const SubscriberRole = "subscriber"
+
 func GenerateToken(id string, username string, role string) (string, error) {
 	expirationTime := time.Now().Add(2 * time.Hour)
 	//devTime := time.Now().Add((24 * time.Hour) * 365)
+	return signToken(id, username, role, expirationTime)
+}
+
+// GenerateSessionToken signs a subscriber in for JWT_EXPIRATION so they can act on their own
+// {username} routes like voting without a password
+func GenerateSessionToken(id, username string) (string, time.Time, error) {
+	cfg, err := loadCfg()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expires := time.Now().Add(cfg.Jwt.Expiration)
+	token, err := signToken(id, username, SubscriberRole, expires)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expires, nil
+}
+
+// ValidateToken returns the claims of a token signed with the auth key that hasn't expired
+func ValidateToken(token string) (*UserClaims, error) {
+	claims := &UserClaims{}
+	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return getKey()
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !tkn.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
 
+func signToken(id, username, role string, expirationTime time.Time) (string, error) {
 	claims := &UserClaims{
 		ID:       id,
 		Username: username,
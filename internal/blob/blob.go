@@ -0,0 +1,69 @@
+// Package blob stores uploaded files on the local filesystem or in an s3 compatible bucket
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/zrp9/launchl/internal/config"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store saves blobs under a slash separated key and hands back the url they can be fetched from
+type Store interface {
+	Put(ctx context.Context, key, contentType string, r io.Reader, size int64) (string, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// Handler is implemented by stores that need the api to serve their blobs, like the local filesystem
+type Handler interface {
+	http.Handler
+	// Prefix is the url path blobs are served under
+	Prefix() string
+}
+
+func New(cfg config.BlobCfg, aws config.AWSCfg) (Store, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal(cfg.Dir, cfg.PublicURL)
+	case "s3":
+		return NewS3(cfg, aws), nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.Backend)
+	}
+}
+
+// cleanKey rejects keys that would escape the store like ../ or absolute paths
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != key || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
+
+// KeyOf is the key behind a url s handed out, ok is false for urls that point somewhere else
+func KeyOf(s Store, url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, s.URL(""))
+	if !ok {
+		return "", false
+	}
+	if _, err := cleanKey(key); err != nil {
+		return "", false
+	}
+	return key, true
+}
+
+func joinURL(base, key string) string {
+	return strings.TrimSuffix(base, "/") + "/" + key
+}
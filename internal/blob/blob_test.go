@@ -0,0 +1,231 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngOf encodes a solid w by h png
+func pngOf(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCleanKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "features/abc/img.png"},
+		{key: "img.png"},
+		{key: "", wantErr: true},
+		{key: "/etc/passwd", wantErr: true},
+		{key: "../secret", wantErr: true},
+		{key: "features/../../secret", wantErr: true},
+		{key: "features//img.png", wantErr: true},
+		{key: "features/./img.png", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := cleanKey(tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("cleanKey(%q) err = %v, wantErr %v", tt.key, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("cleanKey(%q) err = %v, want ErrInvalidKey", tt.key, err)
+		}
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocal(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	url, err := s.Put(ctx, "features/abc/img.png", "image/png", strings.NewReader("data"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/media/features/abc/img.png" {
+		t.Errorf("url = %q, want /media/features/abc/img.png", url)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "features", "abc", "img.png"))
+	if err != nil || string(got) != "data" {
+		t.Fatalf("stored %q %v, want data", got, err)
+	}
+
+	temps, _ := filepath.Glob(filepath.Join(dir, "features", "abc", ".upload-*"))
+	if len(temps) != 0 {
+		t.Errorf("temp files left behind %v", temps)
+	}
+
+	if _, err := s.Put(ctx, "../escape.png", "image/png", strings.NewReader("data"), 4); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("put outside the dir err = %v, want ErrInvalidKey", err)
+	}
+
+	if err := s.Delete(ctx, "features/abc/img.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(ctx, "features/abc/img.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStoreServe(t *testing.T) {
+	s, err := NewLocal(t.TempDir(), "https://cdn.example.com/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Put(context.Background(), "features/abc/img.png", "image/png", strings.NewReader("data"), 4); err != nil {
+		t.Fatal(err)
+	}
+	if s.Prefix() != "/media" {
+		t.Errorf("prefix = %q, want /media", s.Prefix())
+	}
+
+	h := http.StripPrefix(s.Prefix(), s)
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/media/features/abc/img.png", want: http.StatusOK},
+		{path: "/media/features/abc/missing.png", want: http.StatusNotFound},
+		{path: "/media/features/abc/", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s = %d, want %d", tt.path, w.Code, tt.want)
+		}
+		if tt.want == http.StatusOK && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("GET %s is missing nosniff", tt.path)
+		}
+	}
+}
+
+func TestKeyOf(t *testing.T) {
+	s, err := NewLocal(t.TempDir(), "https://cdn.example.com/media")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url    string
+		want   string
+		wantOK bool
+	}{
+		{url: "https://cdn.example.com/media/features/abc/img.png", want: "features/abc/img.png", wantOK: true},
+		{url: "https://elsewhere.example.com/img.png"},
+		{url: "https://cdn.example.com/media/../secret"},
+		{url: "https://cdn.example.com/media/"},
+	}
+
+	for _, tt := range tests {
+		got, ok := KeyOf(s, tt.url)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("KeyOf(%q) = %q %v, want %q %v", tt.url, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestReadImage(t *testing.T) {
+	small := pngOf(t, 4, 2)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		limit    int64
+		wantErr  error
+		wantType string
+	}{
+		{name: "png", data: small, limit: 1 << 20, wantType: "image/png"},
+		{name: "exactly the limit", data: small, limit: int64(len(small)), wantType: "image/png"},
+		{name: "over the limit", data: small, limit: int64(len(small)) - 1, wantErr: ErrTooLarge},
+		{name: "not an image", data: []byte("<html></html>"), limit: 1 << 20, wantErr: ErrUnsupportedType},
+		{name: "png header with a broken body", data: small[:20], limit: 1 << 20, wantErr: ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := ReadImage(bytes.NewReader(tt.data), tt.limit)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.ContentType != tt.wantType || img.Width != 4 || img.Height != 2 {
+				t.Errorf("image = %s %dx%d, want %s 4x2", img.ContentType, img.Width, img.Height, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img, err := ReadImage(bytes.NewReader(pngOf(t, 400, 200)), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		width        int
+		wantW, wantH int
+	}{
+		{name: "scaled down keeping the ratio", width: 100, wantW: 100, wantH: 50},
+		{name: "smaller images aren't scaled up", width: 800, wantW: 400, wantH: 200},
+		{name: "no width keeps the size", width: 0, wantW: 400, wantH: 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := img.Thumbnail(tt.width)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thumb.Width != tt.wantW || thumb.Height != tt.wantH {
+				t.Errorf("thumbnail = %dx%d, want %dx%d", thumb.Width, thumb.Height, tt.wantW, tt.wantH)
+			}
+			if thumb.ContentType != "image/png" {
+				t.Errorf("png thumbnail type = %s, want image/png", thumb.ContentType)
+			}
+
+			decoded, err := png.Decode(bytes.NewReader(thumb.Data))
+			if err != nil {
+				t.Fatalf("thumbnail doesn't decode %v", err)
+			}
+			if b := decoded.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("encoded thumbnail = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package blob
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // registers the gif decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the webp decoder
+)
+
+// maxPixels stops small files that decode into huge images from eating the servers memory
+const maxPixels = 40_000_000
+
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("file must be a jpeg, png, gif or webp image")
+)
+
+// imageTypes maps the sniffed content types we accept to the extension they are stored with
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+type Image struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// ReadImage reads at most limit bytes and checks the type from the content itself, the name and
+// content type the client sent are never trusted
+func ReadImage(r io.Reader, limit int64) (*Image, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w, max size is %d bytes", ErrTooLarge, limit)
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := imageTypes[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w, got %s", ErrUnsupportedType, contentType)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w, %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w, %dx%d is more than %d pixels", ErrTooLarge, cfg.Width, cfg.Height, maxPixels)
+	}
+
+	return &Image{
+		Data:        data,
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}, nil
+}
+
+// Thumbnail scales the image down to width keeping its aspect ratio, smaller images are only
+// re-encoded. Pngs and gifs stay png so transparency survives, everything else becomes a jpeg.
+func (i *Image) Thumbnail(width int) (*Image, error) {
+	src, _, err := image.Decode(bytes.NewReader(i.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if width > 0 && w > width {
+		h = max(1, h*width/w)
+		w = width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	var buf bytes.Buffer
+	thumb := &Image{Width: w, Height: h}
+	switch i.ContentType {
+	case "image/png", "image/gif":
+		err = png.Encode(&buf, dst)
+		thumb.ContentType, thumb.Ext = "image/png", ".png"
+	default:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		thumb.ContentType, thumb.Ext = "image/jpeg", ".jpg"
+	}
+	if err != nil {
+		return nil, err
+	}
+	thumb.Data = buf.Bytes()
+
+	return thumb, nil
+}
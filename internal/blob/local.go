@@ -0,0 +1,118 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLocalURL = "/media"
+
+// LocalStore keeps blobs in a directory and serves them itself under the path of its public url
+type LocalStore struct {
+	dir       string
+	publicURL string
+	prefix    string
+	files     http.Handler
+}
+
+func NewLocal(dir, publicURL string) (LocalStore, error) {
+	if publicURL == "" {
+		publicURL = defaultLocalURL
+	}
+
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return LocalStore{}, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return LocalStore{}, err
+	}
+
+	return LocalStore{
+		dir:       dir,
+		publicURL: publicURL,
+		prefix:    strings.TrimSuffix(u.Path, "/"),
+		files:     http.FileServer(http.Dir(dir)),
+	}, nil
+}
+
+// Put writes to a temp file first so a reader never sees half a blob
+func (l LocalStore) Put(ctx context.Context, key, contentType string, r io.Reader, size int64) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close() //nolint:errcheck
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+
+	return l.URL(key), nil
+}
+
+func (l LocalStore) Delete(_ context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filepath.Join(l.dir, filepath.FromSlash(key))); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (l LocalStore) URL(key string) string {
+	return joinURL(l.publicURL, key)
+}
+
+func (l LocalStore) Prefix() string {
+	return l.prefix
+}
+
+// ServeHTTP serves blobs with the prefix already stripped, directories are not listed
+func (l LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	l.files.ServeHTTP(w, r)
+}
@@ -0,0 +1,95 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/zrp9/launchl/internal/config"
+)
+
+// S3Store puts blobs in a bucket. With an endpoint set it talks path style to any s3 compatible
+// server like minio, otherwise to aws in the configured region.
+type S3Store struct {
+	client    *s3.Client
+	bucket    string
+	publicURL string
+}
+
+func NewS3(cfg config.BlobCfg, creds config.AWSCfg) S3Store {
+	client := s3.New(s3.Options{
+		Region:      creds.Region,
+		Credentials: credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, ""),
+	}, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	publicURL := cfg.PublicURL
+	if publicURL == "" {
+		if cfg.Endpoint != "" {
+			publicURL = joinURL(cfg.Endpoint, creds.S3Bucket)
+		} else {
+			publicURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", creds.S3Bucket, creds.Region)
+		}
+	}
+
+	return S3Store{
+		client:    client,
+		bucket:    creds.S3Bucket,
+		publicURL: publicURL,
+	}
+}
+
+func (s S3Store) Put(ctx context.Context, key, contentType string, r io.Reader, size int64) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          r,
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(size),
+		CacheControl:  aws.String("public, max-age=31536000, immutable"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to put %s %w", key, err)
+	}
+
+	return s.URL(key), nil
+}
+
+func (s S3Store) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var missing *types.NoSuchKey
+		if errors.As(err, &missing) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to delete %s %w", key, err)
+	}
+
+	return nil
+}
+
+func (s S3Store) URL(key string) string {
+	return joinURL(s.publicURL, key)
+}
@@ -6,19 +6,27 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	Env        string
-	Server     ServerCfg
-	Database   DatabaseCfg
-	AWS        AWSCfg
-	OpenSearch OpenSearchCfg
-	Valkey     ValkeyCfg
-	Jwt        JWTCfg
+	Env         string
+	Server      ServerCfg
+	Database    DatabaseCfg
+	AWS         AWSCfg
+	Blob        BlobCfg
+	OpenSearch  OpenSearchCfg
+	Valkey      ValkeyCfg
+	Jwt         JWTCfg
+	Retention   RetentionCfg
+	Rewards     RewardCfg
+	Survey      SurveyCfg
+	Telemetry   TelemetryCfg
+	RateLimit   RateLimitCfg
+	Idempotency IdempotencyCfg
 }
 
 type ServerCfg struct {
@@ -26,6 +34,27 @@ type ServerCfg struct {
 	Host         string
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
+	// ShutdownTimeout is how long shutdown waits on in-flight requests, workers and background tasks
+	ShutdownTimeout time.Duration
+	// TrustedProxies are the ips and cidrs of proxies whose X-Forwarded-For is believed when
+	// working out the client ip
+	TrustedProxies []string
+	CORS           CORSCfg
+	// MetricsAddr is where /metrics is served, on its own listener so it isn't reachable through the
+	// public api. Empty turns it off.
+	MetricsAddr string
+}
+
+// CORSCfg decides which browser origins may call the api. Origins are exact like
+// https://zrp3.dev or cover every subdomain like https://*.zrp3.dev, a lone * allows any origin
+// but can't be combined with credentials. Credentials let the admin cookie through.
+type CORSCfg struct {
+	AllowedOrigins   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight answer
+	MaxAge time.Duration
 }
 
 type DatabaseCfg struct {
@@ -56,6 +85,17 @@ type AWSCfg struct {
 	SQSQueueURL     string
 }
 
+// BlobCfg picks where uploaded files are stored, the s3 backend reads its bucket and keys from AWSCfg
+// and Endpoint points it at any s3 compatible server instead of aws
+type BlobCfg struct {
+	Backend    string
+	Dir        string
+	PublicURL  string
+	Endpoint   string
+	MaxSize    int64
+	ThumbWidth int
+}
+
 type OpenSearchCfg struct {
 	Host     string
 	Port     string
@@ -68,12 +108,70 @@ type OpenSearchCfg struct {
 type ValkeyCfg struct {
 	Host string
 	Port string
+	// Stream is the key of the notification stream jobs like welcome emails are written to
+	Stream       string
+	StreamMaxLen int64
+	// Group is the consumer group the email consumer reads the stream with
+	Group string
+}
+
+// TelemetryCfg picks where traces go, Exporter is none, stdout or otlp. Endpoint is the otlp http
+// collector address and SampleRatio the share of new traces kept, requests that arrive with a
+// sampled parent are always kept.
+type TelemetryCfg struct {
+	Exporter    string
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+	SampleRatio float64
 }
 
 type EmailCfg struct {
 	Sender          string
 	Attempts        int64
 	TemplateVersion int
+	// Workers is how many email jobs the consumer sends at once
+	Workers int
+	// Consume runs the email consumer in the server, turn it off when another process sends the emails
+	Consume bool
+}
+
+// RetentionCfg controls how long soft deleted users keep their pii
+type RetentionCfg struct {
+	AnonymizeAfter time.Duration
+	Interval       time.Duration
+}
+
+// RewardCfg sets how far actions move a user up the waitlist, a boost of 0 turns the reward off
+type RewardCfg struct {
+	ReferalBoost int64
+	VoteBoost    int64
+	MaxVotes     int
+}
+
+// SurveyCfg sets the campaign whose active survey subscribers get when a request doesn't name one
+type SurveyCfg struct {
+	Campaign string
+}
+
+// RateLimitCfg picks the limiter backend, memory for a single instance or valkey to share limits
+// between replicas, and the policy of every limited route
+type RateLimitCfg struct {
+	Backend  string
+	Policies map[string]RatePolicy
+}
+
+// RatePolicy lets Limit requests through per Window, a limit of 0 turns the policy off
+type RatePolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+// IdempotencyCfg controls how long responses are kept for replay. LockTimeout caps how long a
+// request holds its key while running so a crashed instance doesn't block retries for the whole window.
+type IdempotencyCfg struct {
+	Window      time.Duration
+	LockTimeout time.Duration
 }
 
 type JWTCfg struct {
@@ -97,10 +195,20 @@ func Load() (*Config, error) {
 		Env: appEnv,
 		Server: ServerCfg{
 			//change port dflt to 443 for prod
-			Port:         getEnv("PORT", "8090"),
-			Host:         getEnv("HOST", "0.0.0.0"),
-			ReadTimeout:  getDurationEnv("READ_TIMEOUT", 10*time.Second),
-			WriteTimeout: getDurationEnv("WRITE_TIMEOUT", 10*time.Second),
+			Port:            getEnv("PORT", "8090"),
+			Host:            getEnv("HOST", "0.0.0.0"),
+			ReadTimeout:     getDurationEnv("READ_TIMEOUT", 10*time.Second),
+			WriteTimeout:    getDurationEnv("WRITE_TIMEOUT", 10*time.Second),
+			ShutdownTimeout: getDurationEnv("SHUTDOWN_TIMEOUT", 15*time.Second),
+			TrustedProxies:  getListEnv("TRUSTED_PROXIES", nil),
+			MetricsAddr:     getEnv("METRICS_ADDR", "127.0.0.1:9090"),
+			CORS: CORSCfg{
+				AllowedOrigins:   getListEnv("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000", "https://zrp3.dev", "https://*.zrp3.dev"}),
+				AllowedHeaders:   getListEnv("CORS_ALLOWED_HEADERS", []string{"Content-Type", "Authorization", "X-Request-ID", "Idempotency-Key"}),
+				ExposedHeaders:   getListEnv("CORS_EXPOSED_HEADERS", []string{"X-Request-ID", "Idempotent-Replayed", "Content-Disposition", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"}),
+				AllowCredentials: getBoolEnv("CORS_ALLOW_CREDENTIALS", true),
+				MaxAge:           getDurationEnv("CORS_MAX_AGE", 10*time.Minute),
+			},
 		},
 		Database: DatabaseCfg{
 			Provider:        mustGetEnv("DB_PROVIDER"),
@@ -128,6 +236,14 @@ func Load() (*Config, error) {
 			S3Bucket:        mustGetEnv("AWS_S3_BUCKET"),
 			SQSQueueURL:     getEnv("AWS_SQS_QUEUE_URL", ""),
 		},
+		Blob: BlobCfg{
+			Backend:    getEnv("BLOB_BACKEND", "local"),
+			Dir:        getEnv("BLOB_DIR", "uploads"),
+			PublicURL:  getEnv("BLOB_PUBLIC_URL", ""),
+			Endpoint:   getEnv("BLOB_ENDPOINT", ""),
+			MaxSize:    getInt64Env("BLOB_MAX_SIZE", 5<<20),
+			ThumbWidth: getIntEnv("BLOB_THUMB_WIDTH", 320),
+		},
 		OpenSearch: OpenSearchCfg{
 			Host:     mustGetEnv("OPENSEARCH_HOST"),
 			Port:     getEnv("OPENSEARCH_PORT", "9200"),
@@ -137,17 +253,55 @@ func Load() (*Config, error) {
 			UseSSL:   getBoolEnv("OPENSEARCH_USE_SSL", true),
 		},
 		Valkey: ValkeyCfg{
-			Host: getEnv("VALKEY_HOST", "localhost"),
-			Port: getEnv("VALKEY_PORT", "6379"),
+			Host:         getEnv("VALKEY_HOST", "localhost"),
+			Port:         getEnv("VALKEY_PORT", "6379"),
+			Stream:       getEnv("VALKEY_STREAM", "notifications"),
+			StreamMaxLen: getInt64Env("VALKEY_STREAM_MAXLEN", 10000),
+			Group:        getEnv("VALKEY_STREAM_GROUP", "email"),
+		},
+		Telemetry: TelemetryCfg{
+			Exporter:    getEnv("OTEL_EXPORTER", "none"),
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4318"),
+			Insecure:    getBoolEnv("OTEL_EXPORTER_OTLP_INSECURE", true),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "launchl"),
+			SampleRatio: getFloatEnv("OTEL_SAMPLE_RATIO", 1),
 		},
 		Jwt: JWTCfg{
 			Secret:     mustGetEnv("JWT_SECRET"),
 			Expiration: getDurationEnv("JWT_EXPIRATION", 24*time.Hour),
 			Salty:      mustGetEnv("SALTY"),
 		},
+		Retention: RetentionCfg{
+			AnonymizeAfter: getDurationEnv("RETENTION_ANONYMIZE_AFTER", 30*24*time.Hour),
+			Interval:       getDurationEnv("RETENTION_INTERVAL", time.Hour),
+		},
+		Rewards: LoadRewards(),
+		Survey: SurveyCfg{
+			Campaign: getEnv("SURVEY_CAMPAIGN", "default"),
+		},
+		RateLimit: LoadRateLimit(),
+		Idempotency: IdempotencyCfg{
+			Window:      getDurationEnv("IDEMPOTENCY_WINDOW", 24*time.Hour),
+			LockTimeout: getDurationEnv("IDEMPOTENCY_LOCK_TIMEOUT", time.Minute),
+		},
 	}, nil
 }
 
+func LoadRateLimit() RateLimitCfg {
+	_ = initializeEnv()
+	return RateLimitCfg{
+		Backend: getEnv("RATE_LIMIT_BACKEND", "memory"),
+		Policies: map[string]RatePolicy{
+			"subscribe": getRatePolicyEnv("RATE_LIMIT_SUBSCRIBE", 5, time.Minute),
+			// per email across every ip, a real subscriber only signs up once
+			"subscribe-email": getRatePolicyEnv("RATE_LIMIT_SUBSCRIBE_EMAIL", 3, time.Hour),
+			"position":        getRatePolicyEnv("RATE_LIMIT_POSITION", 60, time.Minute),
+			"survey":          getRatePolicyEnv("RATE_LIMIT_SURVEY", 10, time.Minute),
+			"session":         getRatePolicyEnv("RATE_LIMIT_SESSION", 20, time.Minute),
+		},
+	}
+}
+
 func LoadDBConfig() (DatabaseCfg, error) {
 	_ = initializeEnv()
 
@@ -175,8 +329,11 @@ func LoadDBConfig() (DatabaseCfg, error) {
 func LoadValkey() ValkeyCfg {
 	_ = initializeEnv()
 	return ValkeyCfg{
-		Host: mustGetEnv("VALKEY_HOST"),
-		Port: mustGetEnv("VALKEY_HOST"),
+		Host:         mustGetEnv("VALKEY_HOST"),
+		Port:         mustGetEnv("VALKEY_PORT"),
+		Stream:       getEnv("VALKEY_STREAM", "notifications"),
+		StreamMaxLen: getInt64Env("VALKEY_STREAM_MAXLEN", 10000),
+		Group:        getEnv("VALKEY_STREAM_GROUP", "email"),
 	}
 }
 
@@ -186,6 +343,16 @@ func LoadEmailConfig() EmailCfg {
 		Sender:          mustGetEnv("EMAIL_SENDER"),
 		Attempts:        getInt64Env("EMAIL_ATTEMPTS", 1),
 		TemplateVersion: getIntEnv("EMAIL_TEMPLATE_VERSION", 1),
+		Workers:         getIntEnv("EMAIL_WORKERS", 4),
+		Consume:         getBoolEnv("EMAIL_CONSUMER", true),
+	}
+}
+
+func LoadRewards() RewardCfg {
+	return RewardCfg{
+		ReferalBoost: getInt64Env("REWARD_REFERAL_BOOST", 1),
+		VoteBoost:    getInt64Env("REWARD_VOTE_BOOST", 0),
+		MaxVotes:     getIntEnv("REWARD_MAX_VOTES", 3),
 	}
 }
 
@@ -225,7 +392,7 @@ func mustGetEnv(key string) string {
 
 func getIntEnv(key string, fallback int) int {
 	if value := os.Getenv(key); value != "" {
-		if i, err := strconv.Atoi(value); err != nil {
+		if i, err := strconv.Atoi(value); err == nil {
 			return i
 		}
 	}
@@ -234,7 +401,7 @@ func getIntEnv(key string, fallback int) int {
 
 func getInt64Env(key string, fallback int64) int64 {
 	if value := os.Getenv(key); value != "" {
-		if i, err := strconv.ParseInt(value, 10, 64); err != nil {
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
 			return i
 		}
 	}
@@ -242,6 +409,15 @@ func getInt64Env(key string, fallback int64) int64 {
 	return fallback
 }
 
+func getFloatEnv(key string, fallback float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return fallback
+}
+
 func getBoolEnv(key string, fallback bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if b, err := strconv.ParseBool(value); err == nil {
@@ -251,6 +427,30 @@ func getBoolEnv(key string, fallback bool) bool {
 	return fallback
 }
 
+// getListEnv splits a comma separated value and drops empty entries
+func getListEnv(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	list := make([]string, 0)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// getRatePolicyEnv reads <prefix>_LIMIT and <prefix>_WINDOW
+func getRatePolicyEnv(prefix string, limit int, window time.Duration) RatePolicy {
+	return RatePolicy{
+		Limit:  getIntEnv(prefix+"_LIMIT", limit),
+		Window: getDurationEnv(prefix+"_WINDOW", window),
+	}
+}
+
 func getDurationEnv(key string, fallback time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if d, err := time.ParseDuration(value); err == nil {
@@ -0,0 +1,65 @@
+package crane
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fieldsKey struct{}
+
+// ContextWithFields returns a ctx whose log lines carry fields on top of the ones already on ctx,
+// later values win for the same key
+func ContextWithFields(ctx context.Context, fields Zfields) context.Context {
+	merged := make(Zfields, len(fields))
+	for k, v := range FieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+func FieldsFromContext(ctx context.Context) Zfields {
+	fields, _ := ctx.Value(fieldsKey{}).(Zfields)
+	return fields
+}
+
+// Zentry is a log line being built up with structured fields
+type Zentry struct {
+	entry *logrus.Entry
+}
+
+// Ctx starts a log line with the fields carried by ctx like the request id
+func (z Zlogrus) Ctx(ctx context.Context) Zentry {
+	return z.With(FieldsFromContext(ctx))
+}
+
+func (z Zlogrus) With(fields Zfields) Zentry {
+	return Zentry{entry: z.logger.WithFields(logrus.Fields(fields))}
+}
+
+func (e Zentry) With(fields Zfields) Zentry {
+	return Zentry{entry: e.entry.WithFields(logrus.Fields(fields))}
+}
+
+func (e Zentry) MustTrace(msg string) {
+	e.entry.Trace(msg)
+}
+
+func (e Zentry) MustDebug(msg string) {
+	e.entry.Debug(msg)
+}
+
+func (e Zentry) MustInfo(msg string) {
+	e.entry.Info(msg)
+}
+
+func (e Zentry) MustWarn(msg string) {
+	e.entry.Warn(msg)
+}
+
+func (e Zentry) MustError(err error) {
+	e.entry.Error(err)
+}
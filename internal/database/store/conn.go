@@ -2,6 +2,7 @@
 package store
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
@@ -14,13 +15,16 @@ import (
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
 	"github.com/uptrace/bun/extra/bundebug"
+	"github.com/uptrace/bun/extra/bunotel"
 	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/domain"
 )
 
 type Persister interface {
+	Transactor
 	DB() *sql.DB
 	BnDB() *bun.DB
+	IDB(ctx context.Context) bun.IDB
 }
 
 type Store struct {
@@ -58,6 +62,8 @@ func (b *StoreBuilder) SetBunDB() *StoreBuilder {
 	b.bdb.AddQueryHook(bundebug.NewQueryHook(
 		bundebug.WithVerbose(true),
 	))
+	// every query gets a span under the request or job that ran it
+	b.bdb.AddQueryHook(bunotel.NewQueryHook())
 	return b
 }
 
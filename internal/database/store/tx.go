@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/uptrace/bun"
+)
+
+type txKey struct{}
+
+// TxFunc is a unit of work, every repo call made with ctx joins the surrounding transaction
+type TxFunc func(ctx context.Context) error
+
+// Transactor runs units of work spanning multiple repos atomically
+type Transactor interface {
+	RunInTx(ctx context.Context, fn TxFunc) error
+	Savepoint(ctx context.Context, fn TxFunc) error
+}
+
+// RunInTx runs fn inside a transaction bound to the context passed to fn.
+// If ctx already carries a transaction fn joins it instead of starting a new one,
+// so services can compose each others transactional methods.
+func (s Store) RunInTx(ctx context.Context, fn TxFunc) error {
+	if _, ok := TxFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	return s.BnDB().RunInTx(ctx, &sql.TxOptions{}, func(ctx context.Context, tx bun.Tx) error {
+		return fn(WithTx(ctx, tx))
+	})
+}
+
+// Savepoint runs fn in a savepoint of the transaction on ctx so an error from fn only undoes fn's own
+// writes and the surrounding transaction can carry on. Without a transaction on ctx it is RunInTx.
+func (s Store) Savepoint(ctx context.Context, fn TxFunc) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return s.RunInTx(ctx, fn)
+	}
+
+	return tx.RunInTx(ctx, nil, func(ctx context.Context, sp bun.Tx) error {
+		return fn(WithTx(ctx, sp))
+	})
+}
+
+// IDB returns the ambient transaction when there is one, otherwise the db
+func (s Store) IDB(ctx context.Context) bun.IDB {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return s.BnDB()
+}
+
+func WithTx(ctx context.Context, tx bun.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func TxFromContext(ctx context.Context) (bun.Tx, bool) {
+	tx, ok := ctx.Value(txKey{}).(bun.Tx)
+	return tx, ok
+}
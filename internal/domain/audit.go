@@ -0,0 +1,45 @@
+// Package domain audit log entity
+package domain
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/zrp9/launchl/pkg/jsonb"
+)
+
+type AuditAction string
+
+const (
+	AuditUserUpdate    AuditAction = "user.update"
+	AuditUserDelete    AuditAction = "user.delete"
+	AuditUserPurge     AuditAction = "user.purge"
+	AuditRewardReferer AuditAction = "referal.reward"
+	AuditSurveyCreate  AuditAction = "survey.create"
+	AuditSurveyEdit    AuditAction = "survey.edit"
+	AuditSurveyPublish AuditAction = "survey.publish"
+	AuditFeatureCreate AuditAction = "feature.create"
+	AuditFeatureUpdate AuditAction = "feature.update"
+	AuditFeatureDelete AuditAction = "feature.delete"
+	AuditRewardVote    AuditAction = "vote.reward"
+	AuditRevokeVote    AuditAction = "vote.revoke"
+	AuditInviteWave    AuditAction = "invite.wave"
+)
+
+// AuditEntry is an append only record of a change made by an admin or by the system on someones behalf
+type AuditEntry struct {
+	bun.BaseModel `bun:"table:audit_log,alias:al"`
+	ID            uuid.UUID                            `bun:",pk,type:uuid" json:"id"`
+	Actor         string                               `bun:"type:varchar(150),notnull" json:"actor"`
+	ActorRole     string                               `bun:"type:varchar(255),null,nullzero" json:"actorRole,omitempty"`
+	Action        AuditAction                          `bun:"type:varchar(75),notnull" json:"action"`
+	EntityType    string                               `bun:"type:varchar(75),notnull" json:"entityType"`
+	EntityID      string                               `bun:"type:varchar(255),notnull" json:"entityId"`
+	Before        jsonb.NullJSONB[json.RawMessage]     `bun:"type:jsonb" json:"before"`
+	After         jsonb.NullJSONB[json.RawMessage]     `bun:"type:jsonb" json:"after"`
+	Diff          jsonb.JSONB[map[string]jsonb.Change] `bun:"type:jsonb,notnull" json:"diff"`
+	RequestID     string                               `bun:"type:varchar(128),null,nullzero" json:"requestId,omitempty"`
+	CreatedAt     time.Time                            `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
+}
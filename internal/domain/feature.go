@@ -16,12 +16,27 @@ type AccessListQueue struct {
 
 type Feature struct {
 	bun.BaseModel    `bun:"table:features,alias:f"`
-	ID               uuid.UUID `bun:",pk,type:uuid" json:"id" validate:"uuidv4"`
-	Title            string    `bun:"type:varchar(150),notnull,nullzero" json:"title" validate:"alphanum"`
-	Name             string    `bun:"type:varchar(150),notnull,nullzero" json:"name" validate:"alphanum"`
-	Details          string    `bun:"type:text,notnull,nullzero" json:"details" validate:"alphanum"`
-	QuickDescription string    `bun:"type:text,notnull,nullzero" json:"quickDescription" validate:"alphanum"`
+	ID               uuid.UUID `bun:",pk,type:uuid" json:"id"`
+	Title            string    `bun:"type:varchar(150),notnull,nullzero" json:"title"`
+	Name             string    `bun:"type:varchar(150),notnull,nullzero" json:"name"`
+	Details          string    `bun:"type:text,notnull,nullzero" json:"details"`
+	QuickDescription string    `bun:"type:text,notnull,nullzero" json:"quickDescription"`
 	CreatedAt        time.Time `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
 	UpdatedAt        time.Time `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"updatedAt"`
-	Images           []string  `json:"images"`
+	// Images are urls of the pictures shown on the features card
+	Images []string `bun:"type:jsonb,notnull,default='[]'" json:"images"`
+	// Thumbnails maps an image url to the url of its thumbnail, uploaded images always have one
+	Thumbnails map[string]string `bun:"type:jsonb,notnull,default='{}'" json:"thumbnails"`
+	// Votes is only filled by queries that join the vote counts
+	Votes int64 `bun:"votes,scanonly" json:"votes"`
+}
+
+// FeatureVote is a users vote for a feature, Boost is the position reward it paid out so
+// taking the vote back returns exactly that much
+type FeatureVote struct {
+	bun.BaseModel `bun:"table:feature_votes,alias:fvt"`
+	UserID        uuid.UUID `bun:",pk,type:uuid" json:"userId"`
+	FeatureID     uuid.UUID `bun:",pk,type:uuid" json:"featureId"`
+	Boost         int64     `bun:"type:bigint,notnull,default=0" json:"boost"`
+	CreatedAt     time.Time `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
 }
@@ -20,15 +20,33 @@ const (
 	TEXT       QuestionType = "text"
 )
 
+type SurveyStatus string
+
+const (
+	// DRAFT surveys can be edited freely, nobody has answered them yet
+	DRAFT SurveyStatus = "draft"
+	// PUBLISHED surveys are frozen so responses keep pointing at the questions that were asked
+	PUBLISHED SurveyStatus = "published"
+)
+
 type Survey struct {
 	bun.BaseModel `bun:"table:surveys,alias:s"`
 	CreatedAt     time.Time        `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
 	UpdatedAt     time.Time        `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"updatedAt"`
-	ID            uuid.UUID        `bun:"pk,type:uuid" json:"id" validate:"uuidv4"`
+	ID            uuid.UUID        `bun:",pk,type:uuid" json:"id" validate:"uuidv4"`
 	Questions     []SurveyQuestion `bun:"rel:has-many,join:id=survey_id" json:"questions"`
 	Version       string           `bun:"type:varchar(75),notnull,nullzero" json:"version" validate:"numeric"`
 	Name          string           `bun:"type:varchar(255),notnull,nullzero" json:"name" validate:"alphanum"`
 	Active        bool             `bun:"type:boolean,notnull,nullzero,default=false" json:"active" validate:"boolean"`
+	// Campaign groups the versions of a survey, only one survey per campaign can be active
+	Campaign    string       `bun:"type:varchar(150),notnull,nullzero,default='default'" json:"campaign"`
+	Status      SurveyStatus `bun:"type:varchar(20),notnull,nullzero,default='draft'" json:"status"`
+	ParentID    uuid.UUID    `bun:"type:uuid,null,nullzero" json:"parentId,omitempty"`
+	PublishedAt time.Time    `bun:"type:timestamptz,null,nullzero" json:"publishedAt,omitempty"`
+}
+
+func (s Survey) IsDraft() bool {
+	return s.Status == DRAFT || s.Status == ""
 }
 
 type SurveyQuestion struct {
@@ -36,21 +54,82 @@ type SurveyQuestion struct {
 
 	CreatedAt    time.Time              `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
 	UpdatedAt    time.Time              `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"updatedAt"`
-	ID           uuid.UUID              `bun:"pk,type:uuid" json:"id" validate:"uuidv4"`
+	ID           uuid.UUID              `bun:",pk,type:uuid" json:"id" validate:"uuidv4"`
 	SurveyID     uuid.UUID              `bun:"type:uuid,notnull" json:"surveyId" validate:"uuidv4"`
 	QuestionType QuestionType           `bun:"type:question_type,notnull,nullzero,default='check'" json:"questionType" validate:"oneof='check' 'multi-check' 'drop-down' 'text'"`
 	Options      []SurveyQuestionOption `bun:"rel:has-many,join:id=question_id" json:"options"`
 	Prompt       string                 `bun:"type:text,notnull,nullzero" json:"prompt" validate:"alphanum"`
 	Position     int                    `bun:"type:integer,notnull,nullzero,default=0" json:"position" validate:"numeric"`
-	Active       bool                   `bun:"type:boolean,notnull,nullzero,default=false" json:"active" validate:"boolean"`
-	Required     bool                   `bun:"type:boolean,notnull,nullzero,default=true" json:"required" validate:"boolean"`
+	Active       bool                   `bun:"type:boolean,notnull,default=false" json:"active" validate:"boolean"`
+	Required     bool                   `bun:"type:boolean,notnull,default=true" json:"required" validate:"boolean"`
 	MetaData     json.RawMessage        `bun:"type:jsonb,notnull,nullzero" json:"metaData" validate:"json"`
 }
 
+// QuestionMeta is the shape of SurveyQuestion.MetaData, zero values mean no constraint
+type QuestionMeta struct {
+	MinSelections int `json:"minSelections,omitempty"`
+	MaxSelections int `json:"maxSelections,omitempty"`
+	MinLength     int `json:"minLength,omitempty"`
+	MaxLength     int `json:"maxLength,omitempty"`
+	// ShowIf hides the question unless every condition is met
+	ShowIf []Condition `json:"showIf,omitempty"`
+}
+
+// Condition is met when any of OptionIDs was chosen on the earlier question QuestionID
+//
+//	{"showIf": [{"questionId": "<question z>", "optionIds": ["<option y>"]}]}
+type Condition struct {
+	QuestionID uuid.UUID   `json:"questionId"`
+	OptionIDs  []uuid.UUID `json:"optionIds"`
+}
+
+// Met reports whether one of the conditions options is among those chosen on its question
+func (c Condition) Met(chosen map[uuid.UUID]map[uuid.UUID]bool) bool {
+	for _, id := range c.OptionIDs {
+		if chosen[c.QuestionID][id] {
+			return true
+		}
+	}
+	return false
+}
+
+// Shown reports whether a question with these conditions is shown given the options chosen so far
+func (m QuestionMeta) Shown(chosen map[uuid.UUID]map[uuid.UUID]bool) bool {
+	for _, c := range m.ShowIf {
+		if !c.Met(chosen) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q SurveyQuestion) Meta() (QuestionMeta, error) {
+	var meta QuestionMeta
+	if len(q.MetaData) == 0 {
+		return meta, nil
+	}
+
+	if err := json.Unmarshal(q.MetaData, &meta); err != nil {
+		return meta, fmt.Errorf("invalid metadata for question %v %w", q.ID, err)
+	}
+
+	return meta, nil
+}
+
+// HasOption reports whether id is one of the questions options
+func (q SurveyQuestion) HasOption(id uuid.UUID) bool {
+	for _, o := range q.Options {
+		if o.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 type SurveyQuestionOption struct {
 	bun.BaseModel `bun:"table:survey_question_options,alias:sqo"`
-	ID            uuid.UUID `bun:"pk,type:uuid" json:"id" validate:"uuidv4"`
-	QuestionID    uuid.UUID `bun:"pk,type:uuid" json:"questionId" validate:"uuidv4"`
+	ID            uuid.UUID `bun:",pk,type:uuid" json:"id" validate:"uuidv4"`
+	QuestionID    uuid.UUID `bun:"type:uuid,notnull" json:"questionId" validate:"uuidv4"`
 	Position      int       `bun:"type:integer,notnull,nullzero,default=0" json:"position" validate:"numeric"`
 	Label         string    `bun:"type:varchar(255),notnull,nullzero" json:"label" validate:"alphanum"`
 	// value can be empty to support text responses
@@ -59,15 +138,28 @@ type SurveyQuestionOption struct {
 
 type SurveyResponse struct {
 	bun.BaseModel  `bun:"table:user_survey_responses,alias:sur"`
-	ID             uuid.UUID             `bun:",pk,type:uuid" json:"id" validate:"uuidv4"`
-	QuestionID     uuid.UUID             `bun:",pk,type:uuid" json:"questionId" validate:"uuidv4"`
-	UserID         uuid.UUID             `bun:",pk,type:uuid" json:"userId" validate:"uuidv4"`
-	OptionID       uuid.UUID             `bun:",pk,type:uuid" json:"optionId" validate:"uuidv4"`
-	Question       *SurveyQuestion       `bun:"rel:belongs-to,join:question_id=id" json:"question"`
-	User           *User                 `bun:"rel:belongs-to,join:user_id=id" json:"user"`
-	QuestionOption *SurveyQuestionOption `bun:"rel:belongs-to,join:option_id=id" json:"questionOption"`
+	ID             uuid.UUID             `bun:",pk,type:uuid" json:"id"`
+	SubmissionID   uuid.UUID             `bun:"type:uuid,notnull" json:"submissionId"`
+	QuestionID     uuid.UUID             `bun:"type:uuid,notnull" json:"questionId"`
+	UserID         uuid.UUID             `bun:"type:uuid,notnull" json:"userId"`
+	OptionID       uuid.UUID             `bun:"type:uuid,null,nullzero" json:"optionId,omitempty"`
+	Question       *SurveyQuestion       `bun:"rel:belongs-to,join:question_id=id" json:"question,omitempty"`
+	User           *User                 `bun:"rel:belongs-to,join:user_id=id" json:"user,omitempty"`
+	QuestionOption *SurveyQuestionOption `bun:"rel:belongs-to,join:option_id=id" json:"questionOption,omitempty"`
 	// WrittenResponse holds the response to text questions
-	WrittenResponse string `bun:"type:text,null,nullzero" json:"writtenResponse,omitempty" validate:"alphanum"`
+	WrittenResponse string `bun:"type:text,null,nullzero" json:"writtenResponse,omitempty"`
+}
+
+// SurveySubmission is one users answers to one survey, there is at most one per user and survey
+// and resubmitting replaces its responses
+type SurveySubmission struct {
+	bun.BaseModel `bun:"table:survey_submissions,alias:ss"`
+	CreatedAt     time.Time        `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
+	UpdatedAt     time.Time        `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"updatedAt"`
+	ID            uuid.UUID        `bun:",pk,type:uuid" json:"id"`
+	SurveyID      uuid.UUID        `bun:"type:uuid,notnull" json:"surveyId"`
+	UserID        uuid.UUID        `bun:"type:uuid,notnull" json:"userId"`
+	Responses     []SurveyResponse `bun:"rel:has-many,join:id=submission_id" json:"responses,omitempty"`
 }
 
 // TODO: add the object like point for options for db scanning/inserting
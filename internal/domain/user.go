@@ -13,8 +13,8 @@ import (
 type User struct {
 	bun.BaseModel `bun:"table:users,alias:u"`
 
-	ID          uuid.UUID `bun:"pk,type:uuid,notnull,unique" json:"uid" validate:"uuid4"`
-	Email       string    `bun:"type:varchar(150),notnull,unique" json:"email" validate:"asci"`
+	ID          uuid.UUID `bun:",pk,type:uuid,notnull,unique" json:"uid" validate:"uuid4"`
+	Email       string    `bun:"type:varchar(150),notnull,unique" json:"email" validate:"ascii"`
 	Username    string    `bun:"type:varchar(150),notnull,nullzero" json:"username" validate:"ascii"`
 	Phone       string    `bun:"type:varchar(12),notnull" json:"phone" validate:"numeric"`
 	FirstName   string    `bun:"type:varchar(100),notnull" json:"firstName" validate:"alpha,min=1,max=150"`
@@ -24,12 +24,23 @@ type User struct {
 	WouldUse    bool      `bun:"type:boolean,notnull,nullzero,default=false" json:"wouldUse" validate:"boolean"`
 	Comments    string    `bun:"type:text,null,nullzero" json:"comments" validate:"alphanum"`
 	CompanyName string    `bun:"type:varchar(150),null,nullzero" json:"companyName" validate:"alphanum"`
-	QuePosition int64     `bun:"type:integer,null,nullzero" json:"quePosition" validate:"number,min=1,"`
-	// TODO: this survey ref needs to be updated because user_survey table removed
-	Surveys   []Survey  `bun:"m2m:user_survey,join:User=Survey" json:"surveys"`
+	QuePosition int64     `bun:"type:integer,null,nullzero" json:"quePosition" validate:"number,min=1"`
+	// TODO: this survey ref needs to be updated because user_survey table removed,
+	// bun skips it until then since a m2m to a missing table panics on every user query
+	Surveys   []Survey  `bun:"-" json:"surveys"`
 	ReferalID string    `bun:"type:varchar(255),null,nullzero" json:"referalId"`
 	CreatedAt time.Time `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"createdAt"`
 	UpdatedAt time.Time `bun:"type:timestamptz,notnull,nullzero,default=current_timestamp" json:"updatedAt"`
+	// Version is bumped on every write, updates only apply to the version they read
+	Version int64 `bun:"type:bigint,notnull,default=1" json:"version"`
+	// DeletedAt is set instead of removing the row so referals keep pointing at the user
+	DeletedAt time.Time `bun:",soft_delete,nullzero" json:"deletedAt,omitempty"`
+	// VerifiedAt is set once an admin has confirmed the subscriber is a real person with a real email
+	VerifiedAt time.Time `bun:"type:timestamptz,null,nullzero" json:"verifiedAt,omitempty"`
+	// InvitedAt is set when the user was let in by an invite wave
+	InvitedAt time.Time `bun:"type:timestamptz,null,nullzero" json:"invitedAt,omitempty"`
+	// AnonymizedAt is set once the retention job has scrubbed a deleted users pii
+	AnonymizedAt time.Time `bun:"type:timestamptz,null,nullzero" json:"-"`
 }
 
 func NewUser(uid, email, phne, company, fname, lname string, role Role, would bool) (*User, error) {
@@ -61,6 +72,14 @@ func (u *User) BeforeAppendModel(ctx context.Context, query bun.Query) error {
 	return nil
 }
 
+func (u *User) CurrentVersion() int64 {
+	return u.Version
+}
+
+func (u *User) SetVersion(v int64) {
+	u.Version = v
+}
+
 func (u User) Info() string {
 	return fmt.Sprintf("%#v\n", u)
 }
@@ -2,6 +2,7 @@
 package dto
 
 import (
+	"encoding/json"
 	"errors"
 	"mime/multipart"
 
@@ -16,11 +17,13 @@ type Transferer interface {
 type DTO struct {
 }
 
+// SurveyResponse is one answer, multi-check questions send one per selected option.
+// Whether the option and text fit the question is checked against the survey definition,
+// the user answering comes from the request path.
 type SurveyResponse struct {
-	OptionID   uuid.UUID `json:"optionId" validate:"uuidv4,required"`
-	UserID     uuid.UUID `json:"userId" validate:"uuidv4,required"`
-	QuestionID uuid.UUID `json:"questionId" validate:"uuidv4,required"`
-	TextAnwser string    `json:"textAnwser,omitempty" validate:"alphanum"`
+	OptionID   uuid.UUID `json:"optionId"`
+	QuestionID uuid.UUID `json:"questionId" validate:"required"`
+	TextAnwser string    `json:"textAnwser,omitempty"`
 }
 
 func (s SurveyResponse) Validate() error {
@@ -41,6 +44,126 @@ func (s SurveyResponses) Validate() []error {
 	return errs
 }
 
+// AdminUserUpdate is a partial user edit, nil fields are left unchanged
+type AdminUserUpdate struct {
+	QuePosition *int64  `json:"quePosition,omitempty" validate:"omitnil,min=1"`
+	WouldUse    *bool   `json:"wouldUse,omitempty"`
+	CompanyName *string `json:"companyName,omitempty" validate:"omitnil,max=150"`
+	Comments    *string `json:"comments,omitempty"`
+	FirstName   *string `json:"firstName,omitempty" validate:"omitnil,min=1,max=100"`
+	LastName    *string `json:"lastName,omitempty" validate:"omitnil,min=1,max=100"`
+	// Verified marks the subscriber verified, false clears it
+	Verified *bool `json:"verified,omitempty"`
+}
+
+func (a AdminUserUpdate) Validate() error {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	return v.Struct(a)
+}
+
+// InviteWave is how many users at the front of the line an invite wave lets in
+type InviteWave struct {
+	Size int `json:"size" validate:"required,min=1,max=10000"`
+}
+
+func (i InviteWave) Validate() error {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	return v.Struct(i)
+}
+
+type SurveyDto struct {
+	Name     string `json:"name" validate:"required,min=1,max=255"`
+	Campaign string `json:"campaign,omitempty" validate:"omitempty,max=150"`
+}
+
+type OptionDto struct {
+	Label string `json:"label" validate:"required,min=1,max=255"`
+	Value string `json:"value,omitempty" validate:"max=255"`
+}
+
+type QuestionDto struct {
+	Prompt       string          `json:"prompt" validate:"required,min=1"`
+	QuestionType string          `json:"questionType" validate:"required,oneof='check' 'multi-check' 'drop-down' 'text'"`
+	Required     *bool           `json:"required,omitempty"`
+	Active       *bool           `json:"active,omitempty"`
+	MetaData     json.RawMessage `json:"metaData,omitempty" validate:"omitempty,json"`
+	Options      []OptionDto     `json:"options,omitempty" validate:"dive"`
+}
+
+// QuestionUpdate is a partial question edit, nil fields are left unchanged
+type QuestionUpdate struct {
+	Prompt       *string         `json:"prompt,omitempty" validate:"omitnil,min=1"`
+	QuestionType *string         `json:"questionType,omitempty" validate:"omitnil,oneof='check' 'multi-check' 'drop-down' 'text'"`
+	Required     *bool           `json:"required,omitempty"`
+	Active       *bool           `json:"active,omitempty"`
+	MetaData     json.RawMessage `json:"metaData,omitempty" validate:"omitempty,json"`
+}
+
+// OptionUpdate is a partial option edit, nil fields are left unchanged
+type OptionUpdate struct {
+	Label *string `json:"label,omitempty" validate:"omitnil,min=1,max=255"`
+	Value *string `json:"value,omitempty" validate:"omitnil,max=255"`
+}
+
+// OrderDto lists every child id in the new order
+type OrderDto struct {
+	IDs []uuid.UUID `json:"ids" validate:"required,min=1"`
+}
+
+type FeatureDto struct {
+	Title            string   `json:"title" validate:"required,min=1,max=150"`
+	Name             string   `json:"name" validate:"required,min=1,max=150"`
+	Details          string   `json:"details" validate:"required,min=1"`
+	QuickDescription string   `json:"quickDescription" validate:"required,min=1"`
+	Images           []string `json:"images,omitempty" validate:"dive,url"`
+}
+
+// FeatureUpdate is a partial feature edit, nil fields are left unchanged
+type FeatureUpdate struct {
+	Title            *string   `json:"title,omitempty" validate:"omitnil,min=1,max=150"`
+	Name             *string   `json:"name,omitempty" validate:"omitnil,min=1,max=150"`
+	Details          *string   `json:"details,omitempty" validate:"omitnil,min=1"`
+	QuickDescription *string   `json:"quickDescription,omitempty" validate:"omitnil,min=1"`
+	Images           *[]string `json:"images,omitempty" validate:"omitnil,dive,url"`
+}
+
+func (s SurveyDto) Validate() error {
+	return validate(s)
+}
+
+func (o OptionDto) Validate() error {
+	return validate(o)
+}
+
+func (q QuestionDto) Validate() error {
+	return validate(q)
+}
+
+func (q QuestionUpdate) Validate() error {
+	return validate(q)
+}
+
+func (o OptionUpdate) Validate() error {
+	return validate(o)
+}
+
+func (o OrderDto) Validate() error {
+	return validate(o)
+}
+
+func (f FeatureDto) Validate() error {
+	return validate(f)
+}
+
+func (f FeatureUpdate) Validate() error {
+	return validate(f)
+}
+
+func validate(s any) error {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	return v.Struct(s)
+}
+
 type FileUploadDto struct {
 	File    multipart.File
 	FileKey string
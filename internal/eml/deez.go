@@ -6,3 +6,8 @@ import "strings"
 func StripDomain(email string) string {
 	return strings.Split(email, "@")[0]
 }
+
+// Normalize trims and lowercases an email so the same address always compares equal
+func Normalize(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,37 @@
+// Package idempotency replays the first response to a request for retries that send the same
+// Idempotency-Key, so a client on a flaky network can retry a signup without signing up twice
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInFlight = errors.New("a request with this idempotency key is still being processed")
+	// ErrMismatch means the key was reused for a request with a different body
+	ErrMismatch = errors.New("idempotency key was already used for a different request")
+)
+
+// Record is what is kept under a key, Status is 0 while the first request is still running
+type Record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Done reports whether the first request finished and its response can be replayed
+func (r Record) Done() bool {
+	return r.Status != 0
+}
+
+// Store holds records by key. Begin claims a free key for lock and returns nil, or returns the
+// record already under the key.
+type Store interface {
+	Begin(ctx context.Context, key, fingerprint string, lock time.Duration) (*Record, error)
+	Complete(ctx context.Context, key string, rec Record, window time.Duration) error
+	Release(ctx context.Context, key string) error
+}
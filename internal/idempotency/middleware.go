@@ -0,0 +1,230 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/zrp9/launchl/internal/auth"
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLen = 255
+	// bodies are read up front to fingerprint the request. Small ones are kept in memory, larger ones like
+	// csv imports and image uploads are spooled to a temp file so the handler can still read them.
+	maxMemoryBody = 1 << 20
+	maxBodySize   = 64 << 20
+)
+
+var ErrInvalidKey = fmt.Errorf("%s must be 1 to %d characters", Header, maxKeyLen)
+
+// replayHeaders are the response headers kept with the body, the rest like X-Request-ID belong to
+// whichever request is being answered
+var replayHeaders = []string{"Content-Type", "Location"}
+
+// Guard makes the routes it wraps idempotent for callers that send an Idempotency-Key. Keys are
+// scoped to the route and the caller, the signed in user or the client ip of anonymous callers. The
+// body fingerprint keeps a reused key from replaying the response to a different request.
+type Guard struct {
+	store  Store
+	cfg    config.IdempotencyCfg
+	logger *crane.Zlogrus
+}
+
+func New(s Store, cfg config.IdempotencyCfg, l *crane.Zlogrus) *Guard {
+	return &Guard{
+		store:  s,
+		cfg:    cfg,
+		logger: l,
+	}
+}
+
+// Wrap is middleware for a single route. Requests without a key go straight through, the first
+// request with a key runs and its response is kept for the window, retries get it replayed and a
+// retry that arrives while the first is still running gets a 409. Server errors aren't kept so the
+// client can retry them. A nil Guard lets everything through.
+func (g *Guard) Wrap(next http.Handler) http.HandlerFunc {
+	if g == nil {
+		return next.ServeHTTP
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxKeyLen {
+			request.WriteErr(w, http.StatusBadRequest, ErrInvalidKey)
+			return
+		}
+
+		fp, cleanup, err := spoolBody(w, r)
+		if err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			request.WriteErr(w, status, err)
+			return
+		}
+		defer cleanup()
+
+		id := storeKey(caller(r), r.Pattern, key)
+		rec, err := g.store.Begin(r.Context(), id, fp, g.cfg.LockTimeout)
+		if err != nil {
+			// without the store the request still runs, like it would without a key
+			g.logger.Ctx(r.Context()).MustError(fmt.Errorf("idempotency key could not be claimed %w", err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rec != nil {
+			switch {
+			case rec.Fingerprint != fp:
+				request.WriteErr(w, http.StatusUnprocessableEntity, ErrMismatch)
+			case !rec.Done():
+				request.WriteErr(w, http.StatusConflict, ErrInFlight)
+			default:
+				replay(w, rec)
+			}
+			return
+		}
+
+		// the key is released if the handler panics or fails so the retry runs it again
+		ctx := context.WithoutCancel(r.Context())
+		kept := false
+		defer func() {
+			if !kept {
+				if err := g.store.Release(ctx, id); err != nil {
+					g.logger.Ctx(ctx).MustError(fmt.Errorf("idempotency key could not be released %w", err))
+				}
+			}
+		}()
+
+		rw := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		if rw.status >= http.StatusInternalServerError {
+			return
+		}
+
+		header := make(http.Header)
+		for _, h := range replayHeaders {
+			if v := rw.Header().Values(h); len(v) > 0 {
+				header[h] = v
+			}
+		}
+
+		err = g.store.Complete(ctx, id, Record{Fingerprint: fp, Status: rw.status, Header: header, Body: rw.body.Bytes()}, g.cfg.Window)
+		if err != nil {
+			g.logger.Ctx(ctx).MustError(fmt.Errorf("idempotent response could not be kept %w", err))
+			return
+		}
+		kept = true
+	}
+}
+
+func replay(w http.ResponseWriter, rec *Record) {
+	for h, v := range rec.Header {
+		w.Header()[h] = v
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body) //nolint:errcheck
+}
+
+// caller tells anonymous callers apart by ip so two of them picking the same key never see each others
+// responses, an anonymous retry has to come from the same address to be replayed
+func caller(r *http.Request) string {
+	if claims, ok := auth.ClaimsFromContext(r.Context()); ok && claims.ID != "" {
+		return "user:" + claims.ID
+	}
+	return "ip:" + request.ClientIP(r.Context())
+}
+
+// storeKey hashes the parts so client chosen keys can't collide across routes or callers
+func storeKey(caller, route, key string) string {
+	sum := sha256.Sum256([]byte(caller + "\x00" + route + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// spoolBody reads the body to fingerprint the request, which ties a key to the request it was first
+// sent with, and puts a copy back on r for the handler. cleanup removes the temp file of a large body.
+func spoolBody(w http.ResponseWriter, r *http.Request) (string, func(), error) {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\x00")) //nolint:errcheck
+
+	src := http.MaxBytesReader(w, r.Body, maxBodySize)
+	var buf bytes.Buffer
+	if _, err := io.CopyN(io.MultiWriter(&buf, h), src, maxMemoryBody+1); err != nil {
+		if !errors.Is(err, io.EOF) {
+			return "", nil, err
+		}
+		r.Body = io.NopCloser(&buf)
+		return hex.EncodeToString(h.Sum(nil)), func() {}, nil
+	}
+
+	f, err := os.CreateTemp("", "idempotency-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		f.Close()           //nolint:errcheck
+		os.Remove(f.Name()) //nolint:errcheck
+	}
+
+	if _, err := buf.WriteTo(f); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if _, err := io.Copy(io.MultiWriter(f, h), src); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	r.Body = io.NopCloser(f)
+	return hex.EncodeToString(h.Sum(nil)), cleanup, nil
+}
+
+// recorder keeps a copy of the response as it's written
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rw *recorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recorder) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	rw.body.Write(p) //nolint:errcheck
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *recorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,221 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+// memStore is a Store without expiry for tests
+type memStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func newMemStore() *memStore {
+	return &memStore{records: make(map[string]Record)}
+}
+
+func (m *memStore) Begin(ctx context.Context, key, fingerprint string, lock time.Duration) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rec, ok := m.records[key]; ok {
+		return &rec, nil
+	}
+	m.records[key] = Record{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (m *memStore) Complete(ctx context.Context, key string, rec Record, window time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[key] = rec
+	return nil
+}
+
+func (m *memStore) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, key)
+	return nil
+}
+
+func newTestGuard(t *testing.T) *Guard {
+	t.Helper()
+	logger := crane.NewLogger(crane.NewLogFile(crane.WithFilename(filepath.Join(t.TempDir(), crane.LogName))))
+	return New(newMemStore(), config.IdempotencyCfg{Window: time.Hour, LockTimeout: time.Minute}, logger)
+}
+
+// serve routes through a mux so r.Pattern is set like it is in the server
+func serve(h http.Handler, key, body, ip string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("POST /user/subscribe", h)
+
+	r := httptest.NewRequest(http.MethodPost, "/user/subscribe", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	r = r.WithContext(request.WithClientIP(r.Context(), ip))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+// countingHandler echoes the body back with a 201 and counts how often it ran
+func countingHandler(calls *atomic.Int32, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body) //nolint:errcheck
+	})
+}
+
+func TestReplay(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestGuard(t).Wrap(countingHandler(&calls, http.StatusCreated))
+
+	first := serve(h, "key-1", `{"email":"jane@example.com"}`, "10.0.0.1")
+	retry := serve(h, "key-1", `{"email":"jane@example.com"}`, "10.0.0.1")
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler ran %d times, want 1", calls.Load())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry = %d %q, want %d %q", retry.Code, retry.Body, first.Code, first.Body)
+	}
+	if retry.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("%s = %q, want true", ReplayedHeader, retry.Header().Get(ReplayedHeader))
+	}
+	if first.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("first response was marked as replayed")
+	}
+	if ct := retry.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
+
+func TestAnonymousCallersDontShareKeys(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestGuard(t).Wrap(countingHandler(&calls, http.StatusCreated))
+
+	tests := []struct {
+		ip   string
+		body string
+	}{
+		{ip: "10.0.0.1", body: `{"email":"jane@example.com"}`},
+		{ip: "10.0.0.2", body: `{"email":"jane@example.com"}`},
+		{ip: "10.0.0.3", body: `{"email":"john@example.com"}`},
+	}
+
+	for _, tt := range tests {
+		w := serve(h, "key-1", tt.body, tt.ip)
+		if w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "" {
+			t.Errorf("%s got %d replayed=%q, want a fresh 201", tt.ip, w.Code, w.Header().Get(ReplayedHeader))
+		}
+	}
+	if calls.Load() != int32(len(tests)) {
+		t.Errorf("handler ran %d times, want %d", calls.Load(), len(tests))
+	}
+}
+
+func TestConflictingBody(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestGuard(t).Wrap(countingHandler(&calls, http.StatusCreated))
+
+	serve(h, "key-1", `{"email":"jane@example.com"}`, "10.0.0.1")
+	w := serve(h, "key-1", `{"email":"john@example.com"}`, "10.0.0.1")
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := newTestGuard(t).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serve(h, "key-1", `{}`, "10.0.0.1")
+	}()
+	<-started
+
+	w := serve(h, "key-1", `{}`, "10.0.0.1")
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate while in flight = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("first = %d, want %d", first.Code, http.StatusCreated)
+	}
+	if w := serve(h, "key-1", `{}`, "10.0.0.1"); w.Code != http.StatusCreated || w.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry after completion = %d replayed %q, want a replayed %d", w.Code, w.Header().Get(ReplayedHeader), http.StatusCreated)
+	}
+}
+
+func TestServerErrorIsRetried(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestGuard(t).Wrap(countingHandler(&calls, http.StatusInternalServerError))
+
+	serve(h, "key-1", `{}`, "10.0.0.1")
+	w := serve(h, "key-1", `{}`, "10.0.0.1")
+
+	if calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", calls.Load())
+	}
+	if w.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("server error was replayed")
+	}
+}
+
+func TestWithoutKey(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestGuard(t).Wrap(countingHandler(&calls, http.StatusCreated))
+
+	serve(h, "", `{}`, "10.0.0.1")
+	serve(h, "", `{}`, "10.0.0.1")
+
+	if calls.Load() != 2 {
+		t.Errorf("handler ran %d times, want 2", calls.Load())
+	}
+}
+
+func TestLargeBody(t *testing.T) {
+	var calls atomic.Int32
+	h := newTestGuard(t).Wrap(countingHandler(&calls, http.StatusCreated))
+
+	body := strings.Repeat("a", maxMemoryBody+10)
+	first := serve(h, "key-1", body, "10.0.0.1")
+	if !bytes.Equal(first.Body.Bytes(), []byte(body)) {
+		t.Fatalf("handler read %d bytes of a spooled body, want %d", first.Body.Len(), len(body))
+	}
+
+	w := serve(h, "key-1", body[:len(body)-1]+"b", "10.0.0.1")
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("changed large body = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
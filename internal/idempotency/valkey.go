@@ -0,0 +1,74 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// beginAttempts covers a claimed key expiring between the SET NX and the GET
+const beginAttempts = 3
+
+// ValkeyStore keeps records in valkey and lets their ttl expire them
+type ValkeyStore struct {
+	client valkey.Client
+	prefix string
+}
+
+func NewValkeyStore(client valkey.Client) ValkeyStore {
+	return ValkeyStore{
+		client: client,
+		prefix: "idempotency:",
+	}
+}
+
+func (v ValkeyStore) Begin(ctx context.Context, key, fingerprint string, lock time.Duration) (*Record, error) {
+	pending, err := json.Marshal(Record{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	for range beginAttempts {
+		cmd := v.client.B().Set().Key(v.prefix + key).Value(string(pending)).Nx().Px(lock).Build()
+		err := v.client.Do(ctx, cmd).Error()
+		if err == nil {
+			return nil, nil
+		}
+		if !valkey.IsValkeyNil(err) {
+			return nil, err
+		}
+
+		raw, err := v.client.Do(ctx, v.client.B().Get().Key(v.prefix+key).Build()).AsBytes()
+		if valkey.IsValkeyNil(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var rec Record
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return nil, err
+		}
+		return &rec, nil
+	}
+
+	return nil, fmt.Errorf("could not claim idempotency key after %d attempts", beginAttempts)
+}
+
+func (v ValkeyStore) Complete(ctx context.Context, key string, rec Record, window time.Duration) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	cmd := v.client.B().Set().Key(v.prefix + key).Value(string(raw)).Px(window).Build()
+	return v.client.Do(ctx, cmd).Error()
+}
+
+func (v ValkeyStore) Release(ctx context.Context, key string) error {
+	return v.client.Do(ctx, v.client.B().Del().Key(v.prefix+key).Build()).Error()
+}
@@ -0,0 +1,121 @@
+// Package metrics holds the prometheus collectors served on /metrics
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "launchl"
+
+// UnmatchedRoute labels requests the mux had no pattern for so raw paths never become label values
+const UnmatchedRoute = "unmatched"
+
+// signup sources
+const (
+	SignupDirect   = "direct"
+	SignupReferred = "referred"
+	SignupImport   = "import"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests handled by route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	jobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "processed_total",
+		Help:      "Stream jobs processed by consumer and result.",
+	}, []string{"consumer", "result"})
+
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "jobs",
+		Name:      "duration_seconds",
+		Help:      "Time spent processing a stream job.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"consumer", "result"})
+
+	signups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "signups_total",
+		Help:      "Subscribers created by source.",
+	}, []string{"source"})
+
+	referrals = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "referrals_total",
+		Help:      "Subscribers that signed up through a referal link.",
+	})
+
+	verified = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "users",
+		Name:      "verified_total",
+		Help:      "Subscribers marked verified.",
+	})
+)
+
+// Handler serves everything registered with the default registry, including go runtime and process stats
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest counts a handled request, route is the mux pattern path and not the raw url
+func ObserveRequest(method, route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, code).Inc()
+	httpDuration.WithLabelValues(method, route, code).Observe(d.Seconds())
+}
+
+// ObserveJob counts a job a stream consumer finished
+func ObserveJob(consumer string, success bool, d time.Duration) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	jobs.WithLabelValues(consumer, result).Inc()
+	jobDuration.WithLabelValues(consumer, result).Observe(d.Seconds())
+}
+
+// Signups counts n new subscribers from source
+func Signups(source string, n int) {
+	signups.WithLabelValues(source).Add(float64(n))
+}
+
+// Referral counts a signup that came through a referal link
+func Referral() {
+	referrals.Inc()
+}
+
+// Verified counts a subscriber that was verified for the first time
+func Verified() {
+	verified.Inc()
+}
+
+// RegisterDB exposes the connection pool stats of db
+func RegisterDB(db *sql.DB, name string) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db, name))
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zrp9/launchl/internal/services/valkaree"
+)
+
+// scrapeTimeout bounds the valkey calls made while prometheus waits on a scrape
+const scrapeTimeout = 2 * time.Second
+
+// StreamStater is the part of a stream the collector reads
+type StreamStater interface {
+	Length(ctx context.Context) (int64, error)
+	Groups(ctx context.Context) ([]valkaree.GroupInfo, error)
+}
+
+var (
+	streamUp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "up"),
+		"Whether the last scrape could read the stream.",
+		[]string{"stream"}, nil,
+	)
+	streamLength = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "length"),
+		"Entries in the stream.",
+		[]string{"stream"}, nil,
+	)
+	groupPending = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "group_pending"),
+		"Entries delivered to the group and not acknowledged yet.",
+		[]string{"stream", "group"}, nil,
+	)
+	groupLag = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "group_lag"),
+		"Entries in the stream not delivered to the group yet.",
+		[]string{"stream", "group"}, nil,
+	)
+	groupConsumers = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "stream", "group_consumers"),
+		"Consumers in the group.",
+		[]string{"stream", "group"}, nil,
+	)
+)
+
+// streamCollector reads the stream on every scrape so lag and pending are never stale
+type streamCollector struct {
+	name   string
+	stream StreamStater
+}
+
+// RegisterStream exposes the length of the stream and the pending count and lag of its groups
+func RegisterStream(name string, s StreamStater) error {
+	return prometheus.Register(streamCollector{name: name, stream: s})
+}
+
+func (c streamCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- streamUp
+	ch <- streamLength
+	ch <- groupPending
+	ch <- groupLag
+	ch <- groupConsumers
+}
+
+func (c streamCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	length, err := c.stream.Length(ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(streamUp, prometheus.GaugeValue, 0, c.name)
+		return
+	}
+
+	groups, err := c.stream.Groups(ctx)
+	if err != nil {
+		ch <- prometheus.MustNewConstMetric(streamUp, prometheus.GaugeValue, 0, c.name)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(streamUp, prometheus.GaugeValue, 1, c.name)
+	ch <- prometheus.MustNewConstMetric(streamLength, prometheus.GaugeValue, float64(length), c.name)
+	for _, g := range groups {
+		ch <- prometheus.MustNewConstMetric(groupPending, prometheus.GaugeValue, float64(g.Pending), c.name, g.Name)
+		ch <- prometheus.MustNewConstMetric(groupConsumers, prometheus.GaugeValue, float64(g.Consumers), c.name, g.Name)
+		if g.Lag >= 0 {
+			ch <- prometheus.MustNewConstMetric(groupLag, prometheus.GaugeValue, float64(g.Lag), c.name, g.Name)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/zrp9/launchl/internal/auth"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+const AdminRole = "admin"
+
+// TokenCookie holds the callers token, Authorize reads it and SetToken sets it
+const TokenCookie = "token"
+
+// SetToken signs the caller in by setting the token cookie
+func SetToken(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     TokenCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Authorize validates the token cookie, rejects callers whose role is not in roles
+// and puts the callers claims on the request context for handlers and audit logging.
+func Authorize(roles ...string) Middleware {
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			cook, err := r.Cookie(TokenCookie)
+			if err != nil {
+				request.WriteErr(w, http.StatusUnauthorized, request.ErrUnAuthorized)
+				return
+			}
+
+			claims, err := auth.ValidateToken(cook.Value)
+			if err != nil {
+				request.WriteErr(w, http.StatusUnauthorized, request.ErrUnAuthorized)
+				return
+			}
+
+			if len(roles) > 0 && !slices.Contains(roles, claims.Role) {
+				request.WriteErr(w, http.StatusForbidden, errors.New("forbidden"))
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithClaims(r.Context(), claims)))
+		}
+	}
+}
+
+// Self rejects callers acting on another users {username} path, admins can act on anyone. It reads
+// the claims Authorize put on the context so it has to run after it.
+func Self(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFromContext(r.Context())
+		if !ok {
+			request.WriteErr(w, http.StatusUnauthorized, request.ErrUnAuthorized)
+			return
+		}
+
+		if claims.Role != AdminRole && claims.Username != r.PathValue("username") {
+			request.WriteErr(w, http.StatusForbidden, errors.New("forbidden"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zrp9/launchl/internal/auth"
+)
+
+func TestSelf(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *auth.UserClaims
+		want   int
+	}{
+		{name: "no claims", want: http.StatusUnauthorized},
+		{name: "same user", claims: &auth.UserClaims{Username: "jane", Role: "subscriber"}, want: http.StatusOK},
+		{name: "another user", claims: &auth.UserClaims{Username: "john", Role: "subscriber"}, want: http.StatusForbidden},
+		{name: "admin", claims: &auth.UserClaims{Username: "root", Role: AdminRole}, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.Handle("POST /user/{username}/features/{id}/vote", Self(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+			r := httptest.NewRequest(http.MethodPost, "/user/jane/features/1/vote", nil)
+			if tt.claims != nil {
+				r = r.WithContext(auth.WithClaims(r.Context(), tt.claims))
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTokenSignsIn(t *testing.T) {
+	t.Setenv("AUTH_KEY", "test-key")
+	token, err := auth.GenerateToken("8c7f7f0e-5d1a-4a4e-9a57-3b1f1c2d9e10", "jane", auth.SubscriberRole)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{name: "own vote", path: "/user/jane/features/1/vote", token: token, want: http.StatusOK},
+		{name: "another users vote", path: "/user/john/features/1/vote", token: token, want: http.StatusForbidden},
+		{name: "tampered token", path: "/user/jane/features/1/vote", token: token + "x", want: http.StatusUnauthorized},
+		{name: "no token", path: "/user/jane/features/1/vote", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			mux.Handle("POST /user/{username}/features/{id}/vote", MiddlewareChain(Authorize(), Self)(ok))
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.token != "" {
+				signin := httptest.NewRecorder()
+				SetToken(signin, tt.token, time.Now().Add(time.Hour))
+				for _, c := range signin.Result().Cookies() {
+					r.AddCookie(c)
+				}
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+var ErrCORSRejected = errors.New("cross origin request is not allowed")
+
+// MethodResolver lists the methods the route a request is for accepts, CORS answers preflights
+// with them so a path only advertises what it serves
+type MethodResolver func(r *http.Request) []string
+
+// originPattern is an allowed origin, a wildcard host matches any subdomain but not the domain itself
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+type cors struct {
+	origins     []originPattern
+	any         bool
+	headers     []string
+	allHeaders  string
+	exposed     string
+	credentials bool
+	maxAge      string
+	methods     MethodResolver
+}
+
+// CORS answers preflights and marks responses to allowed origins. Requests from origins that aren't
+// allowed still reach the handler without cors headers so the browser keeps the response from the page.
+func CORS(cfg config.CORSCfg, methods MethodResolver) (Middleware, error) {
+	c := cors{
+		headers:     make([]string, 0, len(cfg.AllowedHeaders)),
+		exposed:     strings.Join(cfg.ExposedHeaders, ", "),
+		credentials: cfg.AllowCredentials,
+		methods:     methods,
+	}
+
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			c.any = true
+			continue
+		}
+
+		p, err := parseOriginPattern(o)
+		if err != nil {
+			return nil, err
+		}
+		c.origins = append(c.origins, p)
+	}
+	if c.any && c.credentials {
+		return nil, errors.New("cors can't allow credentials for every origin, list the origins instead")
+	}
+
+	for _, h := range cfg.AllowedHeaders {
+		c.headers = append(c.headers, http.CanonicalHeaderKey(h))
+	}
+	c.allHeaders = strings.Join(c.headers, ", ")
+
+	if secs := int64(cfg.MaxAge.Seconds()); secs > 0 {
+		c.maxAge = strconv.FormatInt(secs, 10)
+	}
+
+	return c.handle, nil
+}
+
+func (c cors) handle(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin)
+			return
+		}
+
+		if c.allowed(origin) {
+			c.allowOrigin(h, origin)
+			if c.exposed != "" {
+				h.Set("Access-Control-Expose-Headers", c.exposed)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// preflight never reaches the handler, the browser only wants to know if the real request may be sent
+func (c cors) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	if !c.allowed(origin) {
+		request.WriteErr(w, http.StatusForbidden, fmt.Errorf("%w: origin %s", ErrCORSRejected, origin))
+		return
+	}
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	methods := c.methods(r)
+	if !slices.Contains(methods, method) {
+		request.WriteErr(w, http.StatusForbidden, fmt.Errorf("%w: method %s", ErrCORSRejected, method))
+		return
+	}
+
+	for _, requested := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		requested = strings.TrimSpace(requested)
+		if requested != "" && !slices.Contains(c.headers, http.CanonicalHeaderKey(requested)) {
+			request.WriteErr(w, http.StatusForbidden, fmt.Errorf("%w: header %s", ErrCORSRejected, requested))
+			return
+		}
+	}
+
+	c.allowOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if c.allHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", c.allHeaders)
+	}
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c cors) allowOrigin(h http.Header, origin string) {
+	if c.any {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c cors) allowed(origin string) bool {
+	if c.any {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme, host, port := strings.ToLower(u.Scheme), strings.ToLower(u.Hostname()), u.Port()
+
+	for _, p := range c.origins {
+		if p.scheme != scheme || p.port != port {
+			continue
+		}
+		if p.wildcard && strings.HasSuffix(host, "."+p.host) {
+			return true
+		}
+		if !p.wildcard && p.host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOriginPattern takes scheme://host[:port] where host may start with *.
+func parseOriginPattern(s string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok || scheme == "" || rest == "" || strings.ContainsAny(rest, "/?#") {
+		return originPattern{}, fmt.Errorf("cors origin %q must look like scheme://host[:port]", s)
+	}
+
+	p := originPattern{scheme: strings.ToLower(scheme)}
+	if strings.HasPrefix(rest, "*.") {
+		p.wildcard = true
+		rest = rest[2:]
+	}
+
+	u, err := url.Parse(p.scheme + "://" + rest)
+	if err != nil || u.Hostname() == "" || strings.Contains(u.Hostname(), "*") {
+		return originPattern{}, fmt.Errorf("cors origin %q has an invalid host", s)
+	}
+	p.host = strings.ToLower(u.Hostname())
+	p.port = u.Port()
+
+	return p, nil
+}
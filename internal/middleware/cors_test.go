@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+)
+
+var testCORS = config.CORSCfg{
+	AllowedOrigins:   []string{"https://zrp3.dev", "https://*.zrp3.dev", "http://localhost:3000"},
+	AllowedHeaders:   []string{"Content-Type", "X-Request-ID"},
+	ExposedHeaders:   []string{"X-Request-ID", "Retry-After"},
+	AllowCredentials: true,
+	MaxAge:           10 * time.Minute,
+}
+
+// testMethods stands in for the mux, /features/{id} only takes GET and PATCH
+func testMethods(r *http.Request) []string {
+	if r.URL.Path == "/features/1" {
+		return []string{http.MethodGet, http.MethodPatch}
+	}
+	return nil
+}
+
+func newTestCORS(t *testing.T, cfg config.CORSCfg) (http.Handler, *bool) {
+	t.Helper()
+	mw, err := CORS(cfg, testMethods)
+	if err != nil {
+		t.Fatalf("CORS() error = %v", err)
+	}
+
+	called := new(bool)
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		w.WriteHeader(http.StatusOK)
+	})), called
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		headers    string
+		wantStatus int
+		wantOrigin string
+	}{
+		{name: "exact origin", origin: "https://zrp3.dev", method: "PATCH", headers: "content-type", wantStatus: http.StatusNoContent, wantOrigin: "https://zrp3.dev"},
+		{name: "wildcard subdomain", origin: "https://admin.zrp3.dev", method: "GET", wantStatus: http.StatusNoContent, wantOrigin: "https://admin.zrp3.dev"},
+		{name: "nested subdomain", origin: "https://a.b.zrp3.dev", method: "GET", wantStatus: http.StatusNoContent, wantOrigin: "https://a.b.zrp3.dev"},
+		{name: "origin with port", origin: "http://localhost:3000", method: "GET", wantStatus: http.StatusNoContent, wantOrigin: "http://localhost:3000"},
+		{name: "wrong port", origin: "http://localhost:4000", method: "GET", wantStatus: http.StatusForbidden},
+		{name: "wrong scheme", origin: "http://zrp3.dev", method: "GET", wantStatus: http.StatusForbidden},
+		{name: "lookalike domain", origin: "https://evilzrp3.dev", method: "GET", wantStatus: http.StatusForbidden},
+		{name: "method the route doesn't serve", origin: "https://zrp3.dev", method: "DELETE", wantStatus: http.StatusForbidden},
+		{name: "header that isn't allowed", origin: "https://zrp3.dev", method: "GET", headers: "X-Custom", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, called := newTestCORS(t, testCORS)
+
+			r := httptest.NewRequest(http.MethodOptions, "/features/1", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if *called {
+				t.Error("preflight reached the handler")
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+
+			want := map[string]string{
+				"Access-Control-Allow-Methods":     "GET, PATCH",
+				"Access-Control-Allow-Headers":     "Content-Type, X-Request-Id",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			}
+			for header, value := range want {
+				if got := w.Header().Get(header); got != value {
+					t.Errorf("%s = %q, want %q", header, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		origin      string
+		wantOrigin  string
+		wantExposed string
+	}{
+		{name: "allowed origin", origin: "https://www.zrp3.dev", wantOrigin: "https://www.zrp3.dev", wantExposed: "X-Request-ID, Retry-After"},
+		{name: "other origin", origin: "https://example.com"},
+		{name: "same origin request without origin header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, called := newTestCORS(t, testCORS)
+
+			r := httptest.NewRequest(http.MethodPatch, "/features/1", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if !*called {
+				t.Fatal("request did not reach the handler")
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Expose-Headers"); got != tt.wantExposed {
+				t.Errorf("Access-Control-Expose-Headers = %q, want %q", got, tt.wantExposed)
+			}
+
+			wantCreds := ""
+			if tt.wantOrigin != "" {
+				wantCreds = "true"
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != wantCreds {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, wantCreds)
+			}
+			if tt.origin != "" && w.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	cfg := testCORS
+	cfg.AllowedOrigins = []string{"*"}
+	if _, err := CORS(cfg, testMethods); err == nil {
+		t.Fatal("CORS() allowed credentials for every origin")
+	}
+
+	cfg.AllowCredentials = false
+	h, _ := newTestCORS(t, cfg)
+	r := httptest.NewRequest(http.MethodGet, "/features/1", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+}
+
+func TestCORSInvalidOrigin(t *testing.T) {
+	for _, origin := range []string{"zrp3.dev", "https://", "https://zrp3.dev/path", "https://a.*.zrp3.dev"} {
+		cfg := testCORS
+		cfg.AllowedOrigins = []string{origin}
+		if _, err := CORS(cfg, testMethods); err == nil {
+			t.Errorf("CORS() accepted origin %q", origin)
+		}
+	}
+}
@@ -24,3 +24,15 @@ func (w *WrappedWriter) WriteHeader(status int) {
 	w.ResponseWriter.WriteHeader(status)
 	w.StatusCode = status
 }
+
+// Flush passes through so streamed responses like exports still reach the client as they're written
+func (w *WrappedWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *WrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,16 @@
+drop index if exists idx_usr_deleted_at;
+drop index if exists idx_usr_email_live;
+
+-- soft deleted rows are kept, an email that was deleted and signed up again would break the old
+-- constraint so it's only restored when every email is unique
+do $$
+begin
+	if exists (select 1 from users group by email having count(*) > 1) then
+		raise notice 'users_email_key not restored, some emails belong to more than one user';
+	else
+		alter table users add constraint users_email_key unique (email);
+	end if;
+end $$;
+
+alter table users drop column if exists anonymized_at;
+alter table users drop column if exists deleted_at;
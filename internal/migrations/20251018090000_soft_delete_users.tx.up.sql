@@ -0,0 +1,7 @@
+alter table users add column if not exists deleted_at timestamptz null;
+alter table users add column if not exists anonymized_at timestamptz null;
+
+-- soft deleted users keep their row so email uniqueness only applies to live users
+alter table users drop constraint if exists users_email_key;
+create unique index if not exists idx_usr_email_live on users (email) where deleted_at is null;
+create index if not exists idx_usr_deleted_at on users (deleted_at) where deleted_at is not null;
@@ -0,0 +1,3 @@
+drop trigger if exists trg_audit_log_immutable on audit_log;
+drop function if exists audit_log_immutable();
+drop table if exists audit_log;
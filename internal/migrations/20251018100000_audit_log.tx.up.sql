@@ -0,0 +1,28 @@
+create table if not exists audit_log (
+	id uuid default uuid_generate_v4() primary key,
+	actor varchar(150) not null,
+	actor_role varchar(255) null,
+	action varchar(75) not null,
+	entity_type varchar(75) not null,
+	entity_id varchar(255) not null,
+	before jsonb null,
+	after jsonb null,
+	diff jsonb not null default '{}'::jsonb,
+	request_id varchar(128) null,
+	created_at timestamptz not null default current_timestamp
+);
+
+create index if not exists idx_audit_entity on audit_log (entity_type, entity_id, created_at desc);
+create index if not exists idx_audit_actor on audit_log (actor, created_at desc);
+
+-- the log is append only, reject any attempt to rewrite history
+create or replace function audit_log_immutable() returns trigger as $$
+begin
+	raise exception 'audit_log is append only';
+end;
+$$ language plpgsql;
+
+drop trigger if exists trg_audit_log_immutable on audit_log;
+create trigger trg_audit_log_immutable
+	before update or delete on audit_log
+	for each row execute function audit_log_immutable();
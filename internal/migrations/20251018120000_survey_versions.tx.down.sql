@@ -0,0 +1,7 @@
+drop index if exists idx_survey_parent;
+drop index if exists idx_survey_campaign_version;
+drop index if exists idx_survey_campaign_active;
+alter table surveys drop column if exists published_at;
+alter table surveys drop column if exists parent_id;
+alter table surveys drop column if exists status;
+alter table surveys drop column if exists campaign;
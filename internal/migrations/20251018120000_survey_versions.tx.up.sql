@@ -0,0 +1,29 @@
+alter table surveys add column if not exists campaign varchar(150) not null default 'default';
+alter table surveys add column if not exists status varchar(20) not null default 'draft';
+alter table surveys add column if not exists parent_id uuid null references surveys (id) on delete set null;
+alter table surveys add column if not exists published_at timestamptz null;
+
+-- surveys made before campaigns may share a version, later copies move past the highest one so
+-- every version of a campaign is unique
+with copies as (
+	select id, campaign, created_at,
+		row_number() over (partition by campaign, version order by created_at, id) as copy
+	from surveys
+), moved as (
+	select id, campaign, row_number() over (partition by campaign order by created_at, id) as n
+	from copies
+	where copy > 1
+)
+update surveys s
+set version = ((
+	select coalesce(max(case when version ~ '^[0-9]+$' then version::integer end), 0)
+	from surveys
+	where campaign = moved.campaign
+) + moved.n)::text
+from moved
+where s.id = moved.id;
+
+-- only one survey per campaign can be live at a time
+create unique index if not exists idx_survey_campaign_active on surveys (campaign) where active;
+create unique index if not exists idx_survey_campaign_version on surveys (campaign, version);
+create index if not exists idx_survey_parent on surveys (parent_id) where parent_id is not null;
@@ -0,0 +1,4 @@
+drop index if exists idx_response_question;
+drop index if exists idx_response_submission;
+alter table user_survey_responses drop column if exists submission_id;
+drop table if exists survey_submissions;
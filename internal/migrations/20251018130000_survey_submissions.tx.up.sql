@@ -0,0 +1,22 @@
+create table if not exists survey_submissions (
+	id uuid default uuid_generate_v4() primary key,
+	survey_id uuid not null references surveys (id) on delete cascade,
+	user_id uuid not null references users (id) on delete cascade,
+	created_at timestamptz not null default current_timestamp,
+	updated_at timestamptz not null default current_timestamp
+);
+
+-- resubmitting upserts on this so a user only ever has one set of answers per survey
+create unique index if not exists idx_submission_survey_user on survey_submissions (survey_id, user_id);
+
+create table if not exists user_survey_responses (
+	id uuid default uuid_generate_v4() primary key,
+	question_id uuid not null references survey_questions (id) on delete cascade,
+	user_id uuid not null references users (id) on delete cascade,
+	option_id uuid null references survey_question_options (id),
+	written_response text null
+);
+
+alter table user_survey_responses add column if not exists submission_id uuid null references survey_submissions (id) on delete cascade;
+create index if not exists idx_response_submission on user_survey_responses (submission_id);
+create index if not exists idx_response_question on user_survey_responses (question_id);
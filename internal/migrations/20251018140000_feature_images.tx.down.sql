@@ -0,0 +1 @@
+alter table features drop column if exists images;
@@ -0,0 +1 @@
+alter table features add column if not exists images jsonb not null default '[]'::jsonb;
@@ -0,0 +1,10 @@
+create table if not exists feature_votes (
+	user_id uuid not null references users (id) on delete cascade,
+	feature_id uuid not null references features (id) on delete cascade,
+	boost bigint not null default 0,
+	created_at timestamptz not null default current_timestamp,
+	primary key (user_id, feature_id)
+);
+
+-- ranking counts votes per feature
+create index if not exists idx_feature_votes_feature on feature_votes (feature_id);
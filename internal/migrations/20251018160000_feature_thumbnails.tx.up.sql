@@ -0,0 +1 @@
+alter table features add column if not exists thumbnails jsonb not null default '{}';
@@ -0,0 +1,2 @@
+drop index if exists idx_usr_uninvited;
+alter table users drop column if exists invited_at;
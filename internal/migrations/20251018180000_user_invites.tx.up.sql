@@ -0,0 +1,4 @@
+alter table users add column if not exists invited_at timestamptz;
+
+-- waves invite the front of the line that hasn't been invited yet
+create index if not exists idx_usr_uninvited on users (que_position) where invited_at is null and deleted_at is null;
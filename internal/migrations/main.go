@@ -1,4 +1,4 @@
-// Package migrations embeds migrations Filesystem and provides way to run migrations from migrator
+// Package migrations embeds the sql migrations so the migrator and the health check share them
 package migrations
 
 import (
@@ -13,12 +13,6 @@ func New() *migrate.Migrations {
 	return migrations
 }
 
-func init() {
-	if err := migrations.DiscoverCaller(); err != nil {
-		panic(err)
-	}
-}
-
 //go:embed *.sql
 var sqlMigrations embed.FS
 
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+)
+
+// sweepEvery is how often full buckets are dropped so one off clients don't pile up
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	seen   time.Time
+	window time.Duration
+}
+
+// MemoryStore keeps buckets in the process, limits are per instance
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, p config.RatePolicy) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit), seen: now}
+		m.buckets[key] = b
+	}
+	b.tokens = refill(p, b.tokens, now.Sub(b.seen))
+	b.seen = now
+	b.window = p.Window
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return result(p, b.tokens, allowed), nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again, a fresh bucket is the same
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepEvery {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if now.Sub(b.seen) >= b.window {
+			delete(m.buckets, key)
+		}
+	}
+}
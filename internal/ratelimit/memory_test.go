@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	policy := config.RatePolicy{Limit: 3, Window: 3 * time.Second}
+
+	type take struct {
+		// after is how long after the previous take this one happens
+		after         time.Duration
+		wantAllowed   bool
+		wantRemaining int
+	}
+
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{
+			name: "burst up to the limit",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+				{wantAllowed: true, wantRemaining: 0},
+				{wantAllowed: false, wantRemaining: 0},
+			},
+		},
+		{
+			name: "one token back per rate interval",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+				{wantAllowed: true, wantRemaining: 0},
+				{after: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0},
+				{after: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+				{wantAllowed: false, wantRemaining: 0},
+			},
+		},
+		{
+			name: "refill stops at the limit",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2},
+				{after: time.Hour, wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+			},
+		},
+		{
+			name: "a full window refills an empty bucket",
+			takes: []take{
+				{wantAllowed: true, wantRemaining: 2},
+				{wantAllowed: true, wantRemaining: 1},
+				{wantAllowed: true, wantRemaining: 0},
+				{after: 3 * time.Second, wantAllowed: true, wantRemaining: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			m := NewMemoryStore()
+			m.now = func() time.Time { return now }
+
+			for i, tk := range tt.takes {
+				now = now.Add(tk.after)
+				res, err := m.Take(context.Background(), "subscribe:10.0.0.1", policy)
+				if err != nil {
+					t.Fatalf("take %d: %v", i, err)
+				}
+				if res.Allowed != tk.wantAllowed || res.Remaining != tk.wantRemaining {
+					t.Errorf("take %d = allowed %v remaining %d, want allowed %v remaining %d", i, res.Allowed, res.Remaining, tk.wantAllowed, tk.wantRemaining)
+				}
+				if !res.Allowed && res.RetryAfter <= 0 {
+					t.Errorf("take %d was refused without a Retry-After", i)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreKeysAreSeparate(t *testing.T) {
+	m := NewMemoryStore()
+	policy := config.RatePolicy{Limit: 1, Window: time.Minute}
+
+	if res, _ := m.Take(context.Background(), "subscribe:10.0.0.1", policy); !res.Allowed {
+		t.Fatal("first take from 10.0.0.1 was refused")
+	}
+	if res, _ := m.Take(context.Background(), "subscribe:10.0.0.2", policy); !res.Allowed {
+		t.Error("10.0.0.2 was refused because 10.0.0.1 used its bucket")
+	}
+}
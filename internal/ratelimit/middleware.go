@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/middleware"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+var ErrLimited = errors.New("too many requests, try again later")
+
+// maxPeek is how much of a body ByEmail reads looking for the email, signup bodies are far smaller
+const maxPeek = 64 << 10
+
+// Limits hands out the middleware for each named policy, routes that share a policy share buckets
+type Limits struct {
+	store    Store
+	policies map[string]config.RatePolicy
+	logger   *crane.Zlogrus
+}
+
+func NewLimits(s Store, policies map[string]config.RatePolicy, l *crane.Zlogrus) *Limits {
+	return &Limits{
+		store:    s,
+		policies: policies,
+		logger:   l,
+	}
+}
+
+// For limits requests by client ip with the named policy. Unknown or disabled policies and a nil
+// Limits let everything through.
+func (l *Limits) For(name string) middleware.Middleware {
+	return l.limit(name, func(r *http.Request) string {
+		ip := request.ClientIP(r.Context())
+		if ip == "" {
+			ip = r.RemoteAddr
+		}
+		return ip
+	})
+}
+
+// ByEmail limits requests by the email in their json body with the named policy so one address
+// can't be signed up over and over from rotating ips. Bodies without an email are let through for
+// the handler to reject, the ip limit still applies to them.
+func (l *Limits) ByEmail(name string) middleware.Middleware {
+	return l.limit(name, func(r *http.Request) string {
+		email := peekEmail(r)
+		if email == "" {
+			return ""
+		}
+		// keys are hashed so addresses aren't written to valkey in the clear
+		sum := sha256.Sum256([]byte(email))
+		return "email:" + hex.EncodeToString(sum[:])
+	})
+}
+
+// limit takes a token from the bucket key returns for each request, an empty key skips the limit
+func (l *Limits) limit(name string, key func(r *http.Request) string) middleware.Middleware {
+	if l == nil {
+		return passThrough
+	}
+
+	p, ok := l.policies[name]
+	if !ok || p.Limit <= 0 || p.Window <= 0 {
+		return passThrough
+	}
+
+	return func(next http.Handler) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			k := key(r)
+			if k == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, err := l.store.Take(r.Context(), name+":"+k, p)
+			if err != nil {
+				// a broken limiter shouldn't take signups down with it
+				l.logger.Ctx(r.Context()).MustError(fmt.Errorf("rate limit %s could not be checked %w", name, err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", seconds(res.Reset))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", p.Limit, seconds(p.Window)))
+
+			if !res.Allowed {
+				h.Set("Retry-After", seconds(res.RetryAfter))
+				request.WriteErr(w, http.StatusTooManyRequests, ErrLimited)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// peekEmail reads the email field out of the start of a json body and puts what it read back in
+// front of the rest so the handler still sees the whole body
+func peekEmail(r *http.Request) string {
+	if r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+
+	head, err := io.ReadAll(io.LimitReader(r.Body, maxPeek))
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(head), r.Body), Closer: r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(head, &payload); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func passThrough(next http.Handler) http.HandlerFunc {
+	return next.ServeHTTP
+}
+
+// seconds rounds up so clients never retry before a token is back
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+func newTestLimits(t *testing.T, policies map[string]config.RatePolicy) *Limits {
+	t.Helper()
+	logger := crane.NewLogger(crane.NewLogFile(crane.WithFilename(filepath.Join(t.TempDir(), crane.LogName))))
+	return NewLimits(NewMemoryStore(), policies, logger)
+}
+
+func post(h http.Handler, body, ip string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/user/subscribe", strings.NewReader(body))
+	r = r.WithContext(request.WithClientIP(r.Context(), ip))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// echo writes the body it was handed back so tests can check the limiter left it intact
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Write(body) //nolint:errcheck
+})
+
+func TestByEmail(t *testing.T) {
+	l := newTestLimits(t, map[string]config.RatePolicy{
+		"subscribe-email": {Limit: 1, Window: time.Hour},
+	})
+	h := l.ByEmail("subscribe-email")(echo)
+
+	tests := []struct {
+		name       string
+		body       string
+		ip         string
+		wantStatus int
+	}{
+		{name: "first signup", body: `{"email":"jane@example.com"}`, ip: "10.0.0.1", wantStatus: http.StatusOK},
+		{name: "same email from another ip", body: `{"email":"jane@example.com"}`, ip: "10.0.0.2", wantStatus: http.StatusTooManyRequests},
+		{name: "case and spacing don't make a new email", body: `{"email":" Jane@Example.com "}`, ip: "10.0.0.3", wantStatus: http.StatusTooManyRequests},
+		{name: "another email", body: `{"email":"john@example.com"}`, ip: "10.0.0.1", wantStatus: http.StatusOK},
+		{name: "no email is left to the handler", body: `{"username":"jane"}`, ip: "10.0.0.1", wantStatus: http.StatusOK},
+		{name: "invalid json is left to the handler", body: `{"email":`, ip: "10.0.0.1", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := post(h, tt.body, tt.ip)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("handler read %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestByEmailKeepsLargeBodies(t *testing.T) {
+	l := newTestLimits(t, map[string]config.RatePolicy{
+		"subscribe-email": {Limit: 1, Window: time.Hour},
+	})
+	body := `{"email":"jane@example.com","bio":"` + strings.Repeat("a", maxPeek) + `"}`
+
+	w := post(l.ByEmail("subscribe-email")(echo), body, "10.0.0.1")
+	if w.Body.Len() != len(body) {
+		t.Errorf("handler read %d bytes, want %d", w.Body.Len(), len(body))
+	}
+}
+
+func TestFor(t *testing.T) {
+	l := newTestLimits(t, map[string]config.RatePolicy{
+		"subscribe": {Limit: 1, Window: time.Minute},
+		"disabled":  {Limit: 0, Window: time.Minute},
+	})
+
+	tests := []struct {
+		name       string
+		policy     string
+		ips        []string
+		wantStatus int
+		wantLimit  string
+	}{
+		{name: "second request from one ip", policy: "subscribe", ips: []string{"10.0.0.1", "10.0.0.1"}, wantStatus: http.StatusTooManyRequests, wantLimit: "1"},
+		{name: "requests from different ips", policy: "subscribe", ips: []string{"10.0.0.2", "10.0.0.3"}, wantStatus: http.StatusOK, wantLimit: "1"},
+		{name: "disabled policy", policy: "disabled", ips: []string{"10.0.0.1", "10.0.0.1"}, wantStatus: http.StatusOK},
+		{name: "unknown policy", policy: "missing", ips: []string{"10.0.0.1", "10.0.0.1"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := l.For(tt.policy)(echo)
+			var w *httptest.ResponseRecorder
+			for _, ip := range tt.ips {
+				w = post(h, `{}`, ip)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("RateLimit-Limit"); got != tt.wantLimit {
+				t.Errorf("RateLimit-Limit = %q, want %q", got, tt.wantLimit)
+			}
+			if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("refused without a Retry-After")
+			}
+		})
+	}
+}
+
+func TestNilLimits(t *testing.T) {
+	var l *Limits
+	if w := post(l.ByEmail("subscribe-email")(echo), `{"email":"jane@example.com"}`, "10.0.0.1"); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,76 @@
+// Package ratelimit limits how often a client can call a route with token buckets kept in memory
+// for a single instance or in valkey so replicas share them
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/zrp9/launchl/internal/config"
+)
+
+// Result is the state of a bucket after a request took, or failed to take, a token
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token when the request was refused
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store takes a token from the bucket under key, buckets hold p.Limit tokens and refill evenly over p.Window
+type Store interface {
+	Take(ctx context.Context, key string, p config.RatePolicy) (Result, error)
+}
+
+// New builds the store the config names, the valkey backend needs client
+func New(cfg config.RateLimitCfg, client valkey.Client) (Store, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "valkey":
+		if client == nil {
+			return nil, fmt.Errorf("rate limit backend valkey needs a valkey client")
+		}
+		return NewValkeyStore(client), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+	}
+}
+
+// perMs is how many tokens the bucket gains every millisecond
+func perMs(p config.RatePolicy) float64 {
+	return float64(p.Limit) / float64(p.Window.Milliseconds())
+}
+
+// refill tops tokens up for the time since the bucket was last touched
+func refill(p config.RatePolicy, tokens float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return tokens
+	}
+	return math.Min(float64(p.Limit), tokens+float64(elapsed.Milliseconds())*perMs(p))
+}
+
+// result describes a bucket left with tokens
+func result(p config.RatePolicy, tokens float64, allowed bool) Result {
+	rate := perMs(p)
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     msDuration((float64(p.Limit) - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = msDuration((1 - tokens) / rate)
+	}
+	return res
+}
+
+func msDuration(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/zrp9/launchl/internal/config"
+)
+
+// takeScript refills and takes from the bucket in one step so replicas can't race each other. It
+// uses the servers clock so replicas with drifting clocks still agree. The bucket expires once it
+// would be full again.
+var takeScript = valkey.NewLuaScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or limit
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(limit, tokens + (now - ts) * limit / window)
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, tostring(tokens)}
+`)
+
+// ValkeyStore keeps buckets in valkey so every replica draws from the same ones
+type ValkeyStore struct {
+	client valkey.Client
+	prefix string
+}
+
+func NewValkeyStore(client valkey.Client) ValkeyStore {
+	return ValkeyStore{
+		client: client,
+		prefix: "ratelimit:",
+	}
+}
+
+func (v ValkeyStore) Take(ctx context.Context, key string, p config.RatePolicy) (Result, error) {
+	args := []string{strconv.Itoa(p.Limit), strconv.FormatInt(p.Window.Milliseconds(), 10)}
+	reply, err := takeScript.Exec(ctx, v.client, []string{v.prefix + key}, args).ToArray()
+	if err != nil {
+		return Result{}, err
+	}
+	if len(reply) != 2 {
+		return Result{}, fmt.Errorf("rate limit script returned %d values", len(reply))
+	}
+
+	allowed, err := reply[0].AsInt64()
+	if err != nil {
+		return Result{}, err
+	}
+	raw, err := reply[1].ToString()
+	if err != nil {
+		return Result{}, err
+	}
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(p, tokens, allowed == 1), nil
+}
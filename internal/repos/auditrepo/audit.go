@@ -0,0 +1,42 @@
+// Package auditrepo stores the append only audit log, entries are never updated or deleted
+package auditrepo
+
+import (
+	"context"
+
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos"
+)
+
+// Fields are the audit log columns admins can filter and sort on
+var Fields = repos.Fields{
+	"actor":      {Column: "actor", Kind: repos.KindString, Sortable: true},
+	"action":     {Column: "action", Kind: repos.KindString, Sortable: true},
+	"entityType": {Column: "entity_type", Kind: repos.KindString, Sortable: true},
+	"entityId":   {Column: "entity_id", Kind: repos.KindString},
+	"requestId":  {Column: "request_id", Kind: repos.KindString},
+	"createdAt":  {Column: "created_at", Kind: repos.KindTime, Sortable: true},
+}
+
+type AuditRepo struct {
+	repo *repos.BasicRepo[string, domain.AuditEntry]
+}
+
+func New(p store.Persister) AuditRepo {
+	return AuditRepo{
+		repo: repos.New[string, domain.AuditEntry](p),
+	}
+}
+
+func (a AuditRepo) Create(ctx context.Context, entry *domain.AuditEntry) (*domain.AuditEntry, error) {
+	return a.repo.Create(ctx, entry)
+}
+
+func (a AuditRepo) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.AuditEntry, int, error) {
+	// newest first unless the caller asked for something else
+	if len(spec.Sorts) == 0 {
+		spec.Sorts = []repos.Sort{{Field: "createdAt", Desc: true}}
+	}
+	return a.repo.Find(ctx, spec, Fields)
+}
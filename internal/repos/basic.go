@@ -7,9 +7,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
 	"github.com/zrp9/launchl/internal/database/store"
 )
 
@@ -30,6 +30,53 @@ var ErrDBRead = errors.New("failed to read db")
 var ErrDBDelete = errors.New("failed to delete db record")
 var ErrFailedTransaction = errors.New("an issue occurred with the transaction")
 var ErrFailedRollback = errors.New("failed to rollback db")
+var ErrConflict = errors.New("record was modified by another request")
+var ErrDuplicate = errors.New("record already exists")
+
+// uniqueViolation is the postgres sqlstate for a duplicate key
+const uniqueViolation = "23505"
+
+// WriteErr wraps a failed insert or update, a duplicate key is reported as ErrDuplicate
+func WriteErr(err error) error {
+	var pgErr pgdriver.Error
+	if errors.As(err, &pgErr) && pgErr.Field('C') == uniqueViolation {
+		return errors.Join(ErrDuplicate, err)
+	}
+	return errors.Join(ErrDBWrite, err)
+}
+
+// ConflictErr is returned when an update loses an optimistic lock, it unwraps to ErrConflict
+type ConflictErr struct {
+	ID      any
+	Version int64
+}
+
+func (c ConflictErr) Error() string {
+	return fmt.Sprintf("%v: id %v is no longer at version %d", ErrConflict, c.ID, c.Version)
+}
+
+func (c ConflictErr) Unwrap() error {
+	return ErrConflict
+}
+
+// Versioned models are updated with optimistic concurrency control, an update only
+// applies if the row still has the version that was read and bumps it by one.
+type Versioned interface {
+	CurrentVersion() int64
+	SetVersion(v int64)
+}
+
+type withDeletedKey struct{}
+
+// WithDeleted makes reads made with the returned context include soft deleted rows
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey{}, true)
+}
+
+func includeDeleted(ctx context.Context) bool {
+	b, _ := ctx.Value(withDeletedKey{}).(bool)
+	return b
+}
 
 type identifier interface {
 	~int | ~string
@@ -57,9 +104,19 @@ func New[T identifier, M any](store store.Persister) *BasicRepo[T, M] {
 	}
 }
 
+// NewSelect starts a select on the ambient connection. Models with a soft_delete column
+// exclude deleted rows unless ctx was made with WithDeleted.
+func (br BasicRepo[T, M]) NewSelect(ctx context.Context) *bun.SelectQuery {
+	q := br.IDB(ctx).NewSelect()
+	if includeDeleted(ctx) {
+		q = q.WhereAllWithDeleted()
+	}
+	return q
+}
+
 func (br BasicRepo[T, M]) Get(ctx context.Context, key T) (*M, error) {
 	var domObj M
-	err := br.BnDB().NewSelect().Model(&domObj).Where("? = ?", bun.Ident("id"), key).Scan(ctx, &domObj)
+	err := br.NewSelect(ctx).Model(&domObj).Where("? = ?", bun.Ident("id"), key).Scan(ctx, &domObj)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNoRecords
@@ -72,7 +129,7 @@ func (br BasicRepo[T, M]) Get(ctx context.Context, key T) (*M, error) {
 
 func (br BasicRepo[T, M]) GetAll(ctx context.Context) ([]*M, error) {
 	var domObj []M
-	err := br.BnDB().NewSelect().Model(&domObj).Scan(ctx, &domObj)
+	err := br.NewSelect(ctx).Model(&domObj).Scan(ctx, &domObj)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -91,7 +148,7 @@ func (br BasicRepo[T, M]) GetAll(ctx context.Context) ([]*M, error) {
 
 func (br BasicRepo[T, M]) GetPaginated(ctx context.Context, page, limit int) ([]*M, error) {
 	var domObj []M
-	err := br.BnDB().NewSelect().Model(&domObj).Offset(page).Limit(limit).Scan(ctx, &domObj)
+	err := br.NewSelect(ctx).Model(&domObj).Offset(page).Limit(limit).Scan(ctx, &domObj)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrNoRecords
@@ -107,74 +164,154 @@ func (br BasicRepo[T, M]) GetPaginated(ctx context.Context, page, limit int) ([]
 	return objs, nil
 }
 
-func (br BasicRepo[T, M]) Create(ctx context.Context, m *M) (*M, error) {
-
-	tx, err := br.BnDB().BeginTx(ctx, &sql.TxOptions{})
-
+// Find returns the page of records matching spec along with the total number of matching records
+func (br BasicRepo[T, M]) Find(ctx context.Context, spec QuerySpec, fields Fields) ([]*M, int, error) {
+	var domObj []M
+	q, err := spec.Apply(br.NewSelect(ctx).Model(&domObj), fields)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	// this below gives rowsEffected not the new user
-	//rslt, err := tx.NewInsert().Model(user).Returning("*").Exec(ctx)
-	err = tx.NewInsert().Model(m).
-		Returning("*").Scan(ctx, m)
-
+	count, err := q.ScanAndCount(ctx)
 	if err != nil {
-		emsg := fmt.Errorf("failed write operation %s", err)
-		if err = tx.Rollback(); err != nil {
-			log.Printf("db rollback err: %v", err)
-			return nil, err
+		if err == sql.ErrNoRows {
+			return nil, 0, ErrNoRecords
 		}
-		return nil, emsg
+		return nil, 0, errors.Join(ErrDBRead, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	objs := make([]*M, len(domObj))
+	for i := range domObj {
+		objs[i] = &domObj[i]
 	}
 
-	return m, nil
+	return objs, count, nil
 }
 
-func (br BasicRepo[T, M]) Update(ctx context.Context, k T, m *M) error {
-	tx, err := br.BnDB().BeginTx(ctx, &sql.TxOptions{})
+// Each streams every record matching spec's filters and sorts to fn, paging is ignored
+func (br BasicRepo[T, M]) Each(ctx context.Context, spec QuerySpec, fields Fields, fn func(*M) error) error {
+	spec.Limit = 0
+	q, err := spec.Apply(br.NewSelect(ctx).Model((*M)(nil)), fields)
 	if err != nil {
 		return err
 	}
 
-	if _, err = tx.NewUpdate().Model(m).OmitZero().Where("? = ?", bun.Ident("id"), k).Exec(ctx, m); err != nil {
-		emsg := fmt.Errorf("failed write operation %s", err)
-		if err = tx.Rollback(); err != nil {
-			return fmt.Errorf("failed to rollback after error %v", err)
+	return Each(ctx, br.BnDB(), q, fn)
+}
+
+// Create, Update and Delete join the transaction on ctx when there is one
+// so they can be composed with other repos through store.Transactor.
+
+func (br BasicRepo[T, M]) Create(ctx context.Context, m *M) (*M, error) {
+	err := br.RunInTx(ctx, func(ctx context.Context) error {
+		// this below gives rowsEffected not the new user
+		//rslt, err := tx.NewInsert().Model(user).Returning("*").Exec(ctx)
+		if err := br.IDB(ctx).NewInsert().Model(m).Returning("*").Scan(ctx, m); err != nil {
+			return fmt.Errorf("failed write operation %w", err)
 		}
-		return emsg
+		return nil
+	})
+
+	if err != nil {
+		return nil, errors.Join(ErrDBWrite, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
+	return m, nil
+}
+
+// Update writes the non zero fields of m. Versioned models return a ConflictErr
+// when the row was changed since m was read.
+func (br BasicRepo[T, M]) Update(ctx context.Context, k T, m *M) error {
+	err := br.RunInTx(ctx, func(ctx context.Context) error {
+		q := br.IDB(ctx).NewUpdate().Model(m).OmitZero().Where("? = ?", bun.Ident("id"), k)
+
+		v, versioned := any(m).(Versioned)
+		var read int64
+		if versioned {
+			read = v.CurrentVersion()
+			v.SetVersion(read + 1)
+			q = q.Where("? = ?", bun.Ident("version"), read)
+		}
+
+		res, err := q.Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("failed write operation %w", err)
+		}
+
+		if versioned {
+			if n, err := res.RowsAffected(); err == nil && n == 0 {
+				v.SetVersion(read)
+				return ConflictErr{ID: k, Version: read}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, ErrConflict) {
+			return err
+		}
+		return errors.Join(ErrDBWrite, err)
 	}
 
 	return nil
 }
 
-func (br BasicRepo[T, M]) Delete(ctx context.Context, k T) error {
+// Increment atomically adds delta to an integer column and returns the updated record.
+// Versioned models also get their version bumped so pending optimistic updates conflict.
+func (br BasicRepo[T, M]) Increment(ctx context.Context, k T, column string, delta int64) (*M, error) {
 	var domObj M
-	tx, err := br.BnDB().BeginTx(ctx, &sql.TxOptions{})
+	err := br.RunInTx(ctx, func(ctx context.Context) error {
+		q := br.IDB(ctx).NewUpdate().Model(&domObj).
+			Set("? = ? + ?", bun.Ident(column), bun.Ident(column), delta).
+			Where("? = ?", bun.Ident("id"), k)
+
+		if _, ok := any(&domObj).(Versioned); ok {
+			q = q.Set("? = ? + 1", bun.Ident("version"), bun.Ident("version"))
+		}
+
+		return q.Returning("*").Scan(ctx, &domObj)
+	})
+
 	if err != nil {
-		return err
+		if err == sql.ErrNoRows {
+			return nil, ErrNoRecords
+		}
+		return nil, errors.Join(ErrDBWrite, err)
 	}
 
-	_, err = tx.NewDelete().Model(&domObj).Where("? = ?", bun.Ident("id"), k).Exec(ctx)
-	if err != nil {
-		emsg := fmt.Errorf("failed to perform delete operation %v", err)
-		if err = tx.Rollback(); err != nil {
-			return err
+	return &domObj, nil
+}
+
+// Delete soft deletes models with a soft_delete column and removes the row otherwise
+func (br BasicRepo[T, M]) Delete(ctx context.Context, k T) error {
+	var domObj M
+	err := br.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := br.IDB(ctx).NewDelete().Model(&domObj).Where("? = ?", bun.Ident("id"), k).Exec(ctx); err != nil {
+			return fmt.Errorf("failed to perform delete operation %w", err)
 		}
-		return emsg
+		return nil
+	})
+
+	if err != nil {
+		return errors.Join(ErrDBDelete, err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
+	return nil
+}
+
+// HardDelete removes the row even when the model is soft deletable
+func (br BasicRepo[T, M]) HardDelete(ctx context.Context, k T) error {
+	var domObj M
+	err := br.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := br.IDB(ctx).NewDelete().Model(&domObj).Where("? = ?", bun.Ident("id"), k).ForceDelete().Exec(ctx); err != nil {
+			return fmt.Errorf("failed to perform delete operation %w", err)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return errors.Join(ErrDBDelete, err)
 	}
 
 	return nil
@@ -3,6 +3,8 @@ package configrepo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 
 	"github.com/uptrace/bun"
 	"github.com/zrp9/launchl/internal/database/store"
@@ -35,7 +37,7 @@ func (c RoleRepo) New(ctx context.Context, name string) (domain.Role, error) {
 
 func (c RoleRepo) Get(ctx context.Context, name string) (domain.Role, error) {
 	var role domain.Role
-	err := c.repo.BnDB().NewSelect().Model(&role).Where("? = ?", bun.Ident("name"), name).Scan(ctx, &role)
+	err := c.repo.NewSelect(ctx).Model(&role).Where("? = ?", bun.Ident("name"), name).Scan(ctx, &role)
 
 	if err != nil {
 		return domain.Role{}, err
@@ -62,6 +64,30 @@ func (c RoleRepo) GetByID(ctx context.Context, id string) (domain.Role, error) {
 	return *role, nil
 }
 
+// FeatureFields are the feature columns that can be filtered and sorted on,
+// sort=votes ranks the most voted first and sort=-votes the least
+var FeatureFields = repos.Fields{
+	"title":     {Column: "title", Kind: repos.KindString, Sortable: true},
+	"name":      {Column: "name", Kind: repos.KindString, Sortable: true},
+	"createdAt": {Column: "created_at", Kind: repos.KindTime, Sortable: true},
+	"updatedAt": {Column: "updated_at", Kind: repos.KindTime, Sortable: true},
+	"votes":     {Column: "fv.votes", Kind: repos.KindNumber, Sortable: true, Ranked: true},
+}
+
+// featureVotes counts from features outward so features nobody voted for rank with 0 instead of null,
+// votes of deleted users don't count
+const featureVotes = `join (
+	select ft.id as feature_id, count(v.user_id) as votes
+	from features as ft left join (
+		feature_votes as v join users as vu on vu.id = v.user_id and vu.deleted_at is null
+	) on v.feature_id = ft.id
+	group by ft.id
+) as fv on fv.feature_id = f.id`
+
+func withVotes(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.ColumnExpr("f.*").ColumnExpr("fv.votes").Join(featureVotes)
+}
+
 type FeatureRepo struct {
 	repo *repos.BasicRepo[string, domain.Feature]
 }
@@ -73,21 +99,82 @@ func NewFeatureRepo(p store.Persister) FeatureRepo {
 }
 
 func (f FeatureRepo) Get(ctx context.Context, id string) (*domain.Feature, error) {
-	return f.repo.Get(ctx, id)
+	var feat domain.Feature
+	err := withVotes(f.repo.NewSelect(ctx).Model(&feat)).Where("f.id = ?", id).Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repos.ErrNoRecords
+		}
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return &feat, nil
 }
 
 func (f FeatureRepo) GetAll(ctx context.Context) ([]*domain.Feature, error) {
 	return f.repo.GetAll(ctx)
 }
 
+// Find includes every features vote count, the most requested features come first unless the caller
+// sorts by something else
+func (f FeatureRepo) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.Feature, int, error) {
+	if len(spec.Sorts) == 0 {
+		spec.Sorts = []repos.Sort{{Field: "votes", Desc: true}, {Field: "createdAt"}}
+	}
+
+	var feats []*domain.Feature
+	q, err := spec.Apply(withVotes(f.repo.NewSelect(ctx).Model(&feats)), FeatureFields)
+	if err != nil {
+		return nil, 0, err
+	}
+	// ties keep the same order across pages
+	q = q.OrderExpr("f.id")
+
+	count, err := q.ScanAndCount(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, 0, repos.ErrNoRecords
+		}
+		return nil, 0, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return feats, count, nil
+}
+
 func (f FeatureRepo) Create(ctx context.Context, feat domain.Feature) (*domain.Feature, error) {
 	return f.repo.Create(ctx, &feat)
 }
 
+func (f FeatureRepo) BulkCreate(ctx context.Context, feats []domain.Feature) error {
+	return f.repo.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := f.repo.IDB(ctx).NewInsert().Model(&feats).Exec(ctx); err != nil {
+			return errors.Join(repos.ErrDBWrite, err)
+		}
+		return nil
+	})
+}
+
 func (f FeatureRepo) Update(ctx context.Context, feat domain.Feature) error {
 	return f.repo.Update(ctx, feat.ID.String(), &feat)
 }
 
+// Save writes every editable column, unlike Update it can clear the images and thumbnails
+func (f FeatureRepo) Save(ctx context.Context, feat *domain.Feature) error {
+	err := f.repo.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := f.repo.IDB(ctx).NewUpdate().Model(feat).
+			Column("title", "name", "details", "quick_description", "images", "thumbnails").
+			Set("updated_at = current_timestamp").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return errors.Join(repos.ErrDBWrite, err)
+	}
+
+	return nil
+}
+
 func (f FeatureRepo) Delete(ctx context.Context, id string) error {
 	return f.repo.Delete(ctx, id)
 }
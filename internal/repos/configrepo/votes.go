@@ -0,0 +1,94 @@
+package configrepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos"
+)
+
+type VoteRepo struct {
+	repo *repos.BasicRepo[string, domain.FeatureVote]
+}
+
+func NewVoteRepo(p store.Persister) VoteRepo {
+	return VoteRepo{
+		repo: repos.New[string, domain.FeatureVote](p),
+	}
+}
+
+func (v VoteRepo) Get(ctx context.Context, userID, featureID string) (*domain.FeatureVote, error) {
+	var vote domain.FeatureVote
+	err := v.repo.NewSelect(ctx).Model(&vote).
+		Where("user_id = ?", userID).
+		Where("feature_id = ?", featureID).
+		Scan(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, repos.ErrNoRecords
+		}
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return &vote, nil
+}
+
+// CountByUser locks the user row first so two votes at once can't both slip under the limit,
+// it only holds the lock when called inside a transaction
+func (v VoteRepo) CountByUser(ctx context.Context, userID string) (int, error) {
+	db := v.repo.IDB(ctx)
+	var locked string
+	err := db.NewSelect().Table("users").Column("id").Where("id = ?", userID).For("UPDATE").Scan(ctx, &locked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, repos.ErrNoRecords
+		}
+		return 0, errors.Join(repos.ErrDBRead, err)
+	}
+
+	count, err := db.NewSelect().Model((*domain.FeatureVote)(nil)).Where("user_id = ?", userID).Count(ctx)
+	if err != nil {
+		return 0, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return count, nil
+}
+
+// Add reports false when the user had already voted for the feature
+func (v VoteRepo) Add(ctx context.Context, vote *domain.FeatureVote) (bool, error) {
+	res, err := v.repo.IDB(ctx).NewInsert().Model(vote).
+		On("CONFLICT (user_id, feature_id) DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return false, errors.Join(repos.ErrDBWrite, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Join(repos.ErrDBWrite, err)
+	}
+
+	return n > 0, nil
+}
+
+// Remove returns the deleted vote so its boost can be taken back
+func (v VoteRepo) Remove(ctx context.Context, userID, featureID string) (*domain.FeatureVote, error) {
+	var vote domain.FeatureVote
+	res, err := v.repo.IDB(ctx).NewDelete().Model(&vote).
+		Where("user_id = ?", userID).
+		Where("feature_id = ?", featureID).
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, errors.Join(repos.ErrDBDelete, err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, repos.ErrNoRecords
+	}
+
+	return &vote, nil
+}
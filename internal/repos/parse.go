@@ -0,0 +1,216 @@
+package repos
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 25
+	MaxLimit     = 500
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// QueryErr is a validation error for a single query parameter
+type QueryErr struct {
+	Param  string `json:"param"`
+	Reason string `json:"reason"`
+}
+
+func (q QueryErr) Error() string {
+	return fmt.Sprintf("%s: %s", q.Param, q.Reason)
+}
+
+// QueryErrs collects every invalid parameter so clients can fix them all at once
+type QueryErrs []QueryErr
+
+func (q QueryErrs) Error() string {
+	msgs := make([]string, 0, len(q))
+	for _, e := range q {
+		msgs = append(msgs, e.Error())
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidQuery, strings.Join(msgs, "; "))
+}
+
+func (q QueryErrs) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+var kindOps = map[FieldKind][]Op{
+	KindString: {OpEq, OpNe, OpIn, OpILike},
+	KindNumber: {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn},
+	KindTime:   {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte},
+	KindBool:   {OpEq, OpNe},
+	KindUUID:   {OpEq, OpNe, OpIn},
+}
+
+// ParseQuery turns url query parameters into a QuerySpec validated against the fields whitelist.
+//
+//	?email[ilike]=gmail&wouldUse=true&createdAt[gte]=2025-01-01T00:00:00Z&sort=-createdAt,email&page=2&limit=50
+//
+// A parameter without an operator is an equality filter, in takes a comma separated list
+// and a leading - on a sort field orders descending, or ascending for a Ranked field. An in
+// filter can also be repeated, ?id[in]=a&id[in]=b is the same as ?id[in]=a,b. Any other
+// parameter given more than once is rejected rather than guessing which value was meant.
+func ParseQuery(values url.Values, fields Fields) (QuerySpec, error) {
+	spec := QuerySpec{Page: 1, Limit: DefaultLimit}
+	var errs QueryErrs
+
+	// sorted keys keep the generated sql and error order stable
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		val, err := single(key, values[key])
+		if err != nil {
+			errs = append(errs, *err)
+			continue
+		}
+
+		switch key {
+		case "page":
+			p, err := strconv.Atoi(val)
+			if err != nil || p < 1 {
+				errs = append(errs, QueryErr{Param: key, Reason: "must be a positive integer"})
+				continue
+			}
+			spec.Page = p
+		case "limit":
+			l, err := strconv.Atoi(val)
+			if err != nil || l < 1 || l > MaxLimit {
+				errs = append(errs, QueryErr{Param: key, Reason: fmt.Sprintf("must be between 1 and %d", MaxLimit)})
+				continue
+			}
+			spec.Limit = l
+		case "sort":
+			sorts, sortErrs := parseSorts(val, fields)
+			errs = append(errs, sortErrs...)
+			spec.Sorts = sorts
+		default:
+			f, err := parseFilter(key, val, fields)
+			if err != nil {
+				errs = append(errs, *err)
+				continue
+			}
+			spec.Filters = append(spec.Filters, f)
+		}
+	}
+
+	if len(errs) > 0 {
+		return QuerySpec{}, errs
+	}
+
+	return spec, nil
+}
+
+// single joins the values of a repeated in filter into one list and rejects every other repeat
+func single(key string, vals []string) (string, *QueryErr) {
+	if len(vals) <= 1 {
+		return strings.Join(vals, ""), nil
+	}
+	if strings.HasSuffix(key, "["+string(OpIn)+"]") {
+		return strings.Join(vals, ","), nil
+	}
+	return "", &QueryErr{Param: key, Reason: "may only be given once"}
+}
+
+func parseSorts(val string, fields Fields) ([]Sort, QueryErrs) {
+	var errs QueryErrs
+	sorts := make([]Sort, 0)
+	for _, s := range strings.Split(val, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		desc := strings.HasPrefix(s, "-")
+		name := strings.TrimPrefix(s, "-")
+		f, ok := fields[name]
+		if !ok || !f.Sortable {
+			errs = append(errs, QueryErr{Param: "sort", Reason: fmt.Sprintf("cannot sort by %q", name)})
+			continue
+		}
+		sorts = append(sorts, Sort{Field: name, Desc: desc != f.Ranked})
+	}
+
+	return sorts, errs
+}
+
+func parseFilter(key, val string, fields Fields) (Filter, *QueryErr) {
+	name, op := key, OpEq
+	if i := strings.Index(key, "["); i > 0 && strings.HasSuffix(key, "]") {
+		name = key[:i]
+		op = Op(key[i+1 : len(key)-1])
+	}
+
+	field, ok := fields[name]
+	if !ok {
+		return Filter{}, &QueryErr{Param: key, Reason: "unknown field"}
+	}
+
+	if !supportsOp(field.Kind, op) {
+		return Filter{}, &QueryErr{Param: key, Reason: fmt.Sprintf("operator %q not supported", op)}
+	}
+
+	vals := []string{val}
+	if op == OpIn {
+		vals = strings.Split(val, ",")
+	}
+
+	for _, v := range vals {
+		if err := checkKind(field.Kind, v); err != nil {
+			return Filter{}, &QueryErr{Param: key, Reason: err.Error()}
+		}
+	}
+
+	return Filter{Field: name, Op: op, Values: vals}, nil
+}
+
+func supportsOp(kind FieldKind, op Op) bool {
+	for _, o := range kindOps[kind] {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func checkKind(kind FieldKind, v string) error {
+	if v == "" {
+		return errors.New("value is required")
+	}
+
+	switch kind {
+	case KindNumber:
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return errors.New("must be a number")
+		}
+	case KindBool:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return errors.New("must be true or false")
+		}
+	case KindTime:
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			if _, err := time.Parse(time.DateOnly, v); err != nil {
+				return errors.New("must be an RFC3339 timestamp or YYYY-MM-DD date")
+			}
+		}
+	case KindUUID:
+		if _, err := uuid.Parse(v); err != nil {
+			return errors.New("must be a uuid")
+		}
+	}
+
+	return nil
+}
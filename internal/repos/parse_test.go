@@ -0,0 +1,176 @@
+package repos
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+var testFields = Fields{
+	"email":     {Column: "email", Kind: KindString, Sortable: true},
+	"position":  {Column: "que_position", Kind: KindNumber, Sortable: true},
+	"wouldUse":  {Column: "would_use", Kind: KindBool},
+	"createdAt": {Column: "created_at", Kind: KindTime, Sortable: true},
+	"id":        {Column: "id", Kind: KindUUID},
+	"votes":     {Column: "votes", Kind: KindNumber, Sortable: true, Ranked: true},
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		want       QuerySpec
+		wantParams []string
+	}{
+		{
+			name:  "defaults",
+			query: "",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit},
+		},
+		{
+			name:  "equality filter without an operator",
+			query: "wouldUse=true",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit, Filters: []Filter{{Field: "wouldUse", Op: OpEq, Values: []string{"true"}}}},
+		},
+		{
+			name:  "operators",
+			query: "email[ilike]=gmail&position[gte]=10&createdAt[lt]=2025-01-01",
+			want: QuerySpec{Page: 1, Limit: DefaultLimit, Filters: []Filter{
+				{Field: "createdAt", Op: OpLt, Values: []string{"2025-01-01"}},
+				{Field: "email", Op: OpILike, Values: []string{"gmail"}},
+				{Field: "position", Op: OpGte, Values: []string{"10"}},
+			}},
+		},
+		{
+			name:  "in splits on commas",
+			query: "position[in]=1,2,3",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit, Filters: []Filter{{Field: "position", Op: OpIn, Values: []string{"1", "2", "3"}}}},
+		},
+		{
+			name:  "repeated in filters are one list",
+			query: "position[in]=1,2&position[in]=3",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit, Filters: []Filter{{Field: "position", Op: OpIn, Values: []string{"1", "2", "3"}}}},
+		},
+		{
+			name:  "sorts keep their order and direction",
+			query: "sort=-createdAt, email",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit, Sorts: []Sort{{Field: "createdAt", Desc: true}, {Field: "email"}}},
+		},
+		{
+			name:  "ranked fields sort highest first",
+			query: "sort=votes",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit, Sorts: []Sort{{Field: "votes", Desc: true}}},
+		},
+		{
+			name:  "a leading - reverses a ranked field",
+			query: "sort=-votes",
+			want:  QuerySpec{Page: 1, Limit: DefaultLimit, Sorts: []Sort{{Field: "votes"}}},
+		},
+		{
+			name:  "page and limit",
+			query: "page=3&limit=50",
+			want:  QuerySpec{Page: 3, Limit: 50},
+		},
+		{
+			name:  "largest limit",
+			query: "limit=500",
+			want:  QuerySpec{Page: 1, Limit: MaxLimit},
+		},
+		{name: "limit zero", query: "limit=0", wantParams: []string{"limit"}},
+		{name: "limit over the max", query: "limit=501", wantParams: []string{"limit"}},
+		{name: "limit not a number", query: "limit=ten", wantParams: []string{"limit"}},
+		{name: "page zero", query: "page=0", wantParams: []string{"page"}},
+		{name: "negative page", query: "page=-1", wantParams: []string{"page"}},
+		{name: "unknown field", query: "password=x", wantParams: []string{"password"}},
+		{name: "operator the kind doesn't support", query: "wouldUse[gt]=true", wantParams: []string{"wouldUse[gt]"}},
+		{name: "unknown operator", query: "email[regex]=.*", wantParams: []string{"email[regex]"}},
+		{name: "bad number", query: "position=first", wantParams: []string{"position"}},
+		{name: "bad bool", query: "wouldUse=maybe", wantParams: []string{"wouldUse"}},
+		{name: "bad time", query: "createdAt[gte]=yesterday", wantParams: []string{"createdAt[gte]"}},
+		{name: "bad uuid in a list", query: "id[in]=7d444840-9dc0-11d1-b245-5ffdce74fad2,nope", wantParams: []string{"id[in]"}},
+		{name: "empty value", query: "email=", wantParams: []string{"email"}},
+		{name: "unsortable field", query: "sort=wouldUse", wantParams: []string{"sort"}},
+		{name: "repeated filter", query: "email=a@b.co&email=c@d.co", wantParams: []string{"email"}},
+		{name: "repeated operator filter", query: "position[gte]=1&position[gte]=5", wantParams: []string{"position[gte]"}},
+		{name: "repeated sort", query: "sort=email&sort=-createdAt", wantParams: []string{"sort"}},
+		{name: "repeated page", query: "page=1&page=2", wantParams: []string{"page"}},
+		{
+			name:       "every bad parameter is reported",
+			query:      "limit=0&page=0&sort=nope&wouldUse=maybe",
+			wantParams: []string{"limit", "page", "sort", "wouldUse"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec, err := ParseQuery(values, testFields)
+			if tt.wantParams != nil {
+				var errs QueryErrs
+				if !errors.As(err, &errs) {
+					t.Fatalf("err = %v, want QueryErrs", err)
+				}
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Errorf("err doesn't wrap ErrInvalidQuery")
+				}
+				params := make([]string, 0, len(errs))
+				for _, e := range errs {
+					params = append(params, e.Param)
+				}
+				if !reflect.DeepEqual(params, tt.wantParams) {
+					t.Errorf("invalid params = %v, want %v", params, tt.wantParams)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(spec, tt.want) {
+				t.Errorf("spec = %+v, want %+v", spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		page, limit, want int
+	}{
+		{page: 0, limit: 25, want: 0},
+		{page: 1, limit: 25, want: 0},
+		{page: 2, limit: 25, want: 25},
+		{page: 4, limit: 50, want: 150},
+	}
+
+	for _, tt := range tests {
+		if got := (QuerySpec{Page: tt.page, Limit: tt.limit}).Offset(); got != tt.want {
+			t.Errorf("page %d limit %d offset = %d, want %d", tt.page, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "gmail", want: "%gmail%"},
+		{in: "100%", want: `%100\%%`},
+		{in: "first_name", want: `%first\_name%`},
+		{in: `back\slash`, want: `%back\\slash%`},
+		{in: "%_", want: `%\%\_%`},
+		{in: "", want: "%%"},
+	}
+
+	for _, tt := range tests {
+		if got := likePattern(tt.in); got != tt.want {
+			t.Errorf("likePattern(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
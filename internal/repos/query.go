@@ -0,0 +1,132 @@
+package repos
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// Op is a comparison operator a Filter applies to a column
+type Op string
+
+const (
+	OpEq    Op = "eq"
+	OpNe    Op = "ne"
+	OpGt    Op = "gt"
+	OpGte   Op = "gte"
+	OpLt    Op = "lt"
+	OpLte   Op = "lte"
+	OpIn    Op = "in"
+	OpILike Op = "ilike"
+)
+
+var opSQL = map[Op]string{
+	OpEq:  "=",
+	OpNe:  "<>",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+// FieldKind decides which operators a field supports and how its values are validated
+type FieldKind int
+
+const (
+	KindString FieldKind = iota
+	KindNumber
+	KindBool
+	KindTime
+	KindUUID
+)
+
+// Field maps a public query parameter name to a column
+type Field struct {
+	Column   string
+	Kind     FieldKind
+	Sortable bool
+	// Ranked fields sort highest first by name alone, a leading - reverses them to lowest first
+	Ranked bool
+}
+
+// Fields is the whitelist of filterable/sortable fields for a model, keyed by the name used in the url
+type Fields map[string]Field
+
+type Filter struct {
+	Field  string
+	Op     Op
+	Values []string
+}
+
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// QuerySpec describes a filtered, sorted and paged list query
+type QuerySpec struct {
+	Filters []Filter
+	Sorts   []Sort
+	Page    int
+	Limit   int
+}
+
+func (q QuerySpec) Offset() int {
+	if q.Page <= 1 {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit
+}
+
+// Apply adds the spec's where, order, limit and offset clauses to a select query.
+// Fields are resolved against the whitelist so only known columns reach the sql.
+func (q QuerySpec) Apply(sq *bun.SelectQuery, fields Fields) (*bun.SelectQuery, error) {
+	for _, f := range q.Filters {
+		field, ok := fields[f.Field]
+		if !ok {
+			return nil, fmt.Errorf("field %q is not filterable", f.Field)
+		}
+
+		col := bun.Ident(field.Column)
+		switch f.Op {
+		case OpIn:
+			sq = sq.Where("? IN (?)", col, bun.In(f.Values))
+		case OpILike:
+			sq = sq.Where(`? ILIKE ? ESCAPE '\'`, col, likePattern(f.Values[0]))
+		default:
+			op, ok := opSQL[f.Op]
+			if !ok {
+				return nil, fmt.Errorf("unknown operator %q", f.Op)
+			}
+			sq = sq.Where(fmt.Sprintf("? %s ?", op), col, f.Values[0])
+		}
+	}
+
+	for _, s := range q.Sorts {
+		field, ok := fields[s.Field]
+		if !ok || !field.Sortable {
+			return nil, fmt.Errorf("field %q is not sortable", s.Field)
+		}
+
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+		sq = sq.OrderExpr(fmt.Sprintf("? %s", dir), bun.Ident(field.Column))
+	}
+
+	if q.Limit > 0 {
+		sq = sq.Limit(q.Limit).Offset(q.Offset())
+	}
+
+	return sq, nil
+}
+
+// likeEscaper makes wildcards in the value match literally so ilike is always a contains search
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likePattern matches the value anywhere in the column, it's used with ESCAPE '\'
+func likePattern(v string) string {
+	return "%" + likeEscaper.Replace(v) + "%"
+}
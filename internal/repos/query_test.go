@@ -0,0 +1,80 @@
+package repos
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// testDB renders queries without connecting, nothing here is sent to a database
+func testDB(t *testing.T) *bun.DB {
+	t.Helper()
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN("postgres://test@localhost/test"))), pgdialect.New())
+	t.Cleanup(func() { db.Close() }) //nolint:errcheck
+	return db
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    QuerySpec
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "ilike escapes wildcards",
+			spec: QuerySpec{Filters: []Filter{{Field: "email", Op: OpILike, Values: []string{"50%_off"}}}},
+			want: []string{`"email" ILIKE '%50\%\_off%' ESCAPE '\'`},
+		},
+		{
+			name: "comparison and in",
+			spec: QuerySpec{Filters: []Filter{
+				{Field: "position", Op: OpGte, Values: []string{"10"}},
+				{Field: "position", Op: OpIn, Values: []string{"1", "2"}},
+			}},
+			want: []string{`"que_position" >= '10'`, `"que_position" IN ('1', '2')`},
+		},
+		{
+			name: "sorts and paging",
+			spec: QuerySpec{Sorts: []Sort{{Field: "createdAt", Desc: true}, {Field: "email"}}, Page: 3, Limit: 20},
+			want: []string{`ORDER BY "created_at" DESC, "email" ASC LIMIT 20 OFFSET 40`},
+		},
+		{
+			name:    "unknown filter field",
+			spec:    QuerySpec{Filters: []Filter{{Field: "password", Op: OpEq, Values: []string{"x"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "unsortable field",
+			spec:    QuerySpec{Sorts: []Sort{{Field: "wouldUse"}}},
+			wantErr: true,
+		},
+	}
+
+	db := testDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tt.spec.Apply(db.NewSelect().Table("users"), testFields)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sql := q.String()
+			for _, w := range tt.want {
+				if !strings.Contains(sql, w) {
+					t.Errorf("sql %s\nis missing %s", sql, w)
+				}
+			}
+		})
+	}
+}
@@ -4,11 +4,37 @@ package referalrepo
 import (
 	"context"
 
+	"github.com/google/uuid"
+
 	"github.com/zrp9/launchl/internal/database/store"
 	"github.com/zrp9/launchl/internal/domain"
 	"github.com/zrp9/launchl/internal/repos"
 )
 
+// Fields are the referal columns admins can filter and sort on
+var Fields = repos.Fields{
+	"id":        {Column: "id", Kind: repos.KindUUID},
+	"refererId": {Column: "referer_id", Kind: repos.KindUUID},
+	"refereeId": {Column: "referee_id", Kind: repos.KindUUID},
+}
+
+// ExportFields are the columns referal exports can be filtered and sorted on
+var ExportFields = repos.Fields{
+	"refererId":    {Column: "rf.referer_id", Kind: repos.KindUUID},
+	"refereeId":    {Column: "rf.referee_id", Kind: repos.KindUUID},
+	"refererEmail": {Column: "er.email", Kind: repos.KindString, Sortable: true},
+	"refereeEmail": {Column: "ee.email", Kind: repos.KindString, Sortable: true},
+}
+
+// ExportRow is a referal with the emails of both users
+type ExportRow struct {
+	ID           uuid.UUID `bun:"id"`
+	RefererID    uuid.UUID `bun:"referer_id"`
+	RefererEmail string    `bun:"referer_email"`
+	RefereeID    uuid.UUID `bun:"referee_id"`
+	RefereeEmail string    `bun:"referee_email"`
+}
+
 type ReferalRepo struct {
 	repo *repos.BasicRepo[string, domain.Referal]
 }
@@ -27,6 +53,10 @@ func (r ReferalRepo) GetAll(ctx context.Context) ([]*domain.Referal, error) {
 	return r.repo.GetAll(ctx)
 }
 
+func (r ReferalRepo) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.Referal, int, error) {
+	return r.repo.Find(ctx, spec, Fields)
+}
+
 func (r ReferalRepo) Create(ctx context.Context, referal *domain.Referal) (*domain.Referal, error) {
 	return r.repo.Create(ctx, referal)
 }
@@ -38,3 +68,20 @@ func (r ReferalRepo) Update(ctx context.Context, referal *domain.Referal) error
 func (r ReferalRepo) Delete(ctx context.Context, id string) error {
 	return r.repo.Delete(ctx, id)
 }
+
+// EachExport streams the referals matching spec joined with both users emails to fn
+func (r ReferalRepo) EachExport(ctx context.Context, spec repos.QuerySpec, fn func(*ExportRow) error) error {
+	spec.Limit = 0
+	q := r.repo.IDB(ctx).NewSelect().
+		TableExpr("referals AS rf").
+		Join("JOIN users AS er ON er.id = rf.referer_id").
+		Join("JOIN users AS ee ON ee.id = rf.referee_id").
+		ColumnExpr("rf.id, rf.referer_id, er.email AS referer_email, rf.referee_id, ee.email AS referee_email")
+
+	q, err := spec.Apply(q, ExportFields)
+	if err != nil {
+		return err
+	}
+
+	return repos.Each(ctx, r.repo.BnDB(), q, fn)
+}
@@ -0,0 +1,36 @@
+package repos
+
+import (
+	"context"
+	"errors"
+
+	"github.com/uptrace/bun"
+)
+
+// Each runs q and hands fn one scanned row at a time. Rows are read off the connection as fn
+// consumes them so exports of any size run in constant memory, unlike GetAll.
+// Returning an error from fn stops the iteration and is returned as is.
+func Each[R any](ctx context.Context, db *bun.DB, q *bun.SelectQuery, fn func(*R) error) error {
+	rows, err := q.Rows(ctx)
+	if err != nil {
+		return errors.Join(ErrDBRead, err)
+	}
+	defer rows.Close() //nolint:errcheck
+
+	for rows.Next() {
+		var r R
+		if err := db.ScanRow(ctx, rows, &r); err != nil {
+			return errors.Join(ErrDBRead, err)
+		}
+
+		if err := fn(&r); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.Join(ErrDBRead, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package surveyrepo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos"
+)
+
+// TextAnswerFields are the text answer columns admins can filter and sort on
+var TextAnswerFields = repos.Fields{
+	"questionId":  {Column: "r.question_id", Kind: repos.KindUUID, Sortable: true},
+	"userId":      {Column: "r.user_id", Kind: repos.KindUUID},
+	"text":        {Column: "r.written_response", Kind: repos.KindString},
+	"submittedAt": {Column: "ss.updated_at", Kind: repos.KindTime, Sortable: true},
+}
+
+// segmentColumns counts distinct respondents overall and per segment, it expects the
+// responses as r, their users as u and ref holding the ids of every referred user
+const segmentColumns = `count(distinct r.user_id) as total,
+	count(distinct r.user_id) filter (where u.would_use) as would_use,
+	count(distinct r.user_id) filter (where not coalesce(u.would_use, false)) as would_not_use,
+	count(distinct r.user_id) filter (where coalesce(trim(u.company_name), '') <> '') as with_company,
+	count(distinct r.user_id) filter (where coalesce(trim(u.company_name), '') = '') as without_company,
+	count(distinct r.user_id) filter (where ref.referee_id is not null) as referred,
+	count(distinct r.user_id) filter (where ref.referee_id is null) as organic`
+
+// Tally counts respondents in total and split by the segments results are broken down by
+type Tally struct {
+	Total          int64 `bun:"total" json:"total"`
+	WouldUse       int64 `bun:"would_use" json:"wouldUse"`
+	WouldNotUse    int64 `bun:"would_not_use" json:"wouldNotUse"`
+	WithCompany    int64 `bun:"with_company" json:"withCompany"`
+	WithoutCompany int64 `bun:"without_company" json:"withoutCompany"`
+	Referred       int64 `bun:"referred" json:"referred"`
+	Organic        int64 `bun:"organic" json:"organic"`
+}
+
+type QuestionTally struct {
+	QuestionID uuid.UUID `bun:"question_id"`
+	Tally
+}
+
+type OptionTally struct {
+	QuestionID uuid.UUID `bun:"question_id"`
+	OptionID   uuid.UUID `bun:"option_id"`
+	Tally
+}
+
+// OptionPair counts respondents who picked both options of a multi-check question
+type OptionPair struct {
+	QuestionID uuid.UUID `bun:"question_id" json:"-"`
+	OptionA    uuid.UUID `bun:"option_a" json:"optionA"`
+	OptionB    uuid.UUID `bun:"option_b" json:"optionB"`
+	Count      int64     `bun:"count" json:"count"`
+}
+
+type TextAnswer struct {
+	QuestionID  uuid.UUID `bun:"question_id" json:"questionId"`
+	UserID      uuid.UUID `bun:"user_id" json:"userId"`
+	Text        string    `bun:"text" json:"text"`
+	SubmittedAt time.Time `bun:"submitted_at,nullzero" json:"submittedAt,omitempty"`
+}
+
+// ResultsRepo aggregates user_survey_responses in sql so results never need every response in memory
+type ResultsRepo struct {
+	repo *repos.BasicRepo[string, domain.SurveyResponse]
+}
+
+func NewResultsRepo(p store.Persister) ResultsRepo {
+	return ResultsRepo{
+		repo: repos.New[string, domain.SurveyResponse](p),
+	}
+}
+
+// responses selects the responses to surveyID joined with what the segment columns need, answers of
+// deleted users are left out so results match the users still on the list
+func (s ResultsRepo) responses(ctx context.Context, surveyID uuid.UUID) *bun.SelectQuery {
+	return s.repo.IDB(ctx).NewSelect().
+		TableExpr("user_survey_responses AS r").
+		Join("JOIN survey_questions AS q ON q.id = r.question_id").
+		Join("JOIN users AS u ON u.id = r.user_id AND u.deleted_at IS NULL").
+		Join("LEFT JOIN (SELECT DISTINCT referee_id FROM referals) AS ref ON ref.referee_id = r.user_id").
+		Where("q.survey_id = ?", surveyID)
+}
+
+// Respondents counts everyone who answered at least one question of the survey
+func (s ResultsRepo) Respondents(ctx context.Context, surveyID uuid.UUID) (Tally, error) {
+	var t Tally
+	if err := s.responses(ctx, surveyID).ColumnExpr(segmentColumns).Scan(ctx, &t); err != nil {
+		return t, errors.Join(repos.ErrDBRead, err)
+	}
+	return t, nil
+}
+
+// Questions counts the respondents of every question that has been answered
+func (s ResultsRepo) Questions(ctx context.Context, surveyID uuid.UUID) ([]QuestionTally, error) {
+	var rows []QuestionTally
+	err := s.responses(ctx, surveyID).
+		ColumnExpr("r.question_id").
+		ColumnExpr(segmentColumns).
+		GroupExpr("r.question_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+	return rows, nil
+}
+
+// Options counts the respondents who picked each option that has been picked
+func (s ResultsRepo) Options(ctx context.Context, surveyID uuid.UUID) ([]OptionTally, error) {
+	var rows []OptionTally
+	err := s.responses(ctx, surveyID).
+		ColumnExpr("r.question_id, r.option_id").
+		ColumnExpr(segmentColumns).
+		Where("r.option_id IS NOT NULL").
+		GroupExpr("r.question_id, r.option_id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+	return rows, nil
+}
+
+// CoOccurrence counts how often each pair of options was picked together on multi-check questions
+func (s ResultsRepo) CoOccurrence(ctx context.Context, surveyID uuid.UUID) ([]OptionPair, error) {
+	var rows []OptionPair
+	err := s.repo.IDB(ctx).NewSelect().
+		TableExpr("user_survey_responses AS a").
+		Join("JOIN user_survey_responses AS b ON b.question_id = a.question_id AND b.user_id = a.user_id AND b.option_id > a.option_id").
+		Join("JOIN survey_questions AS q ON q.id = a.question_id").
+		Join("JOIN users AS u ON u.id = a.user_id AND u.deleted_at IS NULL").
+		ColumnExpr("a.question_id, a.option_id AS option_a, b.option_id AS option_b, count(distinct a.user_id) AS count").
+		Where("q.survey_id = ?", surveyID).
+		Where("q.question_type = ?", domain.MULTICHECK).
+		GroupExpr("a.question_id, a.option_id, b.option_id").
+		OrderExpr("count DESC").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+	return rows, nil
+}
+
+// TextAnswers pages through the non empty answers of users who aren't deleted to the surveys text questions
+func (s ResultsRepo) TextAnswers(ctx context.Context, surveyID uuid.UUID, spec repos.QuerySpec) ([]TextAnswer, int, error) {
+	q := s.repo.IDB(ctx).NewSelect().
+		TableExpr("user_survey_responses AS r").
+		Join("JOIN survey_questions AS q ON q.id = r.question_id").
+		Join("JOIN users AS u ON u.id = r.user_id AND u.deleted_at IS NULL").
+		Join("LEFT JOIN survey_submissions AS ss ON ss.id = r.submission_id").
+		ColumnExpr("r.question_id, r.user_id, r.written_response AS text, ss.updated_at AS submitted_at").
+		Where("q.survey_id = ?", surveyID).
+		Where("q.question_type = ?", domain.TEXT).
+		Where("coalesce(r.written_response, '') <> ''")
+
+	q, err := spec.Apply(q, TextAnswerFields)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if len(spec.Sorts) == 0 {
+		q = q.OrderExpr("ss.updated_at DESC NULLS LAST")
+	}
+
+	rows := make([]TextAnswer, 0)
+	count, err := q.ScanAndCount(ctx, &rows)
+	if err != nil {
+		return nil, 0, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return rows, count, nil
+}
@@ -3,12 +3,30 @@ package surveyrepo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
 
 	"github.com/zrp9/launchl/internal/database/store"
 	"github.com/zrp9/launchl/internal/domain"
 	"github.com/zrp9/launchl/internal/repos"
 )
 
+// SurveyFields are the survey columns admins can filter and sort on
+var SurveyFields = repos.Fields{
+	"name":      {Column: "name", Kind: repos.KindString, Sortable: true},
+	"campaign":  {Column: "campaign", Kind: repos.KindString, Sortable: true},
+	"status":    {Column: "status", Kind: repos.KindString, Sortable: true},
+	"active":    {Column: "active", Kind: repos.KindBool},
+	"parentId":  {Column: "parent_id", Kind: repos.KindUUID},
+	"createdAt": {Column: "created_at", Kind: repos.KindTime, Sortable: true},
+}
+
+var ErrReorderMismatch = errors.New("order must list every id exactly once")
+
 type SurveyRepo struct {
 	repo *repos.BasicRepo[string, domain.Survey]
 }
@@ -23,6 +41,125 @@ func (s SurveyRepo) Get(ctx context.Context, id string) (*domain.Survey, error)
 	return s.repo.Get(ctx, id)
 }
 
+// GetActive loads the active survey of the campaign with its active questions and their options ordered by position
+func (s SurveyRepo) GetActive(ctx context.Context, campaign string) (*domain.Survey, error) {
+	var survey domain.Survey
+	err := s.repo.NewSelect(ctx).Model(&survey).
+		Where("? = ?", bun.Ident("s.campaign"), campaign).
+		Where("? = ?", bun.Ident("s.active"), true).
+		Relation("Questions", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("? = ?", bun.Ident("sq.active"), true).Order("sq.position ASC")
+		}).
+		Relation("Questions.Options", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("sqo.position ASC")
+		}).
+		OrderExpr("s.published_at DESC NULLS LAST, s.id").
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrNoRecords
+		}
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return &survey, nil
+}
+
+// GetWithQuestions loads a survey with every question, active or not, and their options ordered by position
+func (s SurveyRepo) GetWithQuestions(ctx context.Context, id string) (*domain.Survey, error) {
+	var survey domain.Survey
+	err := s.repo.NewSelect(ctx).Model(&survey).
+		Where("? = ?", bun.Ident("s.id"), id).
+		Relation("Questions", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("sq.position ASC")
+		}).
+		Relation("Questions.Options", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("sqo.position ASC")
+		}).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrNoRecords
+		}
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return &survey, nil
+}
+
+// GetDraftOf returns the open draft created from a published survey
+func (s SurveyRepo) GetDraftOf(ctx context.Context, parentID string) (*domain.Survey, error) {
+	var survey domain.Survey
+	err := s.repo.NewSelect(ctx).Model(&survey).
+		Where("? = ?", bun.Ident("parent_id"), parentID).
+		Where("? = ?", bun.Ident("status"), domain.DRAFT).
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrNoRecords
+		}
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+
+	return &survey, nil
+}
+
+// NextVersion is one past the highest version of any survey in the campaign. It locks the campaign until
+// the transaction ends so concurrent creates can't take the same version, call it in the transaction
+// that inserts the survey. Legacy versions that aren't numbers are skipped.
+func (s SurveyRepo) NextVersion(ctx context.Context, campaign string) (int, error) {
+	if _, err := s.repo.IDB(ctx).NewRaw("SELECT pg_advisory_xact_lock(hashtext(?))", "surveys:"+campaign).Exec(ctx); err != nil {
+		return 0, errors.Join(repos.ErrDBRead, err)
+	}
+
+	var next int
+	err := s.repo.NewSelect(ctx).Model((*domain.Survey)(nil)).
+		ColumnExpr("COALESCE(MAX(version::integer), 0) + 1").
+		Where("? = ?", bun.Ident("campaign"), campaign).
+		Where("? ~ '^[0-9]+$'", bun.Ident("version")).
+		Scan(ctx, &next)
+	if err != nil {
+		return 0, errors.Join(repos.ErrDBRead, err)
+	}
+	return next, nil
+}
+
+func (s SurveyRepo) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.Survey, int, error) {
+	return s.repo.Find(ctx, spec, SurveyFields)
+}
+
+// Publish freezes the survey and makes it the only active survey of its campaign
+func (s SurveyRepo) Publish(ctx context.Context, survey *domain.Survey) error {
+	err := s.repo.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := s.repo.IDB(ctx).NewUpdate().Model((*domain.Survey)(nil)).
+			Set("active = false").
+			Set("updated_at = current_timestamp").
+			Where("? = ?", bun.Ident("campaign"), survey.Campaign).
+			Where("? <> ?", bun.Ident("id"), survey.ID).
+			Where("active").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		return s.repo.IDB(ctx).NewUpdate().Model(survey).
+			Set("active = true").
+			Set("status = ?", domain.PUBLISHED).
+			Set("published_at = current_timestamp").
+			Set("updated_at = current_timestamp").
+			Where("? = ?", bun.Ident("id"), survey.ID).
+			Returning("*").
+			Scan(ctx, survey)
+	})
+	if err != nil {
+		return errors.Join(repos.ErrDBWrite, err)
+	}
+
+	return nil
+}
+
 func (s SurveyRepo) GetAll(ctx context.Context) ([]*domain.Survey, error) {
 	return s.repo.GetAll(ctx)
 }
@@ -49,6 +186,33 @@ func NewSurveyQuestionRepo(p store.Persister) QuestionRepo {
 	}
 }
 
+// NextPosition is the position a question appended to the survey gets
+func (s QuestionRepo) NextPosition(ctx context.Context, surveyID uuid.UUID) (int, error) {
+	return nextPosition(ctx, s.repo.NewSelect(ctx).Model((*domain.SurveyQuestion)(nil)).Where("? = ?", bun.Ident("survey_id"), surveyID))
+}
+
+// Save writes every editable column, unlike Update it can set booleans back to false
+func (s QuestionRepo) Save(ctx context.Context, question *domain.SurveyQuestion) error {
+	err := s.repo.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := s.repo.IDB(ctx).NewUpdate().Model(question).
+			Column("prompt", "question_type", "required", "active", "meta_data").
+			Set("updated_at = current_timestamp").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return errors.Join(repos.ErrDBWrite, err)
+	}
+
+	return nil
+}
+
+// Reorder sets the position of each question of the survey to its index in ids
+func (s QuestionRepo) Reorder(ctx context.Context, surveyID uuid.UUID, ids []uuid.UUID) error {
+	return reorder(ctx, s.repo, (*domain.SurveyQuestion)(nil), "survey_id", surveyID, ids)
+}
+
 func (s QuestionRepo) Get(ctx context.Context, id string) (*domain.SurveyQuestion, error) {
 	return s.repo.Get(ctx, id)
 }
@@ -79,6 +243,16 @@ func NewQuestionOptionRepo(p store.Persister) QuestionOptionRepo {
 	}
 }
 
+// NextPosition is the position an option appended to the question gets
+func (s QuestionOptionRepo) NextPosition(ctx context.Context, questionID uuid.UUID) (int, error) {
+	return nextPosition(ctx, s.repo.NewSelect(ctx).Model((*domain.SurveyQuestionOption)(nil)).Where("? = ?", bun.Ident("question_id"), questionID))
+}
+
+// Reorder sets the position of each option of the question to its index in ids
+func (s QuestionOptionRepo) Reorder(ctx context.Context, questionID uuid.UUID, ids []uuid.UUID) error {
+	return reorder(ctx, s.repo, (*domain.SurveyQuestionOption)(nil), "question_id", questionID, ids)
+}
+
 func (s QuestionOptionRepo) Get(ctx context.Context, id string) (*domain.SurveyQuestionOption, error) {
 	return s.repo.Get(ctx, id)
 }
@@ -99,6 +273,16 @@ func (s QuestionOptionRepo) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
 }
 
+// ResponseFields are the survey response columns admins can filter and sort on
+var ResponseFields = repos.Fields{
+	"id":           {Column: "id", Kind: repos.KindUUID},
+	"questionId":   {Column: "question_id", Kind: repos.KindUUID, Sortable: true},
+	"userId":       {Column: "user_id", Kind: repos.KindUUID, Sortable: true},
+	"optionId":     {Column: "option_id", Kind: repos.KindUUID},
+	"submissionId": {Column: "submission_id", Kind: repos.KindUUID},
+	"text":         {Column: "written_response", Kind: repos.KindString},
+}
+
 type ResponseRepo struct {
 	repo *repos.BasicRepo[string, domain.SurveyResponse]
 }
@@ -117,6 +301,10 @@ func (s ResponseRepo) GetAll(ctx context.Context) ([]*domain.SurveyResponse, err
 	return s.repo.GetAll(ctx)
 }
 
+func (s ResponseRepo) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.SurveyResponse, int, error) {
+	return s.repo.Find(ctx, spec, ResponseFields)
+}
+
 func (s ResponseRepo) Create(ctx context.Context, r *domain.SurveyResponse) (*domain.SurveyResponse, error) {
 	return s.repo.Create(ctx, r)
 }
@@ -128,3 +316,155 @@ func (s ResponseRepo) Update(ctx context.Context, r *domain.SurveyResponse) erro
 func (s ResponseRepo) Delete(ctx context.Context, id string) error {
 	return s.repo.Delete(ctx, id)
 }
+
+// FlatFields are the columns flattened response exports can be filtered and sorted on
+var FlatFields = repos.Fields{
+	"surveyId":    {Column: "q.survey_id", Kind: repos.KindUUID},
+	"questionId":  {Column: "r.question_id", Kind: repos.KindUUID},
+	"userId":      {Column: "r.user_id", Kind: repos.KindUUID},
+	"email":       {Column: "u.email", Kind: repos.KindString, Sortable: true},
+	"submittedAt": {Column: "ss.updated_at", Kind: repos.KindTime, Sortable: true},
+}
+
+// FlatResponse is one answer with the user, survey, question and option it refers to inlined
+type FlatResponse struct {
+	ResponseID    uuid.UUID `bun:"response_id"`
+	SubmissionID  uuid.UUID `bun:"submission_id,nullzero"`
+	SubmittedAt   time.Time `bun:"submitted_at,nullzero"`
+	UserID        uuid.UUID `bun:"user_id"`
+	Email         string    `bun:"email"`
+	SurveyID      uuid.UUID `bun:"survey_id"`
+	SurveyName    string    `bun:"survey_name"`
+	SurveyVersion string    `bun:"survey_version"`
+	QuestionID    uuid.UUID `bun:"question_id"`
+	Prompt        string    `bun:"prompt"`
+	QuestionType  string    `bun:"question_type"`
+	OptionID      uuid.UUID `bun:"option_id,nullzero"`
+	OptionLabel   string    `bun:"option_label,nullzero"`
+	OptionValue   string    `bun:"option_value,nullzero"`
+	Text          string    `bun:"text,nullzero"`
+}
+
+// EachFlat streams the responses matching spec to fn as FlatResponses
+func (s ResponseRepo) EachFlat(ctx context.Context, spec repos.QuerySpec, fn func(*FlatResponse) error) error {
+	spec.Limit = 0
+	q := s.repo.IDB(ctx).NewSelect().
+		TableExpr("user_survey_responses AS r").
+		Join("JOIN survey_questions AS q ON q.id = r.question_id").
+		Join("JOIN surveys AS s ON s.id = q.survey_id").
+		Join("JOIN users AS u ON u.id = r.user_id").
+		Join("LEFT JOIN survey_question_options AS o ON o.id = r.option_id").
+		Join("LEFT JOIN survey_submissions AS ss ON ss.id = r.submission_id").
+		ColumnExpr("r.id AS response_id, r.submission_id, ss.updated_at AS submitted_at").
+		ColumnExpr("r.user_id, u.email").
+		ColumnExpr("s.id AS survey_id, s.name AS survey_name, s.version AS survey_version").
+		ColumnExpr("r.question_id, q.prompt, q.question_type").
+		ColumnExpr("r.option_id, o.label AS option_label, o.value AS option_value").
+		ColumnExpr("r.written_response AS text")
+
+	q, err := spec.Apply(q, FlatFields)
+	if err != nil {
+		return err
+	}
+
+	if len(spec.Sorts) == 0 {
+		q = q.OrderExpr("r.user_id, q.position, o.position")
+	}
+
+	return repos.Each(ctx, s.repo.BnDB(), q, fn)
+}
+
+type SubmissionRepo struct {
+	repo *repos.BasicRepo[string, domain.SurveySubmission]
+}
+
+func NewSubmissionRepo(p store.Persister) SubmissionRepo {
+	return SubmissionRepo{
+		repo: repos.New[string, domain.SurveySubmission](p),
+	}
+}
+
+// Replace upserts the submission for its survey and user and swaps any earlier responses for answers.
+// On resubmission sub.ID is overwritten with the id of the existing submission.
+func (s SubmissionRepo) Replace(ctx context.Context, sub *domain.SurveySubmission, answers []domain.SurveyResponse) error {
+	return s.repo.RunInTx(ctx, func(ctx context.Context) error {
+		db := s.repo.IDB(ctx)
+		err := db.NewInsert().Model(sub).
+			On("CONFLICT (survey_id, user_id) DO UPDATE").
+			Set("updated_at = current_timestamp").
+			Returning("id, created_at, updated_at").
+			Scan(ctx)
+		if err != nil {
+			return errors.Join(repos.ErrDBWrite, err)
+		}
+
+		_, err = db.NewDelete().Model((*domain.SurveyResponse)(nil)).
+			Where("? = ?", bun.Ident("submission_id"), sub.ID).
+			Exec(ctx)
+		if err != nil {
+			return errors.Join(repos.ErrDBDelete, err)
+		}
+
+		if len(answers) == 0 {
+			return nil
+		}
+
+		for i := range answers {
+			answers[i].ID = uuid.New()
+			answers[i].SubmissionID = sub.ID
+			answers[i].UserID = sub.UserID
+		}
+
+		if _, err := db.NewInsert().Model(&answers).Exec(ctx); err != nil {
+			return errors.Join(repos.ErrDBWrite, err)
+		}
+
+		sub.Responses = answers
+		return nil
+	})
+}
+
+func nextPosition(ctx context.Context, q *bun.SelectQuery) (int, error) {
+	var next int
+	if err := q.ColumnExpr("COALESCE(MAX(position) + 1, 0)").Scan(ctx, &next); err != nil {
+		return 0, errors.Join(repos.ErrDBRead, err)
+	}
+	return next, nil
+}
+
+// reorder requires ids to be exactly the rows owned by parentID so a stale client can't drop or duplicate positions
+func reorder[M any](ctx context.Context, repo *repos.BasicRepo[string, M], model *M, parentCol string, parentID uuid.UUID, ids []uuid.UUID) error {
+	return repo.RunInTx(ctx, func(ctx context.Context) error {
+		var existing []uuid.UUID
+		err := repo.NewSelect(ctx).Model(model).Column("id").Where("? = ?", bun.Ident(parentCol), parentID).Scan(ctx, &existing)
+		if err != nil {
+			return errors.Join(repos.ErrDBRead, err)
+		}
+
+		owned := make(map[uuid.UUID]bool, len(existing))
+		for _, id := range existing {
+			owned[id] = true
+		}
+
+		if len(ids) != len(owned) {
+			return ErrReorderMismatch
+		}
+
+		for pos, id := range ids {
+			if !owned[id] {
+				return ErrReorderMismatch
+			}
+			delete(owned, id)
+
+			_, err := repo.IDB(ctx).NewUpdate().Model(model).
+				Set("position = ?", pos).
+				Where("? = ?", bun.Ident("id"), id).
+				Exec(ctx)
+			if err != nil {
+				return errors.Join(repos.ErrDBWrite, err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package userrepo
+
+import (
+	"bufio"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+var (
+	createUsers = regexp.MustCompile(`(?i)^create table (if not exists )?users\s*\(`)
+	alterUsers  = regexp.MustCompile(`(?i)^alter table users (add column (if not exists )?(\w+)|alter column (\w+) (set|drop) not null)`)
+	setNull     = regexp.MustCompile(`(?i)"?(\w+)"? = NULL`)
+)
+
+// notNullColumns reads the users columns the migrations declare not null
+func notNullColumns(t *testing.T) map[string]bool {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.up.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	sort.Strings(files)
+
+	cols := map[string]bool{}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		inUsers := false
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			lower := strings.ToLower(line)
+			switch {
+			case createUsers.MatchString(line):
+				inUsers = true
+			case inUsers && strings.HasPrefix(line, ")"):
+				inUsers = false
+			case inUsers:
+				if col, _, ok := strings.Cut(line, " "); ok {
+					cols[strings.ToLower(col)] = strings.Contains(lower, "not null") || strings.Contains(lower, "primary key")
+				}
+			default:
+				m := alterUsers.FindStringSubmatch(line)
+				switch {
+				case m == nil:
+				case m[3] != "":
+					cols[strings.ToLower(m[3])] = strings.Contains(lower, "not null")
+				default:
+					cols[strings.ToLower(m[4])] = strings.EqualFold(m[5], "set")
+				}
+			}
+		}
+		f.Close() //nolint:errcheck
+		if err := sc.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cols
+}
+
+func TestAnonymizeKeepsNotNullColumns(t *testing.T) {
+	cols := notNullColumns(t)
+	if !cols["company_name"] || !cols["email"] {
+		t.Fatalf("schema parse missed users columns: %v", cols)
+	}
+
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN("postgres://test@localhost/test"))), pgdialect.New())
+	t.Cleanup(func() { db.Close() }) //nolint:errcheck
+
+	query := anonymizeQuery(db, time.Now()).String()
+	for _, m := range setNull.FindAllStringSubmatch(query, -1) {
+		if cols[strings.ToLower(m[1])] {
+			t.Errorf("anonymize sets not null column %s to NULL: %s", m[1], query)
+		}
+	}
+}
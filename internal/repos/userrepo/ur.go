@@ -2,12 +2,16 @@
 package userrepo
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/zrp9/launchl/internal/database/store"
 	"github.com/zrp9/launchl/internal/domain"
 	"github.com/zrp9/launchl/internal/repos"
@@ -16,6 +20,23 @@ import (
 // NOTE: i should be able to overrite a method like get if i specify it here
 // maybe i should so i can use uuid to do lookups
 
+// Fields are the user columns admins can filter and sort on
+var Fields = repos.Fields{
+	"id":          {Column: "id", Kind: repos.KindUUID},
+	"email":       {Column: "email", Kind: repos.KindString, Sortable: true},
+	"username":    {Column: "username", Kind: repos.KindString, Sortable: true},
+	"firstName":   {Column: "first_name", Kind: repos.KindString, Sortable: true},
+	"lastName":    {Column: "last_name", Kind: repos.KindString, Sortable: true},
+	"companyName": {Column: "company_name", Kind: repos.KindString, Sortable: true},
+	"roleId":      {Column: "role_id", Kind: repos.KindUUID},
+	"wouldUse":    {Column: "would_use", Kind: repos.KindBool, Sortable: true},
+	"quePosition": {Column: "que_position", Kind: repos.KindNumber, Sortable: true},
+	"createdAt":   {Column: "created_at", Kind: repos.KindTime, Sortable: true},
+	"updatedAt":   {Column: "updated_at", Kind: repos.KindTime, Sortable: true},
+	"verifiedAt":  {Column: "verified_at", Kind: repos.KindTime, Sortable: true},
+	"invitedAt":   {Column: "invited_at", Kind: repos.KindTime, Sortable: true},
+}
+
 type UserRepo struct {
 	repo *repos.BasicRepo[string, domain.User]
 }
@@ -28,7 +49,7 @@ func New(p store.Persister) UserRepo {
 
 func (u UserRepo) Get(ctx context.Context, uid string) (*domain.User, error) {
 	var usr domain.User
-	err := u.repo.BnDB().NewSelect().Model(&usr).Where("? = ?", bun.Ident("id"), uid).Scan(ctx)
+	err := u.repo.NewSelect(ctx).Model(&usr).Where("? = ?", bun.Ident("id"), uid).Scan(ctx)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, repos.ErrNoRecords
@@ -41,7 +62,7 @@ func (u UserRepo) Get(ctx context.Context, uid string) (*domain.User, error) {
 
 func (u UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
 	var usr domain.User
-	err := u.repo.BnDB().NewSelect().Model(&usr).Where("? = ?", bun.Ident("email"), email).Scan(ctx)
+	err := u.repo.NewSelect(ctx).Model(&usr).Where("? = ?", bun.Ident("email"), email).Scan(ctx)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -52,9 +73,31 @@ func (u UserRepo) GetByEmail(ctx context.Context, email string) (*domain.User, e
 	return &usr, nil
 }
 
+// ExistingEmails returns which of the normalized emails already belong to a subscriber
+func (u UserRepo) ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(emails))
+	if len(emails) == 0 {
+		return found, nil
+	}
+
+	var existing []string
+	err := u.repo.NewSelect(ctx).Model((*domain.User)(nil)).
+		ColumnExpr("lower(email)").
+		Where("lower(email) IN (?)", bun.In(emails)).
+		Scan(ctx, &existing)
+	if err != nil {
+		return nil, errors.Join(repos.ErrDBRead, err)
+	}
+
+	for _, e := range existing {
+		found[e] = true
+	}
+	return found, nil
+}
+
 func (u UserRepo) GetByUsername(ctx context.Context, username string) (*domain.User, error) {
 	var usr domain.User
-	err := u.repo.BnDB().NewSelect().Model(&usr).Where("? = ?", bun.Ident("username"), username).Scan(ctx)
+	err := u.repo.NewSelect(ctx).Model(&usr).Where("? = ?", bun.Ident("username"), username).Scan(ctx)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -86,39 +129,188 @@ func (u UserRepo) GetPaginated(ctx context.Context, pg, limit int) ([]*domain.Us
 	return users, nil
 }
 
+func (u UserRepo) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.User, int, error) {
+	return u.repo.Find(ctx, spec, Fields)
+}
+
+// Each streams the users matching spec to fn
+func (u UserRepo) Each(ctx context.Context, spec repos.QuerySpec, fn func(*domain.User) error) error {
+	return u.repo.Each(ctx, spec, Fields, fn)
+}
+
 func (u UserRepo) Create(ctx context.Context, user *domain.User) (*domain.User, error) {
-	var usr = user
-	tx, err := u.repo.BnDB().BeginTx(ctx, &sql.TxOptions{})
+	return u.insert(ctx, user, time.Time{})
+}
+
+// Import inserts a user with the signup time they had in the tool they were imported from
+func (u UserRepo) Import(ctx context.Context, user *domain.User, signedUp time.Time) (*domain.User, error) {
+	return u.insert(ctx, user, signedUp)
+}
+
+func (u UserRepo) insert(ctx context.Context, user *domain.User, signedUp time.Time) (*domain.User, error) {
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		q := u.repo.IDB(ctx).NewInsert().Model(user)
+		if !signedUp.IsZero() {
+			q = q.Value("created_at", "?", signedUp)
+		}
+		return q.Returning("*").Scan(ctx, user)
+	})
 	if err != nil {
-		return nil, errors.Join(repos.ErrFailedTransaction, err)
+		return nil, repos.WriteErr(err)
 	}
 
-	err = tx.NewInsert().Model(&usr).Returning("*").Scan(ctx, &usr)
+	return user, nil
+}
+
+// Place picks the que position of a user who signed up at signedUp. They take the place of the first
+// user that signed up after them and everyone from there moves back one, so imported users keep their
+// place by their original signup time and new signups join the back of the line. Positions stay locked
+// until the transaction ends, call it in the transaction that inserts the user.
+func (u UserRepo) Place(ctx context.Context, signedUp time.Time) (int64, error) {
+	positions, err := u.PlaceAll(ctx, []time.Time{signedUp})
 	if err != nil {
-		if txErr := tx.Rollback(); txErr != nil {
-			return nil, errors.Join(repos.ErrFailedTransaction, err)
-		}
-		return nil, err
+		return 0, err
 	}
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	return positions[0], nil
+}
+
+// firstAfter finds, for each signup time, the smallest position held by a user who signed up later.
+// Users and signups are walked latest first in one sort with a running minimum, a signup sorts ahead
+// of users with the same time so they don't count as later.
+const firstAfter = `WITH batch AS (
+	SELECT at, ord FROM unnest(?::timestamptz[]) WITH ORDINALITY AS b(at, ord)
+), line AS (
+	SELECT ord, MIN(pos) OVER (ORDER BY at DESC, ord IS NULL ROWS UNBOUNDED PRECEDING) AS after
+	FROM (
+		SELECT created_at AS at, que_position AS pos, NULL::bigint AS ord FROM users
+		WHERE created_at > (SELECT MIN(at) FROM batch)
+		UNION ALL
+		SELECT at, NULL, ord FROM batch
+	) AS events
+)
+SELECT after FROM line WHERE ord IS NOT NULL ORDER BY ord`
+
+// PlaceAll is Place for many users at once, the positions come back in the order of signedUp. Each
+// user lands where Place would put them one at a time from earliest to latest signup, but the users
+// behind them are moved back in a single update. Their versions are left alone, Update never writes
+// the position so a shift can't conflict with an edit.
+func (u UserRepo) PlaceAll(ctx context.Context, signedUp []time.Time) ([]int64, error) {
+	if len(signedUp) == 0 {
+		return nil, nil
 	}
 
-	return usr, nil
+	positions := make([]int64, len(signedUp))
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		db := u.repo.IDB(ctx)
+		if err := lockQue(ctx, db); err != nil {
+			return err
+		}
+
+		var last int64
+		err := db.NewSelect().Model((*domain.User)(nil)).WhereAllWithDeleted().
+			ColumnExpr("COALESCE(MAX(que_position), 0)").
+			Scan(ctx, &last)
+		if err != nil {
+			return err
+		}
+
+		after := make([]sql.NullInt64, 0, len(signedUp))
+		if err := db.NewRaw(firstAfter, pgdialect.Array(signedUp)).Scan(ctx, &after); err != nil {
+			return err
+		}
+		if len(after) != len(signedUp) {
+			return fmt.Errorf("placed %d of %d users", len(after), len(signedUp))
+		}
+
+		starts := placeOrder(signedUp, after, last, positions)
+		_, err = db.NewUpdate().Model((*domain.User)(nil)).WhereAllWithDeleted().
+			Set("que_position = que_position + width_bucket(que_position, ?::bigint[])", pgdialect.Array(starts)).
+			Where("? >= ?", bun.Ident("que_position"), starts[0]).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Join(repos.ErrDBWrite, err)
+	}
+
+	return positions, nil
 }
 
-func (u UserRepo) Update(ctx context.Context, usr domain.User) (*domain.User, error) {
-	var user domain.User
-	tx, err := u.repo.BnDB().BeginTx(ctx, &sql.TxOptions{})
+// placeOrder fills positions for users placed in front of the first later user in after, or at the
+// back of a line of last users when nobody signed up later. Users placed at the same spot line up
+// by signup time. It returns the spots in ascending order, a user already in line moves back one for
+// every spot at or before theirs, which is what width_bucket counts.
+func placeOrder(signedUp []time.Time, after []sql.NullInt64, last int64, positions []int64) []int64 {
+	order := make([]int, len(signedUp))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return signedUp[a].Compare(signedUp[b])
+	})
+
+	starts := make([]int64, 0, len(order))
+	for rank, i := range order {
+		start := last + 1
+		if after[i].Valid {
+			start = after[i].Int64
+		}
+		positions[i] = start + int64(rank)
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// Unplace gives back positions PlaceAll reserved for users that were never inserted, everyone behind
+// them moves forward so the line has no gaps
+func (u UserRepo) Unplace(ctx context.Context, positions []int64) error {
+	if len(positions) == 0 {
+		return nil
+	}
+
+	gaps := slices.Sorted(slices.Values(positions))
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := u.repo.IDB(ctx).NewUpdate().Model((*domain.User)(nil)).WhereAllWithDeleted().
+			Set("que_position = que_position - width_bucket(que_position, ?::bigint[])", pgdialect.Array(gaps)).
+			Where("? > ?", bun.Ident("que_position"), gaps[0]).
+			Exec(ctx)
+		return err
+	})
 	if err != nil {
-		return nil, errors.Join(repos.ErrFailedTransaction, err)
+		return errors.Join(repos.ErrDBWrite, err)
 	}
 
-	err = tx.NewUpdate().Model(&user).Where("? = ?", bun.Ident("id"), usr.ID).Scan(ctx, &user)
+	return nil
+}
+
+// Update writes every column of usr if the row is still at usr.Version,
+// otherwise it returns a repos.ConflictErr and the caller should re-read and retry.
+// The que position isn't written, it only changes through the Place, Unplace, Promote and MoveTo methods.
+func (u UserRepo) Update(ctx context.Context, usr domain.User) (*domain.User, error) {
+	user := usr
+	user.Version = usr.Version + 1
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		err := u.repo.IDB(ctx).NewUpdate().Model(&user).ExcludeColumn("created_at", "que_position").
+			Where("? = ?", bun.Ident("id"), usr.ID).
+			Where("? = ?", bun.Ident("version"), usr.Version).
+			Returning("*").Scan(ctx, &user)
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		exists, existsErr := u.repo.NewSelect(ctx).Model((*domain.User)(nil)).Where("? = ?", bun.Ident("id"), usr.ID).Exists(ctx)
+		if existsErr != nil {
+			return existsErr
+		}
+		if exists {
+			return repos.ConflictErr{ID: usr.ID, Version: usr.Version}
+		}
+		return repos.ErrNoRecords
+	})
 	if err != nil {
-		if txErr := tx.Rollback(); txErr != nil {
-			return nil, errors.Join(repos.ErrFailedRollback, err)
+		if errors.Is(err, repos.ErrConflict) || errors.Is(err, repos.ErrNoRecords) {
+			return nil, err
 		}
 		return nil, errors.Join(repos.ErrDBWrite, err)
 	}
@@ -126,55 +318,204 @@ func (u UserRepo) Update(ctx context.Context, usr domain.User) (*domain.User, er
 	return &user, nil
 }
 
-func (u UserRepo) Delete(ctx context.Context, id string) error {
-	var usr domain.User
-	tx, err := u.repo.BnDB().BeginTx(ctx, &sql.TxOptions{})
+// InviteNext marks the first size users in line that haven't been invited yet as invited and returns
+// them in que order. Rows another wave is inviting are skipped so concurrent waves never overlap.
+func (u UserRepo) InviteNext(ctx context.Context, size int) ([]*domain.User, error) {
+	var invited []*domain.User
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		db := u.repo.IDB(ctx)
+		next := db.NewSelect().Model((*domain.User)(nil)).Column("id").
+			Where("? IS NULL", bun.Ident("invited_at")).
+			OrderExpr("? ASC", bun.Ident("que_position")).
+			Limit(size).
+			For("UPDATE SKIP LOCKED")
+
+		return db.NewUpdate().Model(&invited).
+			Set("invited_at = current_timestamp").
+			Where("? IN (?)", bun.Ident("id"), next).
+			Returning("*").Scan(ctx, &invited)
+	})
 	if err != nil {
-		return errors.Join(repos.ErrFailedTransaction, err)
+		return nil, errors.Join(repos.ErrDBWrite, err)
 	}
 
-	if _, err = tx.NewDelete().Model(&usr).Where("? = ?", bun.Ident("id"), id).Exec(ctx); err != nil {
-		return errors.Join(repos.ErrDBDelete, err)
-	}
+	slices.SortFunc(invited, func(a, b *domain.User) int {
+		return cmp.Compare(a.QuePosition, b.QuePosition)
+	})
+	return invited, nil
+}
 
-	return nil
+// lockQue holds the que positions until the transaction ends so concurrent moves can't share a position
+func lockQue(ctx context.Context, db bun.IDB) error {
+	_, err := db.NewRaw("SELECT pg_advisory_xact_lock(hashtext(?))", "users:que_position").Exec(ctx)
+	return err
 }
 
-func (u UserRepo) DeleteByEmail(ctx context.Context, email string) error {
+// Promote moves the user delta places toward the front of the line, a negative delta moves them back.
+// Position 1 is the front. The users they pass each move one place the other way so no two users share
+// a position, and the move stops at the front or back of the line.
+func (u UserRepo) Promote(ctx context.Context, id string, delta int64) (*domain.User, error) {
+	return u.move(ctx, id, func(pos, last int64) int64 {
+		return promoted(pos, delta, last)
+	})
+}
+
+// MoveTo puts the user at pos and shifts the users between their old and new place by one
+func (u UserRepo) MoveTo(ctx context.Context, id string, pos int64) (*domain.User, error) {
+	return u.move(ctx, id, func(_, last int64) int64 {
+		return clampPosition(pos, last)
+	})
+}
+
+func (u UserRepo) move(ctx context.Context, id string, target func(pos, last int64) int64) (*domain.User, error) {
 	var usr domain.User
-	tx, err := u.repo.BnDB().BeginTx(ctx, &sql.TxOptions{})
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		db := u.repo.IDB(ctx)
+		if err := lockQue(ctx, db); err != nil {
+			return err
+		}
+
+		if err := db.NewSelect().Model(&usr).Where("? = ?", bun.Ident("id"), id).Scan(ctx, &usr); err != nil {
+			return err
+		}
+
+		var last int64
+		err := db.NewSelect().Model((*domain.User)(nil)).WhereAllWithDeleted().
+			ColumnExpr("COALESCE(MAX(que_position), 0)").
+			Scan(ctx, &last)
+		if err != nil {
+			return err
+		}
+
+		from := usr.QuePosition
+		to := target(from, last)
+		if to == from {
+			return nil
+		}
+
+		shift := db.NewUpdate().Model((*domain.User)(nil)).WhereAllWithDeleted()
+		if to < from {
+			shift = shift.Set("que_position = que_position + 1").
+				Where("? >= ?", bun.Ident("que_position"), to).
+				Where("? < ?", bun.Ident("que_position"), from)
+		} else {
+			shift = shift.Set("que_position = que_position - 1").
+				Where("? > ?", bun.Ident("que_position"), from).
+				Where("? <= ?", bun.Ident("que_position"), to)
+		}
+		if _, err := shift.Exec(ctx); err != nil {
+			return err
+		}
+
+		return db.NewUpdate().Model(&usr).
+			Set("que_position = ?", to).
+			Where("? = ?", bun.Ident("id"), id).
+			Returning("*").Scan(ctx, &usr)
+	})
 	if err != nil {
-		return errors.Join(repos.ErrFailedTransaction, err)
+		if err == sql.ErrNoRows {
+			return nil, repos.ErrNoRecords
+		}
+		return nil, errors.Join(repos.ErrDBWrite, err)
 	}
 
-	if _, err := tx.NewDelete().Model(&usr).Where("? = ?", bun.Ident("email"), email).Exec(ctx); err != nil {
-		return errors.Join(repos.ErrDBDelete, err)
+	return &usr, nil
+}
+
+// promoted is where a user at pos lands after moving delta places toward the front of a line of last users
+func promoted(pos, delta, last int64) int64 {
+	return clampPosition(pos-delta, last)
+}
+
+func clampPosition(pos, last int64) int64 {
+	if pos > last {
+		pos = last
 	}
-	return nil
+	if pos < 1 {
+		pos = 1
+	}
+	return pos
+}
+
+func (u UserRepo) Delete(ctx context.Context, id string) error {
+	return u.deleteBy(ctx, "id", id)
+}
+
+func (u UserRepo) DeleteByEmail(ctx context.Context, email string) error {
+	return u.deleteBy(ctx, "email", email)
 }
 
 func (u UserRepo) DeleteByUsername(ctx context.Context, usrname string) error {
-	var usr domain.User
-	tx, err := u.repo.BnDB().BeginTx(ctx, &sql.TxOptions{})
+	return u.deleteBy(ctx, "username", usrname)
+}
+
+func (u UserRepo) deleteBy(ctx context.Context, col, val string) error {
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := u.repo.IDB(ctx).NewDelete().Model((*domain.User)(nil)).Where("? = ?", bun.Ident(col), val).Exec(ctx)
+		return err
+	})
 	if err != nil {
-		return errors.Join(repos.ErrFailedTransaction, err)
+		return errors.Join(repos.ErrDBDelete, err)
 	}
 
-	if _, err := tx.NewDelete().Model(&usr).Where("? = ?", bun.Ident("username"), usrname).Exec(ctx); err != nil {
+	return nil
+}
+
+func (u UserRepo) HardDeleteByUsername(ctx context.Context, usrname string) error {
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		_, err := u.repo.IDB(ctx).NewDelete().Model((*domain.User)(nil)).Where("? = ?", bun.Ident("username"), usrname).ForceDelete().Exec(ctx)
+		return err
+	})
+	if err != nil {
 		return errors.Join(repos.ErrDBDelete, err)
 	}
+
 	return nil
 }
 
-func (u UserRepo) GetQuePosition(ctx context.Context, usrname string) (int64, error) {
-	var usr domain.User
-	tx, err := u.repo.BnDB().BeginTx(ctx, &sql.TxOptions{})
+// AnonymizeDeleted scrubs the pii of users soft deleted before cutoff. The rows are kept
+// so referal counts and rewards that depend on them are unchanged.
+func (u UserRepo) AnonymizeDeleted(ctx context.Context, cutoff time.Time) (int64, error) {
+	var affected int64
+	err := u.repo.RunInTx(ctx, func(ctx context.Context) error {
+		res, err := anonymizeQuery(u.repo.IDB(ctx), cutoff).Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		affected, err = res.RowsAffected()
+		return err
+	})
 	if err != nil {
-		return -1, errors.Join(repos.ErrFailedTransaction, err)
+		return 0, errors.Join(repos.ErrDBWrite, err)
 	}
 
-	err = tx.NewSelect().Model(&usr).Where("? = ?", bun.Ident("username"), usrname).Scan(ctx, &usr)
+	return affected, nil
+}
+
+// anonymizeQuery blanks rather than nulls the columns the schema declares not null
+func anonymizeQuery(db bun.IDB, cutoff time.Time) *bun.UpdateQuery {
+	return db.NewUpdate().Model((*domain.User)(nil)).
+		Set("email = 'deleted-' || ? || '@anonymized.invalid'", bun.Ident("id")).
+		Set("username = 'deleted-' || ?", bun.Ident("id")).
+		Set("phone = ''").
+		Set("first_name = ''").
+		Set("last_name = ''").
+		Set("comments = NULL").
+		Set("company_name = ''").
+		Set("anonymized_at = current_timestamp").
+		WhereDeleted().
+		Where("? < ?", bun.Ident("deleted_at"), cutoff).
+		Where("? IS NULL", bun.Ident("anonymized_at"))
+}
+
+func (u UserRepo) GetQuePosition(ctx context.Context, usrname string) (int64, error) {
+	var usr domain.User
+	err := u.repo.NewSelect(ctx).Model(&usr).Where("? = ?", bun.Ident("username"), usrname).Scan(ctx, &usr)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return -1, repos.ErrNoRecords
+		}
 		return -1, errors.Join(repos.ErrDBRead, err)
 	}
 
@@ -183,7 +524,7 @@ func (u UserRepo) GetQuePosition(ctx context.Context, usrname string) (int64, er
 
 func (u UserRepo) GetByRefererID(ctx context.Context, refID string) (domain.User, error) {
 	var usr domain.User
-	err := u.repo.BnDB().NewSelect().Model(&usr).Where("? = ?", bun.Ident("referer_id"), refID).Scan(ctx, &usr)
+	err := u.repo.NewSelect(ctx).Model(&usr).Where("? = ?", bun.Ident("referer_id"), refID).Scan(ctx, &usr)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.User{}, fmt.Errorf("could not find user %v", refID)
@@ -196,7 +537,7 @@ func (u UserRepo) GetByRefererID(ctx context.Context, refID string) (domain.User
 
 func (u UserRepo) GetReferer(ctx context.Context, usrname, refID string) (domain.User, error) {
 	var usr domain.User
-	err := u.repo.BnDB().NewSelect().Model(&usr).Where("? = ?", bun.Ident("referer_id"), refID).Where("? = ?", bun.Ident("username"), usrname).Scan(ctx, &usr)
+	err := u.repo.NewSelect(ctx).Model(&usr).Where("? = ?", bun.Ident("referer_id"), refID).Where("? = ?", bun.Ident("username"), usrname).Scan(ctx, &usr)
 	if err != nil {
 		return domain.User{}, err
 	}
@@ -206,7 +547,7 @@ func (u UserRepo) GetReferer(ctx context.Context, usrname, refID string) (domain
 
 func (u UserRepo) FetchByUsername(ctx context.Context, usrname string) (domain.User, error) {
 	var usr domain.User
-	err := u.repo.BnDB().NewSelect().Model(&domain.User{}).Where("? = ?", bun.Ident("username"), usrname).Scan(ctx, &usr)
+	err := u.repo.NewSelect(ctx).Model(&domain.User{}).Where("? = ?", bun.Ident("username"), usrname).Scan(ctx, &usr)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return domain.User{}, fmt.Errorf("could not find user %w", err)
@@ -0,0 +1,131 @@
+package userrepo
+
+import (
+	"cmp"
+	"database/sql"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPromoted(t *testing.T) {
+	tests := []struct {
+		name  string
+		pos   int64
+		delta int64
+		last  int64
+		want  int64
+	}{
+		{name: "boost moves toward the front", pos: 10, delta: 3, last: 20, want: 7},
+		{name: "stops at the front", pos: 2, delta: 5, last: 20, want: 1},
+		{name: "revoke moves back", pos: 7, delta: -3, last: 20, want: 10},
+		{name: "stops at the back", pos: 19, delta: -5, last: 20, want: 20},
+		{name: "no delta", pos: 4, delta: 0, last: 20, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promoted(tt.pos, tt.delta, tt.last); got != tt.want {
+				t.Errorf("promoted(%d, %d, %d) = %d, want %d", tt.pos, tt.delta, tt.last, got, tt.want)
+			}
+		})
+	}
+}
+
+// queued is a user already in line
+type queued struct {
+	signedUp time.Time
+	pos      int64
+}
+
+// placeOneByOne is what Place does for each signup in turn, the reference PlaceAll has to match
+func placeOneByOne(line []queued, signedUp []time.Time) ([]queued, []int64) {
+	line = slices.Clone(line)
+	order := make([]int, len(signedUp))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return signedUp[a].Compare(signedUp[b]) })
+
+	positions := make([]int64, len(signedUp))
+	for _, i := range order {
+		var last, first int64
+		for _, q := range line {
+			last = max(last, q.pos)
+			if q.signedUp.After(signedUp[i]) && (first == 0 || q.pos < first) {
+				first = q.pos
+			}
+		}
+		if first == 0 {
+			first = last + 1
+		}
+		for j := range line {
+			if line[j].pos >= first {
+				line[j].pos++
+			}
+		}
+		positions[i] = first
+		line = append(line, queued{signedUp: signedUp[i], pos: first})
+	}
+	return line, positions
+}
+
+// placeTogether is PlaceAll, firstAfter and the width_bucket shift done in memory
+func placeTogether(line []queued, signedUp []time.Time) ([]queued, []int64) {
+	line = slices.Clone(line)
+	var last int64
+	after := make([]sql.NullInt64, len(signedUp))
+	for _, q := range line {
+		last = max(last, q.pos)
+	}
+	for i, t := range signedUp {
+		for _, q := range line {
+			if q.signedUp.After(t) && (!after[i].Valid || q.pos < after[i].Int64) {
+				after[i] = sql.NullInt64{Int64: q.pos, Valid: true}
+			}
+		}
+	}
+
+	positions := make([]int64, len(signedUp))
+	starts := placeOrder(signedUp, after, last, positions)
+	for j := range line {
+		bucket, _ := slices.BinarySearch(starts, line[j].pos+1)
+		line[j].pos += int64(bucket)
+	}
+	for i, t := range signedUp {
+		line = append(line, queued{signedUp: t, pos: positions[i]})
+	}
+	return line, positions
+}
+
+func TestPlaceAllMatchesPlace(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+	// boosts mean the line isn't sorted by signup time
+	line := []queued{{day(2), 3}, {day(4), 1}, {day(6), 2}, {day(8), 5}, {day(10), 4}}
+
+	tests := []struct {
+		name     string
+		signedUp []time.Time
+	}{
+		{name: "before everyone", signedUp: []time.Time{day(1)}},
+		{name: "after everyone", signedUp: []time.Time{day(20), day(21)}},
+		{name: "mixed and unsorted", signedUp: []time.Time{day(9), day(1), day(5), day(30), day(5)}},
+		{name: "same time as a user", signedUp: []time.Time{day(4), day(8)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantLine, wantPos := placeOneByOne(line, tt.signedUp)
+			gotLine, gotPos := placeTogether(line, tt.signedUp)
+			if !slices.Equal(gotPos, wantPos) {
+				t.Errorf("positions = %v, want %v", gotPos, wantPos)
+			}
+			byPos := func(a, b queued) int { return cmp.Compare(a.pos, b.pos) }
+			slices.SortFunc(gotLine, byPos)
+			slices.SortFunc(wantLine, byPos)
+			if !slices.Equal(gotLine, wantLine) {
+				t.Errorf("line = %v, want %v", gotLine, wantLine)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package request
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id of the request ctx belongs to or an empty string outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// maxRequestIDLen matches the audit logs request id column
+const maxRequestIDLen = 128
+
+// NewRequestID is used when the caller didn't send an id of its own
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// ValidRequestID accepts ids a proxy or client would generate and rejects anything that could
+// smuggle junk into logs or headers
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package request
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the ip the request was resolved to come from or an empty string outside of a request
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// TrustedProxies works out the client ip of requests that came through proxies it trusts
+type TrustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// ParseTrustedProxies takes ips and cidrs like 10.0.0.1 or 10.0.0.0/8
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, entry := range list {
+		if strings.Contains(entry, "/") {
+			p, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return TrustedProxies{}, fmt.Errorf("trusted proxy %q is not a valid cidr %w", entry, err)
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return TrustedProxies{}, fmt.Errorf("trusted proxy %q is not a valid ip %w", entry, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return TrustedProxies{prefixes: prefixes}, nil
+}
+
+func (t TrustedProxies) trusted(addr netip.Addr) bool {
+	for _, p := range t.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the peer address unless the peer is a trusted proxy. Then X-Forwarded-For is read from
+// the right, skipping trusted proxies, and the first address that isn't one is the client. Entries
+// further left were written by the client itself and can't be believed.
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	peer := parseIP(r.RemoteAddr)
+	if !peer.IsValid() {
+		return r.RemoteAddr
+	}
+	if !t.trusted(peer) {
+		return peer.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseIP(strings.TrimSpace(hops[i]))
+		if !hop.IsValid() {
+			break
+		}
+		client = hop
+		if !t.trusted(hop) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// parseIP accepts a bare ip or host:port
+func parseIP(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
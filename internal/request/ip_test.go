@@ -0,0 +1,69 @@
+package request
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.7:4000", want: "203.0.113.7"},
+		{name: "spoofed header from an untrusted peer", remote: "203.0.113.7:4000", xff: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{name: "one trusted proxy", remote: "10.0.0.5:80", xff: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "trusted proxy without a header", remote: "10.0.0.5:80", want: "10.0.0.5"},
+		{name: "multi hop chain of trusted proxies", remote: "10.0.0.5:80", xff: []string{"203.0.113.7, 192.168.1.1, 10.1.2.3"}, want: "203.0.113.7"},
+		{name: "client forged entries left of the real one", remote: "10.0.0.5:80", xff: []string{"198.51.100.1, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "client forged a trusted address", remote: "10.0.0.5:80", xff: []string{"10.9.9.9, 203.0.113.7"}, want: "203.0.113.7"},
+		{name: "untrusted hop in the middle stops the walk", remote: "10.0.0.5:80", xff: []string{"198.51.100.1, 203.0.113.7, 10.1.2.3"}, want: "203.0.113.7"},
+		{name: "headers split over several lines", remote: "10.0.0.5:80", xff: []string{"203.0.113.7", "10.1.2.3"}, want: "203.0.113.7"},
+		{name: "garbage hop stops at the last good one", remote: "10.0.0.5:80", xff: []string{"203.0.113.7, not-an-ip, 10.1.2.3"}, want: "10.1.2.3"},
+		{name: "every hop trusted", remote: "10.0.0.5:80", xff: []string{"10.1.2.3, 192.168.1.1"}, want: "10.1.2.3"},
+		{name: "ipv4 mapped ipv6 peer", remote: "[::ffff:10.0.0.5]:80", xff: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "ipv6 client", remote: "10.0.0.5:80", xff: []string{"2001:db8::1"}, want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := proxies.ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    []string
+		wantErr bool
+	}{
+		{name: "ips and cidrs", list: []string{"10.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"}},
+		{name: "bad ip", list: []string{"10.0.0"}, wantErr: true},
+		{name: "bad cidr", list: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTrustedProxies(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
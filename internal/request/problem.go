@@ -0,0 +1,173 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// internalDetail replaces the message of server errors so database and driver errors never reach clients
+const internalDetail = "an unexpected error occurred, quote the request id when reporting it"
+
+// Kind is the category of a problem, clients can switch on it instead of parsing messages
+type Kind string
+
+const (
+	KindValidation   Kind = "validation"
+	KindBadRequest   Kind = "bad_request"
+	KindUnauthorized Kind = "unauthorized"
+	KindForbidden    Kind = "forbidden"
+	KindNotFound     Kind = "not_found"
+	KindConflict     Kind = "conflict"
+	KindRateLimited  Kind = "rate_limited"
+	KindInternal     Kind = "internal"
+)
+
+// KindOf picks the kind for a response status
+func KindOf(status int) Kind {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+		return KindValidation
+	case http.StatusUnauthorized:
+		return KindUnauthorized
+	case http.StatusForbidden:
+		return KindForbidden
+	case http.StatusNotFound:
+		return KindNotFound
+	case http.StatusConflict:
+		return KindConflict
+	case http.StatusTooManyRequests:
+		return KindRateLimited
+	}
+	if status >= http.StatusInternalServerError {
+		return KindInternal
+	}
+	return KindBadRequest
+}
+
+// FieldErr points at one invalid part of a request
+type FieldErr struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// FieldErrorer is implemented by errors that know which parts of the request were wrong
+type FieldErrorer interface {
+	FieldErrors() []FieldErr
+}
+
+// Problem is an RFC 7807 problem details body. Extensions are written as extra top level members.
+type Problem struct {
+	Type       string     `json:"type"`
+	Title      string     `json:"title"`
+	Status     int        `json:"status"`
+	Detail     string     `json:"detail,omitempty"`
+	Instance   string     `json:"instance,omitempty"`
+	Code       Kind       `json:"code"`
+	RequestID  string     `json:"requestId,omitempty"`
+	Errors     []FieldErr `json:"errors,omitempty"`
+	Extensions JSON       `json:"-"`
+}
+
+// NewProblem describes err for a client. Server errors get a generic detail, the real error is for the logs.
+func NewProblem(status int, err error) Problem {
+	kind := KindOf(status)
+	p := Problem{
+		Type:   "urn:launchl:problem:" + string(kind),
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   kind,
+	}
+
+	if kind == KindInternal || err == nil {
+		if kind == KindInternal {
+			p.Detail = internalDetail
+		}
+		return p
+	}
+
+	p.Detail = err.Error()
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		// validator messages name go structs, the field list says the same thing in the clients terms
+		p.Detail = "one or more fields are invalid"
+	}
+	p.Errors = fieldErrors(err)
+	return p
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	body, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	members := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, err
+	}
+	for k, v := range p.Extensions {
+		if _, taken := members[k]; taken {
+			continue
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		members[k] = raw
+	}
+
+	return json.Marshal(members)
+}
+
+// WriteProblem falls back to the request id the response already carries when p has none
+func WriteProblem(w http.ResponseWriter, p Problem) error {
+	if p.RequestID == "" {
+		p.RequestID = w.Header().Get(RequestIDHeader)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
+
+func fieldErrors(err error) []FieldErr {
+	var fe FieldErrorer
+	if errors.As(err, &fe) {
+		return fe.FieldErrors()
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+
+	out := make([]FieldErr, 0, len(verrs))
+	for _, v := range verrs {
+		msg := fmt.Sprintf("failed the %s rule", v.Tag())
+		if v.Param() != "" {
+			msg = fmt.Sprintf("failed the %s=%s rule", v.Tag(), v.Param())
+		}
+		out = append(out, FieldErr{
+			Field:   jsonName(v.Field()),
+			Code:    v.Tag(),
+			Message: msg,
+		})
+	}
+	return out
+}
+
+// jsonName lower cases the first letter of a struct field, the models json tags are the camel cased field names
+func jsonName(field string) string {
+	r, size := utf8.DecodeRuneInString(field)
+	return string(unicode.ToLower(r)) + field[size:]
+}
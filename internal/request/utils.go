@@ -11,7 +11,6 @@ import (
 	"net/url"
 	"regexp"
 	"strconv"
-	"strings"
 	"unicode/utf8"
 
 	"github.com/google/uuid"
@@ -49,20 +48,7 @@ func (a AuthHeaderErr) Error() string {
 }
 
 func WriteTimeoutResponse(w http.ResponseWriter) error {
-	w.WriteHeader(http.StatusRequestTimeout)
-
-	errMsg := map[string]any{
-		"message": "request timeout",
-		"status":  fmt.Sprintf("%v", http.StatusRequestTimeout),
-		"success": false,
-	}
-
-	encoder := json.NewEncoder(w)
-	if err := encoder.Encode(errMsg); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return err
-	}
-	return nil
+	return WriteProblem(w, NewProblem(http.StatusRequestTimeout, ErrReqTimeout))
 }
 
 func ParseJSON(r *http.Request, payload any) error {
@@ -90,23 +76,16 @@ func WriteJSON(w http.ResponseWriter, status int, msg any) error {
 	return json.NewEncoder(w).Encode(msg)
 }
 
+// WriteErr writes err as a problem, for errors returned from handlers use services.Handle instead
+// so the error is classified and logged
 func WriteErr(w http.ResponseWriter, status int, err error) {
-	err = WriteJSON(w, status, map[string]string{"error": err.Error()})
-	if err != nil {
+	if err := WriteProblem(w, NewProblem(status, err)); err != nil {
 		http.Error(w, err.Error(), status)
 	}
 }
 
 func WriteManyErrors(w http.ResponseWriter, status int, errs []error) {
-	e := make([]string, 0, len(errs))
-	for _, err := range errs {
-		e = append(e, err.Error())
-	}
-
-	err := WriteJSON(w, status, map[string]string{"errors": strings.Join(e, ",")})
-	if err != nil {
-		http.Error(w, err.Error(), status)
-	}
+	WriteErr(w, status, errors.Join(errs...))
 }
 
 func HandleTimeout(w http.ResponseWriter) {
@@ -156,7 +135,12 @@ func ParseFile(r *http.Request) (multipart.File, *multipart.FileHeader, error) {
 	err := r.ParseMultipartForm(maxSize)
 
 	if err != nil {
-		return nil, nil, ErrMaxSize
+		// a body cut off by http.MaxBytesReader is too large, anything else is a bad form
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, nil, errors.Join(ErrMaxSize, err)
+		}
+		return nil, nil, err
 	}
 
 	file, header, err := r.FormFile("image")
@@ -227,6 +211,21 @@ func ParseUUID(r *http.Request) (string, error) {
 	return uid, nil
 }
 
+// ParsePathUUID parses the named path value as a uuid
+func ParsePathUUID(r *http.Request, name string) (uuid.UUID, error) {
+	val := r.PathValue(name)
+	if val == "" {
+		return uuid.Nil, fmt.Errorf("%s is required", name)
+	}
+
+	uid, err := uuid.Parse(val)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s must be a uuid", name)
+	}
+
+	return uid, nil
+}
+
 func ParseEmail(r *http.Request) (string, error) {
 	email := r.PathValue("email")
 	if email == "" {
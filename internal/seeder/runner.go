@@ -6,10 +6,15 @@ import (
 	"strings"
 	"time"
 
+	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/database/store"
 	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos/auditrepo"
 	"github.com/zrp9/launchl/internal/repos/configrepo"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+	"github.com/zrp9/launchl/internal/services/audit"
 	"github.com/zrp9/launchl/internal/services/feature"
+	"github.com/zrp9/launchl/internal/services/reward"
 )
 
 type SeederAdapter struct {
@@ -20,10 +25,18 @@ type SeederAdapter struct {
 func SeederFactory(s store.Persister) SeederAdapter {
 	return SeederAdapter{
 		roleService:    configrepo.NewRoleRepo(s),
-		featureService: feature.New(s),
+		featureService: newFeatureService(s),
 	}
 }
 
+func newFeatureService(s store.Persister) feature.FeatureService {
+	recorder := audit.New(auditrepo.New(s))
+	users := userrepo.New(s)
+	rewarder := reward.New(users, recorder, config.LoadRewards())
+	// seeding never uploads images so the feature service gets no blob store
+	return feature.New(s, configrepo.NewFeatureRepo(s), configrepo.NewVoteRepo(s), users, recorder, rewarder, nil, config.BlobCfg{})
+}
+
 func (s SeederAdapter) seedFeatures() error {
 	log.Println("Starting feature seeder...")
 	features := GetAppFeatures()
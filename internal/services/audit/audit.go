@@ -0,0 +1,140 @@
+// Package audit records who changed what so admin edits and rewards can be traced
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/auth"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/auditrepo"
+	"github.com/zrp9/launchl/internal/request"
+	"github.com/zrp9/launchl/pkg/jsonb"
+)
+
+// SystemActor is recorded when a change is not made by an authenticated caller, like a referal reward
+const SystemActor = "system"
+
+// piiFields are left out of snapshots and diffs at any depth. The log is append only so
+// anything personal written to it would outlive the user being anonymized.
+var piiFields = map[string]bool{
+	"email":       true,
+	"username":    true,
+	"phone":       true,
+	"firstName":   true,
+	"lastName":    true,
+	"companyName": true,
+	"comments":    true,
+}
+
+type Recorder struct {
+	repo auditrepo.AuditRepo
+}
+
+func New(r auditrepo.AuditRepo) Recorder {
+	return Recorder{repo: r}
+}
+
+// Record writes an entry for a change to entity. Call it with the same ctx as the change
+// so the entry is written in the same transaction and disappears if the change rolls back.
+func (r Recorder) Record(ctx context.Context, action domain.AuditAction, entityType, entityID string, before, after any) error {
+	before, err := redact(before)
+	if err != nil {
+		return fmt.Errorf("failed to redact audit entry %w", err)
+	}
+
+	if after, err = redact(after); err != nil {
+		return fmt.Errorf("failed to redact audit entry %w", err)
+	}
+
+	diff, err := jsonb.Diff(before, after)
+	if err != nil {
+		return fmt.Errorf("failed to diff audit entry %w", err)
+	}
+
+	entry := domain.AuditEntry{
+		ID:         uuid.New(),
+		Actor:      SystemActor,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Diff:       jsonb.JSONB[map[string]jsonb.Change]{V: diff},
+		RequestID:  request.RequestID(ctx),
+	}
+
+	if claims, ok := auth.ClaimsFromContext(ctx); ok {
+		entry.Actor = claims.Username
+		entry.ActorRole = claims.Role
+	}
+
+	if entry.Before, err = toJSONB(before); err != nil {
+		return err
+	}
+
+	if entry.After, err = toJSONB(after); err != nil {
+		return err
+	}
+
+	if _, err := r.repo.Create(ctx, &entry); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r Recorder) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.AuditEntry, int, error) {
+	return r.repo.Find(ctx, spec)
+}
+
+func toJSONB(v any) (jsonb.NullJSONB[json.RawMessage], error) {
+	if v == nil {
+		return jsonb.NullJSONB[json.RawMessage]{}, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return jsonb.NullJSONB[json.RawMessage]{}, err
+	}
+
+	return jsonb.NullJSONB[json.RawMessage]{V: data, Valid: string(data) != "null"}, nil
+}
+
+// redact returns v as generic json with the pii fields removed
+func redact(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+
+	return strip(generic), nil
+}
+
+func strip(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, field := range t {
+			if piiFields[k] {
+				delete(t, k)
+				continue
+			}
+			t[k] = strip(field)
+		}
+	case []any:
+		for i := range t {
+			t[i] = strip(t[i])
+		}
+	}
+	return v
+}
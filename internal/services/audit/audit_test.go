@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/pkg/jsonb"
+)
+
+func TestRedact(t *testing.T) {
+	usr := domain.User{
+		ID:          uuid.New(),
+		Email:       "jane@example.com",
+		Username:    "jane",
+		Phone:       "5551234567",
+		FirstName:   "Jane",
+		LastName:    "Doe",
+		CompanyName: "Acme",
+		Comments:    "call me",
+		QuePosition: 4,
+	}
+
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{name: "user", v: usr},
+		{name: "pointer", v: &usr},
+		{name: "nested", v: map[string]any{"users": []domain.User{usr}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redact(tt.v)
+			if err != nil {
+				t.Fatalf("redact: %v", err)
+			}
+
+			data, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, pii := range []string{usr.Email, `"jane"`, usr.Phone, usr.FirstName, usr.LastName, usr.CompanyName, usr.Comments} {
+				if strings.Contains(string(data), pii) {
+					t.Errorf("snapshot still has %q: %s", pii, data)
+				}
+			}
+			if !strings.Contains(string(data), usr.ID.String()) {
+				t.Errorf("snapshot lost the user id: %s", data)
+			}
+		})
+	}
+
+	if got, err := redact(nil); got != nil || err != nil {
+		t.Errorf("redact(nil) = %v, %v", got, err)
+	}
+}
+
+func TestRedactedDiff(t *testing.T) {
+	before := domain.User{FirstName: "Jane", QuePosition: 4}
+	after := domain.User{FirstName: "Janet", QuePosition: 2}
+
+	b, err := redact(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := redact(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := jsonb.Diff(b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := diff["firstName"]; ok {
+		t.Errorf("diff has firstName: %v", diff)
+	}
+	if _, ok := diff["quePosition"]; !ok {
+		t.Errorf("diff is missing quePosition: %v", diff)
+	}
+}
@@ -0,0 +1,89 @@
+package export
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/middleware"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/services"
+)
+
+type ExportAPI struct {
+	e      Exporter
+	logger *crane.Zlogrus
+}
+
+func Initialize(e Exporter, l *crane.Zlogrus) ExportAPI {
+	return ExportAPI{
+		e:      e,
+		logger: l,
+	}
+}
+
+func (a ExportAPI) Name() string {
+	return "export"
+}
+
+func (a ExportAPI) RegisterRoutes(m *http.ServeMux) {
+	admin := middleware.Authorize(middleware.AdminRole)
+	m.HandleFunc("GET /admin/export/{dataset}", admin(a.HandleLogging(a.HandleExport)))
+}
+
+func (a ExportAPI) HandleLogging(hn services.APIHandler) http.HandlerFunc {
+	return services.Handle(a.logger, hn)
+}
+
+// HandleExport streams a dataset as an attachment, ?format=csv|ndjson picks the encoding and
+// the remaining params filter and sort like the matching admin list endpoint
+func (a ExportAPI) HandleExport(w http.ResponseWriter, r *http.Request) error {
+	dataset := Dataset(r.PathValue("dataset"))
+	fields, err := a.e.Fields(dataset)
+	if err != nil {
+		return services.APIErr{Status: http.StatusNotFound, Err: err}
+	}
+
+	params := r.URL.Query()
+	format, err := ParseFormat(params.Get("format"))
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+	params.Del("format")
+
+	spec, err := repos.ParseQuery(params, fields)
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	// exports stream for longer than the server write timeout allows
+	http.NewResponseController(w).SetWriteDeadline(time.Time{}) //nolint:errcheck
+
+	filename := fmt.Sprintf("%s-%s.%s", dataset, time.Now().UTC().Format("20060102T150405Z"), format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	count, err := a.e.Export(r.Context(), dataset, spec, flushWriter{w}, format)
+	if err != nil {
+		// the status line is already sent so the best we can do is cut the body short and log why
+		return fmt.Errorf("export of %s stopped after %d rows %w", dataset, count, err)
+	}
+
+	return nil
+}
+
+// flushWriter pushes every buffered chunk the exporter writes to the client instead of
+// letting the response writer hold the whole export
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if fl, ok := f.w.(http.Flusher); ok {
+		fl.Flush()
+	}
+	return n, err
+}
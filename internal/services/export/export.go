@@ -0,0 +1,115 @@
+// Package export streams subscribers, referals and survey responses out as csv or ndjson
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/referalrepo"
+	"github.com/zrp9/launchl/internal/repos/surveyrepo"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+)
+
+type Dataset string
+
+const (
+	Users     Dataset = "users"
+	Referals  Dataset = "referals"
+	Responses Dataset = "responses"
+)
+
+// flushEvery bounds how many rows sit in the writers buffer before they are sent on
+const flushEvery = 500
+
+var ErrUnknownDataset = errors.New("dataset must be users, referals or responses")
+
+var columns = map[Dataset][]string{
+	Users: {
+		"id", "email", "username", "firstName", "lastName", "phone", "companyName",
+		"wouldUse", "quePosition", "referalId", "createdAt", "updatedAt",
+	},
+	Referals: {"id", "refererId", "refererEmail", "refereeId", "refereeEmail"},
+	Responses: {
+		"responseId", "submissionId", "submittedAt", "userId", "email", "surveyId", "surveyName",
+		"surveyVersion", "questionId", "prompt", "questionType", "optionId", "optionLabel", "optionValue", "text",
+	},
+}
+
+var fields = map[Dataset]repos.Fields{
+	Users:     userrepo.Fields,
+	Referals:  referalrepo.ExportFields,
+	Responses: surveyrepo.FlatFields,
+}
+
+type Exporter struct {
+	users     userrepo.UserRepo
+	referals  referalrepo.ReferalRepo
+	responses surveyrepo.ResponseRepo
+}
+
+func New(u userrepo.UserRepo, r referalrepo.ReferalRepo, s surveyrepo.ResponseRepo) Exporter {
+	return Exporter{
+		users:     u,
+		referals:  r,
+		responses: s,
+	}
+}
+
+// Fields returns the filter and sort whitelist of a dataset
+func (e Exporter) Fields(d Dataset) (repos.Fields, error) {
+	f, ok := fields[d]
+	if !ok {
+		return nil, ErrUnknownDataset
+	}
+	return f, nil
+}
+
+// Export writes every record of the dataset matching spec to w and returns how many were written
+func (e Exporter) Export(ctx context.Context, d Dataset, spec repos.QuerySpec, w io.Writer, f Format) (int, error) {
+	cols, ok := columns[d]
+	if !ok {
+		return 0, ErrUnknownDataset
+	}
+
+	rw, err := NewRowWriter(w, f, cols)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	write := func(vals ...any) error {
+		if err := rw.Write(vals...); err != nil {
+			return err
+		}
+		count++
+		if count%flushEvery == 0 {
+			return rw.Flush()
+		}
+		return nil
+	}
+
+	switch d {
+	case Users:
+		err = e.users.Each(ctx, spec, func(u *domain.User) error {
+			return write(u.ID, u.Email, u.Username, u.FirstName, u.LastName, u.Phone, u.CompanyName,
+				u.WouldUse, u.QuePosition, u.ReferalID, u.CreatedAt, u.UpdatedAt)
+		})
+	case Referals:
+		err = e.referals.EachExport(ctx, spec, func(r *referalrepo.ExportRow) error {
+			return write(r.ID, r.RefererID, r.RefererEmail, r.RefereeID, r.RefereeEmail)
+		})
+	case Responses:
+		err = e.responses.EachFlat(ctx, spec, func(r *surveyrepo.FlatResponse) error {
+			return write(r.ResponseID, r.SubmissionID, r.SubmittedAt, r.UserID, r.Email, r.SurveyID, r.SurveyName,
+				r.SurveyVersion, r.QuestionID, r.Prompt, r.QuestionType, r.OptionID, r.OptionLabel, r.OptionValue, r.Text)
+		})
+	}
+	if err != nil {
+		return count, err
+	}
+
+	return count, rw.Flush()
+}
@@ -0,0 +1,176 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+var ErrUnknownFormat = errors.New("format must be csv or ndjson")
+
+func ParseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case "", CSV:
+		return CSV, nil
+	case NDJSON:
+		return NDJSON, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == NDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// RowWriter writes one record per call in the order of the columns it was made with
+type RowWriter interface {
+	Write(vals ...any) error
+	Flush() error
+}
+
+// NewRowWriter writes a csv header row straight away, ndjson records are objects keyed by column
+func NewRowWriter(w io.Writer, f Format, cols []string) (RowWriter, error) {
+	if f == NDJSON {
+		return &ndjsonWriter{w: bufio.NewWriter(w), cols: cols}, nil
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw, record: make([]string, len(cols))}, nil
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvWriter) Write(vals ...any) error {
+	if len(vals) != len(c.record) {
+		return fmt.Errorf("got %d values for %d columns", len(vals), len(c.record))
+	}
+
+	for i, v := range vals {
+		c.record[i] = cell(v)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	w    *bufio.Writer
+	cols []string
+}
+
+// Write builds the object by hand so keys keep the column order instead of being sorted like a map
+func (n *ndjsonWriter) Write(vals ...any) error {
+	if len(vals) != len(n.cols) {
+		return fmt.Errorf("got %d values for %d columns", len(vals), len(n.cols))
+	}
+
+	n.w.WriteByte('{') //nolint:errcheck
+	for i, v := range vals {
+		if i > 0 {
+			n.w.WriteByte(',') //nolint:errcheck
+		}
+
+		key, err := json.Marshal(n.cols[i])
+		if err != nil {
+			return err
+		}
+		val, err := json.Marshal(jsonValue(v))
+		if err != nil {
+			return err
+		}
+
+		n.w.Write(key)     //nolint:errcheck
+		n.w.WriteByte(':') //nolint:errcheck
+		n.w.Write(val)     //nolint:errcheck
+	}
+	_, err := n.w.WriteString("}\n")
+	return err
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+// cell formats a value for csv, zero uuids and times are left empty
+func cell(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return defuse(t)
+	case bool:
+		return strconv.FormatBool(t)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case int:
+		return strconv.Itoa(t)
+	case uuid.UUID:
+		if t == uuid.Nil {
+			return ""
+		}
+		return t.String()
+	case time.Time:
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	default:
+		return defuse(fmt.Sprint(t))
+	}
+}
+
+// defuse stops spreadsheets running user supplied text as a formula by quoting anything that starts
+// like one, numbers we format ourselves never go through here
+func defuse(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + s
+	}
+	return s
+}
+
+// jsonValue turns zero uuids and times into null
+func jsonValue(v any) any {
+	switch t := v.(type) {
+	case uuid.UUID:
+		if t == uuid.Nil {
+			return nil
+		}
+	case time.Time:
+		if t.IsZero() {
+			return nil
+		}
+		return t.UTC()
+	}
+	return v
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCell(t *testing.T) {
+	id := uuid.MustParse("7d444840-9dc0-11d1-b245-5ffdce74fad2")
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.FixedZone("EST", -5*60*60))
+
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{name: "nil", v: nil, want: ""},
+		{name: "plain string", v: "jane", want: "jane"},
+		{name: "empty string", v: "", want: ""},
+		{name: "formula", v: "=HYPERLINK(\"http://evil\")", want: "'=HYPERLINK(\"http://evil\")"},
+		{name: "plus", v: "+1+cmd|' /C calc'!A0", want: "'+1+cmd|' /C calc'!A0"},
+		{name: "minus", v: "-2+3", want: "'-2+3"},
+		{name: "at", v: "@SUM(A1:A2)", want: "'@SUM(A1:A2)"},
+		{name: "tab", v: "\t=1", want: "'\t=1"},
+		{name: "carriage return", v: "\r=1", want: "'\r=1"},
+		{name: "formula character later on", v: "jane=doe", want: "jane=doe"},
+		{name: "negative int64 isn't quoted", v: int64(-3), want: "-3"},
+		{name: "int", v: 42, want: "42"},
+		{name: "bool", v: true, want: "true"},
+		{name: "uuid", v: id, want: id.String()},
+		{name: "nil uuid", v: uuid.Nil, want: ""},
+		{name: "time is utc", v: at, want: "2025-03-04T10:06:07Z"},
+		{name: "zero time", v: time.Time{}, want: ""},
+		{name: "other types are quoted too", v: errors.New("=1"), want: "'=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cell(tt.v); got != tt.want {
+				t.Errorf("cell(%#v) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowWriter(t *testing.T) {
+	id := uuid.MustParse("7d444840-9dc0-11d1-b245-5ffdce74fad2")
+	at := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		format Format
+		rows   [][]any
+		want   string
+	}{
+		{
+			name:   "csv header and rows",
+			format: CSV,
+			rows: [][]any{
+				{"jane", int64(1), at, id},
+				{"=cmd", int64(-2), time.Time{}, uuid.Nil},
+			},
+			want: "username,position,createdAt,id\n" +
+				"jane,1,2025-03-04T05:06:07Z," + id.String() + "\n" +
+				"'=cmd,-2,,\n",
+		},
+		{
+			name:   "csv quotes commas and quotes",
+			format: CSV,
+			rows:   [][]any{{`doe, "jane"`, int64(1), at, id}},
+			want: "username,position,createdAt,id\n" +
+				`"doe, ""jane""",1,2025-03-04T05:06:07Z,` + id.String() + "\n",
+		},
+		{
+			name:   "csv with no rows is just the header",
+			format: CSV,
+			want:   "username,position,createdAt,id\n",
+		},
+		{
+			name:   "ndjson keeps column order and nulls zero values",
+			format: NDJSON,
+			rows: [][]any{
+				{"=cmd", int64(1), at, id},
+				{"john", int64(2), time.Time{}, uuid.Nil},
+			},
+			want: `{"username":"=cmd","position":1,"createdAt":"2025-03-04T05:06:07Z","id":"` + id.String() + `"}` + "\n" +
+				`{"username":"john","position":2,"createdAt":null,"id":null}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			rw, err := NewRowWriter(&buf, tt.format, []string{"username", "position", "createdAt", "id"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, row := range tt.rows {
+				if err := rw.Write(row...); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := rw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRowWriterColumnCount(t *testing.T) {
+	for _, f := range []Format{CSV, NDJSON} {
+		rw, err := NewRowWriter(&bytes.Buffer{}, f, []string{"a", "b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rw.Write("only one"); err == nil {
+			t.Errorf("%s writer accepted 1 value for 2 columns", f)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Format
+		wantErr bool
+	}{
+		{in: "", want: CSV},
+		{in: "csv", want: CSV},
+		{in: "ndjson", want: NDJSON},
+		{in: "xlsx", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFormat(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
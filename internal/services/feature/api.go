@@ -0,0 +1,220 @@
+package feature
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zrp9/launchl/internal/blob"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/idempotency"
+	"github.com/zrp9/launchl/internal/middleware"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/configrepo"
+	"github.com/zrp9/launchl/internal/request"
+	"github.com/zrp9/launchl/internal/services"
+)
+
+type FeatureAPI struct {
+	s      FeatureService
+	logger *crane.Zlogrus
+	idem   *idempotency.Guard
+}
+
+func Initialize(s FeatureService, l *crane.Zlogrus, idem *idempotency.Guard) FeatureAPI {
+	return FeatureAPI{
+		s:      s,
+		logger: l,
+		idem:   idem,
+	}
+}
+
+func (a FeatureAPI) Name() string {
+	return "feature"
+}
+
+func (a FeatureAPI) RegisterRoutes(m *http.ServeMux) {
+	m.HandleFunc("GET /features", a.HandleLogging(services.HandleList("features", configrepo.FeatureFields, a.s.List)))
+	m.HandleFunc("GET /features/{id}", a.HandleLogging(a.HandleGet))
+	// votes move the voter up the waitlist so only the user themselves, or an admin, can cast them
+	voter := middleware.MiddlewareChain(middleware.Authorize(), middleware.Self)
+	m.HandleFunc("POST /user/{username}/features/{id}/vote", voter(a.idem.Wrap(a.HandleLogging(a.HandleVote))))
+	m.HandleFunc("DELETE /user/{username}/features/{id}/vote", voter(a.HandleLogging(a.HandleUnvote)))
+
+	admin := middleware.Authorize(middleware.AdminRole)
+	m.HandleFunc("POST /admin/features", admin(a.idem.Wrap(a.HandleLogging(a.HandleCreate))))
+	m.HandleFunc("PATCH /admin/features/{id}", admin(a.HandleLogging(a.HandleUpdate)))
+	m.HandleFunc("DELETE /admin/features/{id}", admin(a.HandleLogging(a.HandleDelete)))
+	m.HandleFunc("POST /admin/features/{id}/images", admin(a.idem.Wrap(a.HandleLogging(a.HandleUploadImage))))
+
+	if h, ok := a.s.Images().(blob.Handler); ok {
+		m.Handle("GET "+h.Prefix()+"/", http.StripPrefix(h.Prefix(), h))
+	}
+}
+
+func (a FeatureAPI) HandleLogging(hn services.APIHandler) http.HandlerFunc {
+	return services.Handle(a.logger, hn)
+}
+
+func (a FeatureAPI) HandleGet(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	feat, err := a.s.Get(r.Context(), id.String())
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"feature": feat})
+}
+
+func (a FeatureAPI) HandleCreate(w http.ResponseWriter, r *http.Request) error {
+	var payload dto.FeatureDto
+	if err := request.ParseJSON(r, &payload); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := payload.Validate(); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	feat, err := a.s.Create(r.Context(), payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusCreated, request.JSON{"feature": feat})
+}
+
+func (a FeatureAPI) HandleUpdate(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	var payload dto.FeatureUpdate
+	if err := request.ParseJSON(r, &payload); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := payload.Validate(); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	feat, err := a.s.Update(r.Context(), id, payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"feature": feat})
+}
+
+func (a FeatureAPI) HandleDelete(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := a.s.Delete(r.Context(), id); err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"success": true})
+}
+
+// multipartOverhead leaves room for the form boundaries and headers around the image
+const multipartOverhead = 64 << 10
+
+// HandleUploadImage takes a multipart form with the file in the image field
+func (a FeatureAPI) HandleUploadImage(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, a.s.MaxImageSize()+multipartOverhead)
+	file, header, err := request.ParseFile(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return services.APIErr{Status: http.StatusRequestEntityTooLarge, Err: err}
+		}
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+	if file == nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: errors.New("image is required")}
+	}
+	defer file.Close() //nolint:errcheck
+
+	upload := dto.FileUploadDto{File: file, FileKey: header.Filename, Header: header}
+	if err := upload.Validate(); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	feat, err := a.s.AddImage(r.Context(), id, upload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusCreated, request.JSON{"feature": feat})
+}
+
+func (a FeatureAPI) HandleVote(w http.ResponseWriter, r *http.Request) error {
+	usrname, err := request.ParseUsername(r)
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	vote, created, err := a.s.Vote(r.Context(), usrname, id)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	return request.WriteJSON(w, status, request.JSON{"vote": vote})
+}
+
+func (a FeatureAPI) HandleUnvote(w http.ResponseWriter, r *http.Request) error {
+	usrname, err := request.ParseUsername(r)
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := a.s.Unvote(r.Context(), usrname, id); err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"success": true})
+}
+
+func statusErr(err error) error {
+	if errors.Is(err, repos.ErrNoRecords) {
+		return services.APIErr{Status: http.StatusNotFound, Err: err}
+	}
+	if errors.Is(err, ErrVoteLimit) {
+		return services.APIErr{Status: http.StatusConflict, Err: err}
+	}
+	if errors.Is(err, blob.ErrTooLarge) {
+		return services.APIErr{Status: http.StatusRequestEntityTooLarge, Err: err}
+	}
+	if errors.Is(err, blob.ErrUnsupportedType) {
+		return services.APIErr{Status: http.StatusUnsupportedMediaType, Err: err}
+	}
+	return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+}
@@ -2,23 +2,76 @@
 package feature
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/blob"
+	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/database/store"
 	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/dto"
 	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/configrepo"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+	"github.com/zrp9/launchl/internal/services/audit"
+	"github.com/zrp9/launchl/internal/services/reward"
 )
 
+var ErrVoteLimit = errors.New("vote limit reached, remove a vote before voting for another feature")
+
+// featureStore is the part of configrepo.FeatureRepo the service uses
+type featureStore interface {
+	Get(ctx context.Context, id string) (*domain.Feature, error)
+	GetAll(ctx context.Context) ([]*domain.Feature, error)
+	Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.Feature, int, error)
+	Create(ctx context.Context, feat domain.Feature) (*domain.Feature, error)
+	BulkCreate(ctx context.Context, feats []domain.Feature) error
+	Save(ctx context.Context, feat *domain.Feature) error
+	Delete(ctx context.Context, id string) error
+}
+
+type auditor interface {
+	Record(ctx context.Context, action domain.AuditAction, entityType, entityID string, before, after any) error
+}
+
 type FeatureService struct {
-	repo *repos.BasicRepo[string, domain.Feature]
+	tx      store.Transactor
+	repo    featureStore
+	votes   configrepo.VoteRepo
+	users   userrepo.UserRepo
+	audit   auditor
+	rewards reward.Rewarder
+	images  blob.Store
+	blobCfg config.BlobCfg
 }
 
-func New(p store.Persister) FeatureService {
+func New(tx store.Transactor, r configrepo.FeatureRepo, vr configrepo.VoteRepo, u userrepo.UserRepo, a audit.Recorder, rw reward.Rewarder, images blob.Store, cfg config.BlobCfg) FeatureService {
 	return FeatureService{
-		repo: repos.New[string, domain.Feature](p),
+		tx:      tx,
+		repo:    r,
+		votes:   vr,
+		users:   u,
+		audit:   a,
+		rewards: rw,
+		images:  images,
+		blobCfg: cfg,
 	}
 }
 
+// Images is the store uploaded feature images are kept in
+func (f FeatureService) Images() blob.Store {
+	return f.images
+}
+
+// MaxImageSize is the largest image AddImage accepts in bytes
+func (f FeatureService) MaxImageSize() int64 {
+	return f.blobCfg.MaxSize
+}
+
 func (f FeatureService) Get(ctx context.Context, id string) (*domain.Feature, error) {
 	return f.repo.Get(ctx, id)
 }
@@ -27,38 +80,295 @@ func (f FeatureService) GetAll(ctx context.Context) ([]*domain.Feature, error) {
 	return f.repo.GetAll(ctx)
 }
 
-func (f FeatureService) Create(ctx context.Context, feat domain.Feature) (*domain.Feature, error) {
-	return f.repo.Create(ctx, &feat)
+func (f FeatureService) List(ctx context.Context, spec repos.QuerySpec) ([]*domain.Feature, int, error) {
+	return f.repo.Find(ctx, spec)
 }
 
-func (f FeatureService) Update(ctx context.Context, feat domain.Feature) error {
-	return f.repo.Update(ctx, feat.ID.String(), &feat)
+func (f FeatureService) Create(ctx context.Context, d dto.FeatureDto) (*domain.Feature, error) {
+	var created *domain.Feature
+	err := f.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = f.repo.Create(ctx, domain.Feature{
+			ID:               uuid.New(),
+			Title:            d.Title,
+			Name:             d.Name,
+			Details:          d.Details,
+			QuickDescription: d.QuickDescription,
+			Images:           imagesOrEmpty(d.Images),
+		})
+		if err != nil {
+			return err
+		}
+
+		return f.audit.Record(ctx, domain.AuditFeatureCreate, "feature", created.ID.String(), nil, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
 }
 
-func (f FeatureService) BulkCreate(ctx context.Context, feats []domain.Feature) (err error) {
-	tx, err := f.repo.BnDB().BeginTx(ctx, nil)
+// Update applies the non nil fields of edit to the feature
+func (f FeatureService) Update(ctx context.Context, id uuid.UUID, edit dto.FeatureUpdate) (*domain.Feature, error) {
+	var (
+		updated *domain.Feature
+		removed []string
+	)
+	err := f.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := f.repo.Get(ctx, id.String())
+		if err != nil {
+			return err
+		}
 
+		after := *before
+		if edit.Title != nil {
+			after.Title = *edit.Title
+		}
+		if edit.Name != nil {
+			after.Name = *edit.Name
+		}
+		if edit.Details != nil {
+			after.Details = *edit.Details
+		}
+		if edit.QuickDescription != nil {
+			after.QuickDescription = *edit.QuickDescription
+		}
+		if edit.Images != nil {
+			after.Images = imagesOrEmpty(*edit.Images)
+			after.Thumbnails = pruneThumbnails(after.Images, before.Thumbnails)
+		}
+
+		if err := f.repo.Save(ctx, &after); err != nil {
+			return err
+		}
+		updated = &after
+		removed = droppedBlobs(before, &after)
+
+		return f.audit.Record(ctx, domain.AuditFeatureUpdate, "feature", id.String(), before, after)
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer func() {
-		if e := tx.Rollback(); e != nil {
-			err = e
+
+	f.deleteBlobs(ctx, removed)
+	return updated, nil
+}
+
+func (f FeatureService) BulkCreate(ctx context.Context, feats []domain.Feature) error {
+	for i := range feats {
+		if feats[i].ID == uuid.Nil {
+			feats[i].ID = uuid.New()
+		}
+		feats[i].Images = imagesOrEmpty(feats[i].Images)
+		feats[i].Thumbnails = pruneThumbnails(feats[i].Images, feats[i].Thumbnails)
+	}
+	return f.repo.BulkCreate(ctx, feats)
+}
+
+func (f FeatureService) Delete(ctx context.Context, id uuid.UUID) error {
+	var removed []string
+	err := f.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := f.repo.Get(ctx, id.String())
+		if err != nil {
+			return err
+		}
+
+		if err := f.repo.Delete(ctx, id.String()); err != nil {
+			return err
 		}
-	}()
+		removed = droppedBlobs(before, &domain.Feature{})
 
-	_, err = f.repo.BnDB().NewInsert().Model(&feats).Exec(ctx)
+		return f.audit.Record(ctx, domain.AuditFeatureDelete, "feature", id.String(), before, nil)
+	})
 	if err != nil {
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
+	f.deleteBlobs(ctx, removed)
+	return nil
+}
+
+// AddImage checks the upload is an image within the size limit, stores it along with a thumbnail
+// and appends it to the features images. The blobs are removed again if the feature can't be saved.
+func (f FeatureService) AddImage(ctx context.Context, id uuid.UUID, upload dto.FileUploadDto) (*domain.Feature, error) {
+	if _, err := f.repo.Get(ctx, id.String()); err != nil {
+		return nil, err
 	}
 
-	return nil
+	img, err := blob.ReadImage(upload.File, f.blobCfg.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	thumb, err := img.Thumbnail(f.blobCfg.ThumbWidth)
+	if err != nil {
+		return nil, err
+	}
+
+	name := uuid.NewString()
+	imgKey := fmt.Sprintf("features/%s/%s%s", id, name, img.Ext)
+	thumbKey := fmt.Sprintf("features/%s/%s_thumb%s", id, name, thumb.Ext)
+
+	imgURL, err := f.images.Put(ctx, imgKey, img.ContentType, bytes.NewReader(img.Data), int64(len(img.Data)))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbURL, err := f.images.Put(ctx, thumbKey, thumb.ContentType, bytes.NewReader(thumb.Data), int64(len(thumb.Data)))
+	if err != nil {
+		f.images.Delete(ctx, imgKey) //nolint:errcheck
+		return nil, err
+	}
+
+	var updated *domain.Feature
+	err = f.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := f.repo.Get(ctx, id.String())
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Images = append(slices.Clone(before.Images), imgURL)
+		after.Thumbnails = pruneThumbnails(after.Images, before.Thumbnails)
+		after.Thumbnails[imgURL] = thumbURL
+
+		if err := f.repo.Save(ctx, &after); err != nil {
+			return err
+		}
+		updated = &after
+
+		return f.audit.Record(ctx, domain.AuditFeatureUpdate, "feature", id.String(), before, after)
+	})
+	if err != nil {
+		f.images.Delete(ctx, imgKey)   //nolint:errcheck
+		f.images.Delete(ctx, thumbKey) //nolint:errcheck
+		return nil, err
+	}
+
+	return updated, nil
 }
 
-func (f FeatureService) Delete(ctx context.Context, id string) error {
-	return f.repo.Delete(ctx, id)
+// Vote records the users vote for a feature and pays out the configured vote boost. Voting for a
+// feature twice returns the existing vote with created false and counts against the limit once.
+func (f FeatureService) Vote(ctx context.Context, username string, featureID uuid.UUID) (*domain.FeatureVote, bool, error) {
+	var (
+		vote    *domain.FeatureVote
+		created bool
+	)
+	err := f.tx.RunInTx(ctx, func(ctx context.Context) error {
+		usr, err := f.users.GetByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.repo.Get(ctx, featureID.String()); err != nil {
+			return err
+		}
+
+		count, err := f.votes.CountByUser(ctx, usr.ID.String())
+		if err != nil {
+			return err
+		}
+
+		vote, err = f.votes.Get(ctx, usr.ID.String(), featureID.String())
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, repos.ErrNoRecords) {
+			return err
+		}
+
+		if limit := f.rewards.MaxVotes(); limit > 0 && count >= limit {
+			return ErrVoteLimit
+		}
+
+		vote = &domain.FeatureVote{
+			UserID:    usr.ID,
+			FeatureID: featureID,
+			Boost:     f.rewards.VoteBoost(),
+		}
+		if created, err = f.votes.Add(ctx, vote); err != nil || !created {
+			return err
+		}
+
+		return f.rewards.Boost(ctx, *usr, vote.Boost, domain.AuditRewardVote)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return vote, created, nil
+}
+
+// Unvote removes the users vote and takes back the boost the vote paid out
+func (f FeatureService) Unvote(ctx context.Context, username string, featureID uuid.UUID) error {
+	return f.tx.RunInTx(ctx, func(ctx context.Context) error {
+		usr, err := f.users.GetByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		vote, err := f.votes.Remove(ctx, usr.ID.String(), featureID.String())
+		if err != nil {
+			return err
+		}
+
+		return f.rewards.Boost(ctx, *usr, -vote.Boost, domain.AuditRevokeVote)
+	})
+}
+
+// deleteBlobs removes the images and thumbnails a feature no longer points at. It runs once the change
+// has committed so a rollback never leaves a feature with missing files, a blob that fails to delete
+// is only left behind as an orphan.
+func (f FeatureService) deleteBlobs(ctx context.Context, urls []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, u := range urls {
+		if key, ok := blob.KeyOf(f.images, u); ok {
+			f.images.Delete(ctx, key) //nolint:errcheck
+		}
+	}
+}
+
+// droppedBlobs lists the image and thumbnail urls on before that after doesn't keep
+func droppedBlobs(before, after *domain.Feature) []string {
+	kept := make(map[string]bool, len(after.Images)+len(after.Thumbnails))
+	for _, img := range after.Images {
+		kept[img] = true
+	}
+	for _, thumb := range after.Thumbnails {
+		kept[thumb] = true
+	}
+
+	var dropped []string
+	for _, img := range before.Images {
+		if !kept[img] {
+			dropped = append(dropped, img)
+		}
+	}
+	for _, thumb := range before.Thumbnails {
+		if !kept[thumb] {
+			dropped = append(dropped, thumb)
+		}
+	}
+	return dropped
+}
+
+// imagesOrEmpty keeps a feature without images from writing null into the not null images column
+func imagesOrEmpty(images []string) []string {
+	if images == nil {
+		return []string{}
+	}
+	return images
+}
+
+// pruneThumbnails copies the thumbnails of images that are still on the feature
+func pruneThumbnails(images []string, thumbs map[string]string) map[string]string {
+	kept := make(map[string]string, len(thumbs))
+	for _, img := range images {
+		if t, ok := thumbs[img]; ok {
+			kept[img] = t
+		}
+	}
+	return kept
 }
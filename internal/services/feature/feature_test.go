@@ -0,0 +1,475 @@
+package feature
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/blob"
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/repos"
+)
+
+const blobBase = "https://blobs.test"
+
+var errUnreachable = errors.New("bucket unreachable")
+
+// memBlobs is a blob.Store that keeps blobs in memory
+type memBlobs struct {
+	mu      sync.Mutex
+	blobs   map[string][]byte
+	deleted []string
+	putErr  error
+}
+
+func newMemBlobs() *memBlobs {
+	return &memBlobs{blobs: make(map[string][]byte)}
+}
+
+func (m *memBlobs) Put(ctx context.Context, key, contentType string, r io.Reader, size int64) (string, error) {
+	if m.putErr != nil {
+		return "", m.putErr
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[key] = data
+	return m.URL(key), nil
+}
+
+func (m *memBlobs) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.blobs[key]; !ok {
+		return blob.ErrNotFound
+	}
+	delete(m.blobs, key)
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+
+func (m *memBlobs) URL(key string) string {
+	return blobBase + "/" + key
+}
+
+func (m *memBlobs) keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.blobs))
+	for k := range m.blobs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// memFeatures is a featureStore over a map
+type memFeatures struct {
+	feats   map[uuid.UUID]domain.Feature
+	saveErr error
+}
+
+func (m *memFeatures) Get(ctx context.Context, id string) (*domain.Feature, error) {
+	f, ok := m.feats[uuid.MustParse(id)]
+	if !ok {
+		return nil, repos.ErrNoRecords
+	}
+	f.Images = slices.Clone(f.Images)
+	thumbs := make(map[string]string, len(f.Thumbnails))
+	for k, v := range f.Thumbnails {
+		thumbs[k] = v
+	}
+	f.Thumbnails = thumbs
+	return &f, nil
+}
+
+func (m *memFeatures) GetAll(ctx context.Context) ([]*domain.Feature, error) {
+	return nil, errors.New("not used")
+}
+
+func (m *memFeatures) Find(ctx context.Context, spec repos.QuerySpec) ([]*domain.Feature, int, error) {
+	return nil, 0, errors.New("not used")
+}
+
+func (m *memFeatures) Create(ctx context.Context, feat domain.Feature) (*domain.Feature, error) {
+	m.feats[feat.ID] = feat
+	return &feat, nil
+}
+
+func (m *memFeatures) BulkCreate(ctx context.Context, feats []domain.Feature) error {
+	for _, f := range feats {
+		m.feats[f.ID] = f
+	}
+	return nil
+}
+
+func (m *memFeatures) Save(ctx context.Context, feat *domain.Feature) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.feats[feat.ID] = *feat
+	return nil
+}
+
+func (m *memFeatures) Delete(ctx context.Context, id string) error {
+	delete(m.feats, uuid.MustParse(id))
+	return nil
+}
+
+type nopTx struct{}
+
+func (nopTx) RunInTx(ctx context.Context, fn store.TxFunc) error {
+	return fn(ctx)
+}
+
+func (nopTx) Savepoint(ctx context.Context, fn store.TxFunc) error {
+	return fn(ctx)
+}
+
+type nopAudit struct{}
+
+func (nopAudit) Record(ctx context.Context, action domain.AuditAction, entityType, entityID string, before, after any) error {
+	return nil
+}
+
+func newTestService(feats ...domain.Feature) (FeatureService, *memFeatures, *memBlobs) {
+	repo := &memFeatures{feats: make(map[uuid.UUID]domain.Feature)}
+	for _, f := range feats {
+		repo.feats[f.ID] = f
+	}
+	images := newMemBlobs()
+	return FeatureService{
+		tx:      nopTx{},
+		repo:    repo,
+		audit:   nopAudit{},
+		images:  images,
+		blobCfg: config.BlobCfg{MaxSize: 1 << 20, ThumbWidth: 8},
+	}, repo, images
+}
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// upload builds the dto HandleUploadImage hands to AddImage
+func upload(t *testing.T, data []byte) dto.FileUploadDto {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("image", "card.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data) //nolint:errcheck
+	mw.Close()     //nolint:errcheck
+
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := form.File["image"][0]
+	file, err := header.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() }) //nolint:errcheck
+	return dto.FileUploadDto{File: file, FileKey: header.Filename, Header: header}
+}
+
+func TestAddImage(t *testing.T) {
+	feat := domain.Feature{ID: uuid.New(), Images: []string{}, Thumbnails: map[string]string{}}
+	s, repo, images := newTestService(feat)
+
+	updated, err := s.AddImage(context.Background(), feat.ID, upload(t, testPNG(t, 32, 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updated.Images) != 1 {
+		t.Fatalf("images = %v, want one", updated.Images)
+	}
+	img := updated.Images[0]
+	thumb, ok := updated.Thumbnails[img]
+	if !ok {
+		t.Fatalf("no thumbnail for %s in %v", img, updated.Thumbnails)
+	}
+	if !strings.HasPrefix(img, blobBase+"/features/"+feat.ID.String()+"/") || !strings.HasSuffix(img, ".png") {
+		t.Errorf("image url = %s, want a png under the features key", img)
+	}
+	if saved := repo.feats[feat.ID]; !slices.Equal(saved.Images, updated.Images) {
+		t.Errorf("saved images = %v, want %v", saved.Images, updated.Images)
+	}
+	if keys := images.keys(); len(keys) != 2 {
+		t.Errorf("stored blobs = %v, want the image and its thumbnail", keys)
+	}
+
+	key, _ := blob.KeyOf(images, thumb)
+	decoded, err := png.DecodeConfig(bytes.NewReader(images.blobs[key]))
+	if err != nil || decoded.Width != 8 || decoded.Height != 4 {
+		t.Errorf("thumbnail = %dx%d %v, want 8x4", decoded.Width, decoded.Height, err)
+	}
+}
+
+func TestAddImageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    func(t *testing.T) []byte
+		setup   func(repo *memFeatures, images *memBlobs)
+		missing bool
+		wantErr error
+	}{
+		{
+			name:    "not an image",
+			data:    func(t *testing.T) []byte { return []byte("%PDF-1.4 not an image") },
+			wantErr: blob.ErrUnsupportedType,
+		},
+		{
+			name:    "too large",
+			data:    func(t *testing.T) []byte { return bytes.Repeat([]byte{0}, 2<<20) },
+			wantErr: blob.ErrTooLarge,
+		},
+		{
+			name:    "unknown feature",
+			data:    func(t *testing.T) []byte { return testPNG(t, 4, 4) },
+			missing: true,
+			wantErr: repos.ErrNoRecords,
+		},
+		{
+			name:    "blobs are removed when the feature can't be saved",
+			data:    func(t *testing.T) []byte { return testPNG(t, 4, 4) },
+			setup:   func(repo *memFeatures, _ *memBlobs) { repo.saveErr = repos.ErrDBWrite },
+			wantErr: repos.ErrDBWrite,
+		},
+		{
+			name:    "store failure",
+			data:    func(t *testing.T) []byte { return testPNG(t, 4, 4) },
+			setup:   func(_ *memFeatures, images *memBlobs) { images.putErr = errUnreachable },
+			wantErr: errUnreachable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feat := domain.Feature{ID: uuid.New(), Images: []string{}, Thumbnails: map[string]string{}}
+			s, repo, images := newTestService(feat)
+			if tt.setup != nil {
+				tt.setup(repo, images)
+			}
+			id := feat.ID
+			if tt.missing {
+				id = uuid.New()
+			}
+
+			_, err := s.AddImage(context.Background(), id, upload(t, tt.data(t)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if keys := images.keys(); len(keys) != 0 {
+				t.Errorf("blobs left behind %v", keys)
+			}
+			if got := repo.feats[feat.ID].Images; len(got) != 0 {
+				t.Errorf("feature images = %v, want none", got)
+			}
+		})
+	}
+}
+
+// featureWithImages stores two uploaded images with thumbnails and links one external image
+func featureWithImages(t *testing.T, s FeatureService, images *memBlobs) domain.Feature {
+	t.Helper()
+	feat := domain.Feature{ID: uuid.New(), Images: []string{}, Thumbnails: map[string]string{}}
+	s.repo.(*memFeatures).feats[feat.ID] = feat
+
+	for range 2 {
+		if _, err := s.AddImage(context.Background(), feat.ID, upload(t, testPNG(t, 16, 16))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ := s.repo.Get(context.Background(), feat.ID.String())
+	got.Images = append(got.Images, "https://elsewhere.example.com/logo.png")
+	s.repo.(*memFeatures).feats[feat.ID] = *got
+	return *got
+}
+
+func TestUpdateDeletesRemovedImages(t *testing.T) {
+	s, _, images := newTestService()
+	feat := featureWithImages(t, s, images)
+	kept, dropped := feat.Images[0], feat.Images[1]
+
+	keep := []string{kept, "https://elsewhere.example.com/logo.png"}
+	if _, err := s.Update(context.Background(), feat.ID, dto.FeatureUpdate{Images: &keep}); err != nil {
+		t.Fatal(err)
+	}
+
+	droppedKey, _ := blob.KeyOf(images, dropped)
+	droppedThumb, _ := blob.KeyOf(images, feat.Thumbnails[dropped])
+	keptKey, _ := blob.KeyOf(images, kept)
+	keptThumb, _ := blob.KeyOf(images, feat.Thumbnails[kept])
+
+	if want := []string{keptKey, keptThumb}; !sameKeys(images.keys(), want) {
+		t.Errorf("blobs left = %v, want %v", images.keys(), want)
+	}
+	if !sameKeys(images.deleted, []string{droppedKey, droppedThumb}) {
+		t.Errorf("deleted = %v, want the dropped image and its thumbnail", images.deleted)
+	}
+}
+
+func TestUpdateKeepsBlobsWhenSaveFails(t *testing.T) {
+	s, repo, images := newTestService()
+	feat := featureWithImages(t, s, images)
+	repo.saveErr = repos.ErrDBWrite
+
+	none := []string{}
+	if _, err := s.Update(context.Background(), feat.ID, dto.FeatureUpdate{Images: &none}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(images.deleted) != 0 {
+		t.Errorf("deleted %v although the update rolled back", images.deleted)
+	}
+}
+
+func TestDeleteRemovesImages(t *testing.T) {
+	s, _, images := newTestService()
+	feat := featureWithImages(t, s, images)
+
+	if err := s.Delete(context.Background(), feat.ID); err != nil {
+		t.Fatal(err)
+	}
+	if keys := images.keys(); len(keys) != 0 {
+		t.Errorf("blobs left after delete %v", keys)
+	}
+	if len(images.deleted) != 4 {
+		t.Errorf("deleted %v, want both images and thumbnails", images.deleted)
+	}
+}
+
+func sameKeys(got, want []string) bool {
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	return slices.Equal(got, want)
+}
+
+func newTestAPI(t *testing.T, s FeatureService) http.Handler {
+	t.Helper()
+	logger := crane.NewLogger(crane.NewLogFile(crane.WithFilename(filepath.Join(t.TempDir(), crane.LogName))))
+	a := Initialize(s, logger, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/features/{id}/images", a.HandleLogging(a.HandleUploadImage))
+	return mux
+}
+
+// multipartBody puts data in the named form field
+func multipartBody(t *testing.T, field string, data []byte) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile(field, "card.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data) //nolint:errcheck
+	mw.Close()     //nolint:errcheck
+	return &body, mw.FormDataContentType()
+}
+
+func TestHandleUploadImage(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        func(t *testing.T) (io.Reader, string)
+		wantStatus  int
+		wantStored  int
+		unknownFeat bool
+	}{
+		{
+			name:       "image",
+			body:       func(t *testing.T) (io.Reader, string) { return multipartBody(t, "image", testPNG(t, 16, 16)) },
+			wantStatus: http.StatusCreated,
+			wantStored: 2,
+		},
+		{
+			name: "body over the limit",
+			body: func(t *testing.T) (io.Reader, string) {
+				return multipartBody(t, "image", bytes.Repeat([]byte{1}, 2<<20))
+			},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "not a multipart form",
+			body:       func(t *testing.T) (io.Reader, string) { return strings.NewReader(`{"image":"x"}`), "application/json" },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "malformed multipart",
+			body: func(t *testing.T) (io.Reader, string) {
+				return strings.NewReader("--nope\r\ngarbage"), "multipart/form-data; boundary=other"
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing image field",
+			body:       func(t *testing.T) (io.Reader, string) { return multipartBody(t, "file", testPNG(t, 16, 16)) },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "not an image",
+			body:       func(t *testing.T) (io.Reader, string) { return multipartBody(t, "image", []byte("plain text")) },
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "unknown feature",
+			body:        func(t *testing.T) (io.Reader, string) { return multipartBody(t, "image", testPNG(t, 16, 16)) },
+			wantStatus:  http.StatusNotFound,
+			unknownFeat: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feat := domain.Feature{ID: uuid.New(), Images: []string{}, Thumbnails: map[string]string{}}
+			s, _, images := newTestService(feat)
+			h := newTestAPI(t, s)
+
+			id := feat.ID
+			if tt.unknownFeat {
+				id = uuid.New()
+			}
+			body, contentType := tt.body(t)
+			r := httptest.NewRequest(http.MethodPost, "/admin/features/"+id.String()+"/images", body)
+			r.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if n := len(images.keys()); n != tt.wantStored {
+				t.Errorf("stored %d blobs, want %d", n, tt.wantStored)
+			}
+		})
+	}
+}
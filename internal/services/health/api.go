@@ -0,0 +1,42 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/zrp9/launchl/internal/request"
+)
+
+type HealthAPI struct {
+	c Checker
+}
+
+func Initialize(c Checker) HealthAPI {
+	return HealthAPI{c: c}
+}
+
+func (a HealthAPI) Name() string {
+	return "health"
+}
+
+func (a HealthAPI) RegisterRoutes(m *http.ServeMux) {
+	m.HandleFunc("GET /healthz", a.HandleLive)
+	m.HandleFunc("GET /readyz", a.HandleReady)
+}
+
+// HandleLive only says the process is serving, it doesn't touch any dependency so a slow database
+// doesn't get the process restarted
+func (a HealthAPI) HandleLive(w http.ResponseWriter, r *http.Request) {
+	request.WriteJSON(w, http.StatusOK, request.JSON{"status": StatusUp}) //nolint:errcheck
+}
+
+// HandleReady runs every check and answers 503 while any of them fail
+func (a HealthAPI) HandleReady(w http.ResponseWriter, r *http.Request) {
+	report := a.c.Run(r.Context())
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+
+	request.WriteJSON(w, status, report) //nolint:errcheck
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/uptrace/bun/migrate"
+	"github.com/zrp9/launchl/internal/services/valkaree"
+)
+
+// Postgres pings the database
+func Postgres(db *sql.DB) Check {
+	return Check{
+		Name:     "postgres",
+		Required: true,
+		Fn:       db.PingContext,
+	}
+}
+
+// Valkey pings the server the stream lives on
+func Valkey(s *valkaree.Stream) Check {
+	return Check{
+		Name:     "valkey",
+		Required: true,
+		Fn:       s.Ping,
+	}
+}
+
+// Migrations fails while the migrator has migrations that haven't been applied
+func Migrations(m *migrate.Migrator) Check {
+	return Check{
+		Name: "migrations",
+		Fn: func(ctx context.Context) error {
+			ms, err := m.MigrationsWithStatus(ctx)
+			if err != nil {
+				return err
+			}
+
+			if pending := ms.Unapplied(); len(pending) > 0 {
+				return fmt.Errorf("%d pending migrations, first is %s", len(pending), pending[0].Name)
+			}
+			return nil
+		},
+	}
+}
+
+// StreamGroup fails until the consumer group exists on the stream
+func StreamGroup(s *valkaree.Stream, group string) Check {
+	return Check{
+		Name: "streamGroup",
+		Fn: func(ctx context.Context) error {
+			groups, err := s.Groups(ctx)
+			if err != nil {
+				return err
+			}
+
+			if !slices.ContainsFunc(groups, func(g valkaree.GroupInfo) bool { return g.Name == group }) {
+				return fmt.Errorf("group %s does not exist on stream %s", group, s.Key)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,118 @@
+// Package health reports whether the process is alive and whether its dependencies are ready
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Second
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// CheckFunc returns nil when the dependency is usable
+type CheckFunc func(ctx context.Context) error
+
+// Check is one dependency, required checks also have to pass before the server starts
+type Check struct {
+	Name     string
+	Required bool
+	Fn       CheckFunc
+}
+
+type Result struct {
+	Status    string  `json:"status"`
+	Required  bool    `json:"required"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready is true when every check passed
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+func New(checks ...Check) Checker {
+	return Checker{
+		checks:  checks,
+		timeout: defaultTimeout,
+	}
+}
+
+// Run runs every check at once, each with its own timeout so one hung dependency can't hold up the rest
+func (c Checker) Run(ctx context.Context) Report {
+	report := Report{Status: StatusReady, Checks: make(map[string]Result, len(c.checks))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = res
+			if res.Status != StatusUp {
+				report.Status = StatusNotReady
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Startup runs the required checks and returns why any of them failed
+func (c Checker) Startup(ctx context.Context) error {
+	var errs []error
+	for _, check := range c.checks {
+		if !check.Required {
+			continue
+		}
+		if res := c.run(ctx, check); res.Status != StatusUp {
+			errs = append(errs, fmt.Errorf("%s is unavailable: %s", check.Name, res.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Fn(ctx)
+	res := Result{
+		Status:    StatusUp,
+		Required:  check.Required,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusDown
+		res.Error = err.Error()
+	}
+
+	return res
+}
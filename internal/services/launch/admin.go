@@ -0,0 +1,135 @@
+package launch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/request"
+	"github.com/zrp9/launchl/internal/services"
+)
+
+func (u LaunchAPI) HandleAdminUpdateUser(w http.ResponseWriter, r *http.Request) error {
+	if err := r.Context().Err(); err != nil {
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
+	}
+
+	usrname, err := request.ParseUsername(r)
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	var payload dto.AdminUserUpdate
+	if err := request.ParseJSON(r, &payload); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := payload.Validate(); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	usr, err := u.s.AdminUpdateUser(r.Context(), usrname, payload)
+	if err != nil {
+		if errors.Is(err, repos.ErrNoRecords) {
+			return services.APIErr{Status: http.StatusNotFound, Err: err}
+		}
+		if errors.Is(err, repos.ErrConflict) {
+			return services.APIErr{Status: http.StatusConflict, Err: err}
+		}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+	}
+
+	res := request.JSON{
+		"user": usr,
+	}
+
+	return request.WriteJSON(w, http.StatusOK, res)
+}
+
+// HandleInviteWave invites the next size users in line
+func (u LaunchAPI) HandleInviteWave(w http.ResponseWriter, r *http.Request) error {
+	if err := r.Context().Err(); err != nil {
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
+	}
+
+	var payload dto.InviteWave
+	if err := request.ParseJSON(r, &payload); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := payload.Validate(); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	waveID, invited, err := u.s.InviteWave(r.Context(), payload.Size)
+	if err != nil {
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+	}
+
+	res := request.JSON{
+		"wave":    waveID,
+		"invited": invited,
+	}
+
+	return request.WriteJSON(w, http.StatusOK, res)
+}
+
+// maxImportSize caps the multipart body of an import, the csv itself is streamed from it
+const maxImportSize = 64 << 20
+
+// HandleImportUsers takes a multipart form with the csv in file, an optional json mapping of
+// user fields to csv headers, batchSize and sendWelcome
+func (u LaunchAPI) HandleImportUsers(w http.ResponseWriter, r *http.Request) error {
+	if err := r.Context().Err(); err != nil {
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
+	}
+
+	// large files take longer to upload and insert than the server timeouts allow
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})  //nolint:errcheck
+	rc.SetWriteDeadline(time.Time{}) //nolint:errcheck
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+	defer file.Close() //nolint:errcheck
+
+	opts := ImportOptions{SendWelcome: request.ParseBool(r.FormValue("sendWelcome"))}
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts.Mapping); err != nil {
+			return services.APIErr{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+	if raw := r.FormValue("batchSize"); raw != "" {
+		if opts.BatchSize, err = strconv.Atoi(raw); err != nil {
+			return services.APIErr{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	report, err := u.s.ImportSubscribers(r.Context(), file, opts)
+	if err != nil {
+		if errors.Is(err, ErrImportMapping) {
+			return services.APIErr{Status: http.StatusBadRequest, Err: err}
+		}
+		if report == nil {
+			return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+		}
+		// batches before the failure are committed, report what made it in
+		u.logger.MustError(err)
+		p := services.Problem(r, services.APIErr{Status: http.StatusInternalServerError, Err: err})
+		p.Extensions = request.JSON{"report": report}
+		return request.WriteProblem(w, p)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"report": report})
+}
@@ -2,26 +2,41 @@
 package launch
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
-	"sync"
 
+	"github.com/zrp9/launchl/internal/auth"
 	"github.com/zrp9/launchl/internal/crane"
 	"github.com/zrp9/launchl/internal/domain"
 	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/idempotency"
+	"github.com/zrp9/launchl/internal/middleware"
+	"github.com/zrp9/launchl/internal/ratelimit"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/auditrepo"
+	"github.com/zrp9/launchl/internal/repos/referalrepo"
+	"github.com/zrp9/launchl/internal/repos/surveyrepo"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
 	"github.com/zrp9/launchl/internal/request"
-	"golang.org/x/sync/errgroup"
+	"github.com/zrp9/launchl/internal/services"
+	"github.com/zrp9/launchl/internal/services/survey"
 )
 
 type LaunchAPI struct {
 	s      LaunchService
 	logger *crane.Zlogrus
+	limits *ratelimit.Limits
+	idem   *idempotency.Guard
 }
 
-func Initialize(s LaunchService, l *crane.Zlogrus) LaunchAPI {
+func Initialize(s LaunchService, l *crane.Zlogrus, limits *ratelimit.Limits, idem *idempotency.Guard) LaunchAPI {
 	return LaunchAPI{
 		s:      s,
 		logger: l,
+		limits: limits,
+		idem:   idem,
 	}
 }
 
@@ -37,34 +52,37 @@ func (u LaunchAPI) Name() string {
 func (u LaunchAPI) RegisterRoutes(m *http.ServeMux) {
 	// this is how i could have the main registerRoutes func call pass in prefixes
 	//m.HandleFunc(fmt.Sprintf("GET /%v", prefix), u.HandleFetchUsers)
-	m.HandleFunc("POST /user/subscribe", u.HandleLogging(u.HandleSubscribe))
+	// direct and referred signups share a bucket so bots can't double up by switching endpoints
+	// the email bucket catches one address signed up again and again from rotating ips
+	subscribe := func(next http.Handler) http.HandlerFunc {
+		return u.limits.For("subscribe")(u.limits.ByEmail("subscribe-email")(next))
+	}
+	// retried posts replay the first response instead of failing as duplicates or rewarding twice, the
+	// guard sits outside the limiter so replays don't use up the callers rate limit
+	m.HandleFunc("POST /user/subscribe", u.idem.Wrap(subscribe(u.HandleLogging(u.HandleSubscribe))))
+	// subscribers are signed in by a cookie set on signup or by the sign in link in their emails
+	m.HandleFunc("GET /user/session", u.limits.For("session")(u.HandleLogging(u.HandleSession)))
 	m.HandleFunc("GET /user/{username}", u.HandleLogging(u.HandleGetUser))
 	// get users number in queue
-	m.HandleFunc("GET /user/{username}/position", u.HandleLogging(u.HandleCheckQueue))
-	m.HandleFunc("POST /user/{username}/survey", u.HandleLogging(u.HandleSurvey))
-	m.HandleFunc("POST /user/referred/{urlId}", u.HandleLogging(u.HandleSubscribeRefered))
+	m.HandleFunc("GET /user/{username}/position", u.limits.For("position")(u.HandleLogging(u.HandleCheckQueue)))
+	// survey routes use the configured campaign unless the request names one with ?campaign=
+	m.HandleFunc("POST /user/{username}/survey", u.idem.Wrap(u.limits.For("survey")(u.HandleLogging(u.HandleSurvey))))
+	m.HandleFunc("GET /survey/active", u.HandleLogging(u.HandleActiveSurvey))
+	m.HandleFunc("POST /user/referred/{urlId}", u.idem.Wrap(subscribe(u.HandleLogging(u.HandleSubscribeRefered))))
+
+	admin := middleware.Authorize(middleware.AdminRole)
+	m.HandleFunc("POST /admin/users/import", admin(u.idem.Wrap(u.HandleLogging(u.HandleImportUsers))))
+	m.HandleFunc("POST /admin/invites", admin(u.idem.Wrap(u.HandleLogging(u.HandleInviteWave))))
+	m.HandleFunc("PATCH /admin/users/{username}", admin(u.HandleLogging(u.HandleAdminUpdateUser)))
+	m.HandleFunc("DELETE /admin/users/{username}", admin(u.HandleLogging(u.HandleDeleteUser)))
+	m.HandleFunc("GET /admin/users", admin(u.HandleLogging(services.HandleList("users", userrepo.Fields, u.s.ListUsers))))
+	m.HandleFunc("GET /admin/referals", admin(u.HandleLogging(services.HandleList("referals", referalrepo.Fields, u.s.ListReferals))))
+	m.HandleFunc("GET /admin/survey/responses", admin(u.HandleLogging(services.HandleList("responses", surveyrepo.ResponseFields, u.s.ListSurveyResponses))))
+	m.HandleFunc("GET /admin/audit", admin(u.HandleLogging(services.HandleList("entries", auditrepo.Fields, u.s.FindAuditEntries))))
 }
 
-type APIHandler func(w http.ResponseWriter, r *http.Request) error
-
-type APIErr struct {
-	Status int
-	Err    error
-}
-
-func (a APIErr) Error() string {
-	return a.Err.Error()
-}
-
-func (u LaunchAPI) HandleLogging(hn APIHandler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := hn(w, r); err != nil {
-			if e, ok := err.(APIErr); ok {
-				request.WriteErr(w, e.Status, e)
-			}
-			u.logger.MustError(err)
-		}
-	}
+func (u LaunchAPI) HandleLogging(hn services.APIHandler) http.HandlerFunc {
+	return services.Handle(u.logger, hn)
 }
 
 func (u LaunchAPI) HandleSubscribe(w http.ResponseWriter, r *http.Request) error {
@@ -77,7 +95,7 @@ func (u LaunchAPI) HandleSubscribe(w http.ResponseWriter, r *http.Request) error
 		return u.ReturnErr(http.StatusBadRequest, err)
 	}
 
-	if err := u.s.validator.Struct(payload); err != nil {
+	if err := u.s.ValidateSubscriber(&payload); err != nil {
 		return u.ReturnErr(http.StatusBadRequest, err)
 	}
 
@@ -92,6 +110,7 @@ func (u LaunchAPI) HandleSubscribe(w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return u.ReturnErr(http.StatusInternalServerError, err)
 	}
+	u.startSession(r.Context(), w, nUser)
 
 	res := request.JSON{
 		"user": nUser,
@@ -107,12 +126,17 @@ func (u LaunchAPI) HandleDeleteUser(w http.ResponseWriter, r *http.Request) erro
 
 	usrname, err := request.ParseUsername(r)
 	if err != nil {
-		return APIErr{Status: http.StatusBadRequest, Err: err}
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
 	}
 
-	err = u.s.DeleteUserByUsername(r.Context(), usrname)
+	// users are soft deleted so referals that rewarded others survive, hard=true removes the row
+	if request.ParseBool(r.URL.Query().Get("hard")) {
+		err = u.s.HardDeleteUserByUsername(r.Context(), usrname)
+	} else {
+		err = u.s.DeleteUserByUsername(r.Context(), usrname)
+	}
 	if err != nil {
-		return APIErr{Status: http.StatusInternalServerError, Err: err}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
 	}
 
 	res := request.JSON{
@@ -124,7 +148,7 @@ func (u LaunchAPI) HandleDeleteUser(w http.ResponseWriter, r *http.Request) erro
 
 func (u LaunchAPI) HandleGetUser(w http.ResponseWriter, r *http.Request) error {
 	if err := r.Context().Err(); err != nil {
-		return APIErr{
+		return services.APIErr{
 			Status: http.StatusGatewayTimeout,
 			Err:    err,
 		}
@@ -132,12 +156,12 @@ func (u LaunchAPI) HandleGetUser(w http.ResponseWriter, r *http.Request) error {
 
 	usrname, err := request.ParseUsername(r)
 	if err != nil {
-		return APIErr{Status: http.StatusBadRequest, Err: err}
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
 	}
 
 	usr, err := u.s.GetUserByUsername(r.Context(), usrname)
 	if err != nil {
-		return APIErr{Status: http.StatusInternalServerError, Err: err}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
 	}
 
 	res := request.JSON{
@@ -149,11 +173,11 @@ func (u LaunchAPI) HandleGetUser(w http.ResponseWriter, r *http.Request) error {
 
 func (u LaunchAPI) HandleFetchUsers(w http.ResponseWriter, r *http.Request) error {
 	if err := r.Context().Err(); err != nil {
-		return APIErr{Status: http.StatusGatewayTimeout, Err: err}
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
 	}
 	usrs, err := u.s.GetAllUsers(r.Context())
 	if err != nil {
-		return APIErr{Status: http.StatusInternalServerError, Err: err}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
 	}
 
 	res := request.JSON{
@@ -165,17 +189,17 @@ func (u LaunchAPI) HandleFetchUsers(w http.ResponseWriter, r *http.Request) erro
 
 func (u LaunchAPI) HandleCheckQueue(w http.ResponseWriter, r *http.Request) error {
 	if err := r.Context().Err(); err != nil {
-		return APIErr{Status: http.StatusGatewayTimeout, Err: err}
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
 	}
 
 	usrname, err := request.ParseUsername(r)
 	if err != nil {
-		return APIErr{Status: http.StatusBadRequest, Err: err}
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
 	}
 
 	position, err := u.s.CheckQue(r.Context(), usrname)
 	if err != nil {
-		request.WriteErr(w, http.StatusBadRequest, err)
+		return err
 	}
 
 	res := request.JSON{
@@ -187,90 +211,133 @@ func (u LaunchAPI) HandleCheckQueue(w http.ResponseWriter, r *http.Request) erro
 
 func (u LaunchAPI) HandleSurvey(w http.ResponseWriter, r *http.Request) error {
 	if err := r.Context().Err(); err != nil {
-		return APIErr{Status: http.StatusGatewayTimeout, Err: err}
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
 	}
+
+	usrname, err := request.ParseUsername(r)
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
 	var payload dto.SurveyResponses
 	if err := request.ParseJSON(r, &payload); err != nil {
-		request.WriteBadResponse(w, err)
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
 	}
 
 	if errs := payload.Validate(); len(errs) > 0 {
-		return APIErr{Status: http.StatusBadRequest, Err: errors.Join(errs...)}
+		return services.APIErr{Status: http.StatusBadRequest, Err: errors.Join(errs...)}
 	}
 
-	var wg sync.WaitGroup
-	for _, anwser := range payload {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := u.s.AddSurveyResponses(r.Context(), anwser.UserID, anwser.QuestionID, anwser.OptionID, anwser.TextAnwser); err != nil {
-				u.logger.MustError(err)
-			}
-		}()
+	sub, err := u.s.SubmitSurvey(r.Context(), usrname, u.s.Campaign(r.URL.Query().Get("campaign")), payload)
+	if err != nil {
+		var answerErrs survey.AnswerErrs
+		switch {
+		case errors.As(err, &answerErrs):
+			return services.APIErr{Status: http.StatusUnprocessableEntity, Err: answerErrs}
+		case errors.Is(err, repos.ErrNoRecords):
+			return services.APIErr{Status: http.StatusNotFound, Err: errors.New("user or active survey not found")}
+		default:
+			return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+		}
 	}
 
-	wg.Wait()
 	res := request.JSON{
-		"status": 201,
+		"submissionId": sub.ID,
+		"submittedAt":  sub.UpdatedAt,
 	}
 
 	return request.WriteJSON(w, http.StatusCreated, res)
 }
 
+func (u LaunchAPI) HandleActiveSurvey(w http.ResponseWriter, r *http.Request) error {
+	if err := r.Context().Err(); err != nil {
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
+	}
+
+	active, err := u.s.GetActiveSurvey(r.Context(), u.s.Campaign(r.URL.Query().Get("campaign")))
+	if err != nil {
+		if errors.Is(err, repos.ErrNoRecords) {
+			return services.APIErr{Status: http.StatusNotFound, Err: errors.New("there is no active survey")}
+		}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+	}
+
+	res := request.JSON{
+		"survey": active,
+	}
+
+	return request.WriteJSON(w, http.StatusOK, res)
+}
+
 func (u LaunchAPI) HandleSubscribeRefered(w http.ResponseWriter, r *http.Request) error {
 	if err := r.Context().Err(); err != nil {
-		return APIErr{Status: http.StatusGatewayTimeout, Err: err}
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
 	}
 
 	var payload domain.User
 
 	usrname, err := request.ParseUsername(r)
 	if err != nil {
-		return APIErr{Status: http.StatusBadRequest, Err: err}
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
 	}
 
 	urlID, err := request.ParseURLID(r)
 	if err != nil {
-		return APIErr{Status: http.StatusBadRequest, Err: err}
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
 	}
 
 	if err = request.ParseJSON(r, &payload); err != nil {
-		return APIErr{Status: http.StatusInternalServerError, Err: err}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
 	}
 
-	usr, err := u.s.CreateUser(r.Context(), &payload)
+	usr, err := u.s.SubscribeReferred(r.Context(), &payload, usrname, urlID)
 	if err != nil {
-		return APIErr{Status: http.StatusInternalServerError, Err: err}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
 	}
+	u.startSession(r.Context(), w, usr)
 
-	referer, err := u.s.GetReferer(r.Context(), usrname, urlID)
-	if err != nil {
-		return err
+	res := request.JSON{
+		"user": usr,
 	}
 
-	eg, ctx := errgroup.WithContext(r.Context())
+	return request.WriteJSON(w, http.StatusOK, res)
+}
 
-	eg.Go(func() error {
-		return u.s.RewardReferer(ctx, referer)
-	})
+// startSession signs a new subscriber in so they can vote straight away. The signup already went
+// through so a token that can't be signed is only logged, the welcome email has a sign in link.
+func (u LaunchAPI) startSession(ctx context.Context, w http.ResponseWriter, usr *domain.User) {
+	token, expires, err := auth.GenerateSessionToken(usr.ID.String(), usr.Username)
+	if err != nil {
+		u.logger.Ctx(ctx).MustError(fmt.Errorf("failed to sign session token %w", err))
+		return
+	}
+	middleware.SetToken(w, token, expires)
+}
 
-	eg.Go(func() error {
-		return u.s.CreateReferal(ctx, usr.ID, referer.ID)
-	})
+// HandleSession exchanges the token of a sign in link from an email for a fresh token cookie
+func (u LaunchAPI) HandleSession(w http.ResponseWriter, r *http.Request) error {
+	if err := r.Context().Err(); err != nil {
+		return services.APIErr{Status: http.StatusGatewayTimeout, Err: err}
+	}
 
-	if err := eg.Wait(); err != nil {
-		return APIErr{Status: http.StatusInternalServerError, Err: err}
+	usr, token, expires, err := u.s.Session(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		if errors.Is(err, ErrInvalidSession) {
+			return services.APIErr{Status: http.StatusUnauthorized, Err: ErrInvalidSession}
+		}
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
 	}
+	middleware.SetToken(w, token, expires)
 
 	res := request.JSON{
-		"users": "",
+		"username": usr.Username,
 	}
 
 	return request.WriteJSON(w, http.StatusOK, res)
 }
 
-func (u LaunchAPI) ReturnErr(status int, err error) APIErr {
-	return APIErr{
+func (u LaunchAPI) ReturnErr(status int, err error) services.APIErr {
+	return services.APIErr{
 		Status: status,
 		Err:    err,
 	}
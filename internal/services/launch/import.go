@@ -0,0 +1,364 @@
+package launch
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	v "github.com/go-playground/validator/v10"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/metrics"
+	"github.com/zrp9/launchl/internal/repos"
+)
+
+const defaultImportBatch = 500
+
+var ErrImportMapping = errors.New("invalid import column mapping")
+
+const errAlreadySubscribed = "email is already subscribed"
+
+// importFields are the user fields an import can fill
+var importFields = []string{"email", "firstName", "lastName", "phone", "companyName", "wouldUse", "comments", "createdAt"}
+
+// signupLayouts are the timestamp formats other waitlist tools commonly export
+var signupLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"01/02/2006 15:04:05",
+	"01/02/2006",
+}
+
+type ImportOptions struct {
+	// Mapping maps user fields to csv headers, unmapped fields use the header with the same name
+	Mapping     map[string]string `json:"mapping"`
+	BatchSize   int               `json:"batchSize"`
+	SendWelcome bool              `json:"sendWelcome"`
+}
+
+// RowErr explains why a csv row was not imported, rows are numbered like a spreadsheet with the header as row 1
+type RowErr struct {
+	Row    int      `json:"row"`
+	Email  string   `json:"email,omitempty"`
+	Errors []string `json:"errors"`
+}
+
+type ImportReport struct {
+	Rows       int      `json:"rows"`
+	Imported   int      `json:"imported"`
+	Duplicates int      `json:"duplicates"`
+	Failed     int      `json:"failed"`
+	Errors     []RowErr `json:"errors"`
+}
+
+// importRow is a subscriber read from the csv, signedUp is when they joined the list in the tool they
+// came from and is kept apart from the user so only imports can set a signup time
+type importRow struct {
+	row      int
+	user     domain.User
+	signedUp time.Time
+}
+
+// rowFailure is a row whose insert was rolled back to its savepoint
+type rowFailure struct {
+	row importRow
+	err error
+}
+
+// ImportSubscribers creates a subscriber for every valid row of the csv in r. Rows are checked with the
+// signup rules, deduplicated by normalized email against the file and the database and inserted in
+// batches of one transaction each. A row that fails to insert is reported with its own error and the
+// rest of its batch still goes in. Original signup times are kept so imported users keep their place
+// in line.
+func (ls LaunchService) ImportSubscribers(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not read header %v", ErrImportMapping, err)
+	}
+
+	cols, err := importColumns(header, opts.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := ls.cfgRepo.Get(ctx, "subscriber")
+	if err != nil {
+		return nil, err
+	}
+
+	size := opts.BatchSize
+	if size <= 0 {
+		size = defaultImportBatch
+	}
+
+	report := &ImportReport{Errors: make([]RowErr, 0)}
+	firstSeen := make(map[string]int)
+	batch := make([]importRow, 0, size)
+	line := 1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line++
+		report.Rows++
+		if err != nil {
+			report.fail(line, "", err.Error())
+			continue
+		}
+
+		usr, signedUp, msgs := ls.importUser(record, cols)
+		if len(msgs) > 0 {
+			report.fail(line, usr.Email, msgs...)
+			continue
+		}
+
+		if first, ok := firstSeen[usr.Email]; ok {
+			report.duplicate(line, usr.Email, fmt.Sprintf("duplicate of row %d", first))
+			continue
+		}
+		firstSeen[usr.Email] = line
+
+		usr.Role = &role
+		batch = append(batch, importRow{row: line, user: usr, signedUp: signedUp})
+		if len(batch) == size {
+			if err := ls.importBatch(ctx, batch, opts.SendWelcome, report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := ls.importBatch(ctx, batch, opts.SendWelcome, report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// importBatch only returns an error when the import can't continue, row failures go in the report
+func (ls LaunchService) importBatch(ctx context.Context, batch []importRow, sendWelcome bool, report *ImportReport) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	emails := make([]string, 0, len(batch))
+	for _, b := range batch {
+		emails = append(emails, b.user.Email)
+	}
+
+	existing, err := ls.usrRepo.ExistingEmails(ctx, emails)
+	if err != nil {
+		return err
+	}
+
+	fresh := make([]importRow, 0, len(batch))
+	for _, b := range batch {
+		if existing[b.user.Email] {
+			report.duplicate(b.row, b.user.Email, errAlreadySubscribed)
+			continue
+		}
+		if err := prepareUser(&b.user); err != nil {
+			report.fail(b.row, b.user.Email, err.Error())
+			continue
+		}
+		fresh = append(fresh, b)
+	}
+
+	signedUp := make([]time.Time, len(fresh))
+	for i, b := range fresh {
+		signedUp[i] = placeAt(b.signedUp)
+	}
+
+	var created []*domain.User
+	var failed []rowFailure
+	err = ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		created, failed = created[:0], failed[:0]
+		positions, err := ls.usrRepo.PlaceAll(ctx, signedUp)
+		if err != nil {
+			return err
+		}
+
+		// each row gets a savepoint so a bad row is reported with its own error and the rest still go in,
+		// the places of rows that didn't make it are given back afterwards
+		var unused []int64
+		for i := range fresh {
+			row := &fresh[i]
+			row.user.QuePosition = positions[i]
+			var usr *domain.User
+			err := ls.tx.Savepoint(ctx, func(ctx context.Context) error {
+				var err error
+				usr, err = ls.insertUser(ctx, &row.user, row.signedUp)
+				return err
+			})
+			if err != nil {
+				failed = append(failed, rowFailure{row: *row, err: err})
+				unused = append(unused, positions[i])
+				continue
+			}
+			created = append(created, usr)
+		}
+
+		return ls.usrRepo.Unplace(ctx, unused)
+	})
+	if err != nil {
+		for _, b := range fresh {
+			report.fail(b.row, b.user.Email, fmt.Sprintf("batch was rolled back %v", err))
+		}
+		return nil
+	}
+
+	for _, f := range failed {
+		if errors.Is(f.err, repos.ErrDuplicate) {
+			report.duplicate(f.row.row, f.row.user.Email, errAlreadySubscribed)
+			continue
+		}
+		report.fail(f.row.row, f.row.user.Email, f.err.Error())
+	}
+
+	report.Imported += len(created)
+	metrics.Signups(metrics.SignupImport, len(created))
+	if sendWelcome {
+		for _, usr := range created {
+			ls.sendWelcome(ctx, usr)
+		}
+	}
+
+	return nil
+}
+
+func (ls LaunchService) importUser(record []string, cols map[string]int) (domain.User, time.Time, []string) {
+	get := func(field string) string {
+		i, ok := cols[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	usr := domain.User{
+		Email:       get("email"),
+		FirstName:   get("firstName"),
+		LastName:    get("lastName"),
+		Phone:       get("phone"),
+		CompanyName: get("companyName"),
+		Comments:    get("comments"),
+	}
+
+	var msgs []string
+	if raw := get("wouldUse"); raw != "" {
+		would, err := parseImportBool(raw)
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+		usr.WouldUse = would
+	}
+
+	var signedUp time.Time
+	if raw := get("createdAt"); raw != "" {
+		t, err := parseSignupTime(raw)
+		if err != nil {
+			msgs = append(msgs, err.Error())
+		}
+		signedUp = t
+	}
+
+	if err := ls.ValidateSubscriber(&usr); err != nil {
+		var verrs v.ValidationErrors
+		if !errors.As(err, &verrs) {
+			return usr, signedUp, append(msgs, err.Error())
+		}
+		for _, fe := range verrs {
+			msgs = append(msgs, fmt.Sprintf("%s failed %s", fe.Field(), fe.Tag()))
+		}
+	}
+
+	return usr, signedUp, msgs
+}
+
+// importColumns resolves the csv column index of every mapped field, headers match case insensitively
+func importColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	known := make(map[string]bool, len(importFields))
+	for _, f := range importFields {
+		known[f] = true
+	}
+	for field := range mapping {
+		if !known[field] {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrImportMapping, field)
+		}
+	}
+
+	cols := make(map[string]int)
+	for _, field := range importFields {
+		name, mapped := mapping[field]
+		if !mapped {
+			name = field
+		}
+
+		i, ok := index[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			if mapped {
+				return nil, fmt.Errorf("%w: column %q for %s is not in the header", ErrImportMapping, name, field)
+			}
+			continue
+		}
+		cols[field] = i
+	}
+
+	if _, ok := cols["email"]; !ok {
+		return nil, fmt.Errorf("%w: an email column is required", ErrImportMapping)
+	}
+
+	return cols, nil
+}
+
+func parseImportBool(raw string) (bool, error) {
+	switch strings.ToLower(raw) {
+	case "yes", "y":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("wouldUse %q is not a yes/no value", raw)
+	}
+	return b, nil
+}
+
+func parseSignupTime(raw string) (time.Time, error) {
+	for _, layout := range signupLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("createdAt %q is not a recognised timestamp", raw)
+}
+
+func (r *ImportReport) fail(row int, email string, msgs ...string) {
+	r.Failed++
+	r.Errors = append(r.Errors, RowErr{Row: row, Email: email, Errors: msgs})
+}
+
+func (r *ImportReport) duplicate(row int, email, msg string) {
+	r.Duplicates++
+	r.Errors = append(r.Errors, RowErr{Row: row, Email: email, Errors: []string{msg}})
+}
@@ -3,23 +3,40 @@ package launch
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	v "github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/auth"
 	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/database/store"
 	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/dto"
 	"github.com/zrp9/launchl/internal/eml"
+	"github.com/zrp9/launchl/internal/metrics"
+	"github.com/zrp9/launchl/internal/repos"
 	"github.com/zrp9/launchl/internal/repos/configrepo"
 	"github.com/zrp9/launchl/internal/repos/referalrepo"
 	"github.com/zrp9/launchl/internal/repos/surveyrepo"
 	usr "github.com/zrp9/launchl/internal/repos/userrepo"
+	"github.com/zrp9/launchl/internal/services"
+	"github.com/zrp9/launchl/internal/services/audit"
 	"github.com/zrp9/launchl/internal/services/noti"
+	"github.com/zrp9/launchl/internal/services/reward"
+	"github.com/zrp9/launchl/internal/services/survey"
 	"github.com/zrp9/launchl/internal/services/valkaree"
 )
 
+const conflictRetries = 3
+
+// ErrInvalidSession is returned for a sign in link that is expired, forged or for a user who is gone
+var ErrInvalidSession = errors.New("sign in link is invalid or expired")
+
 var (
 	notificationType   = "email"
 	notificationTarget = "email-consumer"
@@ -27,60 +44,245 @@ var (
 )
 
 type LaunchService struct {
+	tx           store.Transactor
 	usrRepo      usr.UserRepo
+	surveyRepo   surveyrepo.SurveyRepo
 	questnRepo   surveyrepo.ResponseRepo
+	submissions  surveyrepo.SubmissionRepo
 	refRepo      referalrepo.ReferalRepo
 	log          crane.Zlogrus
 	cfgRepo      configrepo.RoleRepo
 	streamWriter valkaree.StreamWriter
 	validator    *v.Validate
+	audit        audit.Recorder
+	rewards      reward.Rewarder
+	tasks        *services.Tasks
+	campaign     string
 }
 
-func New(u usr.UserRepo, q surveyrepo.ResponseRepo, r referalrepo.ReferalRepo, cfg configrepo.RoleRepo, writer valkaree.StreamWriter, v *v.Validate) LaunchService {
+func New(tx store.Transactor, u usr.UserRepo, sr surveyrepo.SurveyRepo, q surveyrepo.ResponseRepo, sub surveyrepo.SubmissionRepo, r referalrepo.ReferalRepo, cfg configrepo.RoleRepo, writer valkaree.StreamWriter, v *v.Validate, a audit.Recorder, rw reward.Rewarder, t *services.Tasks, campaign string) LaunchService {
 	return LaunchService{
+		log:          *crane.DefaultLogger,
+		tx:           tx,
 		usrRepo:      u,
+		surveyRepo:   sr,
 		questnRepo:   q,
+		submissions:  sub,
 		refRepo:      r,
 		cfgRepo:      cfg,
 		streamWriter: writer,
 		validator:    v,
+		audit:        a,
+		rewards:      rw,
+		tasks:        t,
+		campaign:     campaign,
 	}
 }
 
 func (ls LaunchService) CreateUser(ctx context.Context, usr *domain.User) (*domain.User, error) {
+	u, err := ls.createUser(ctx, usr, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.Signups(metrics.SignupDirect, 1)
+	ls.sendWelcome(ctx, u)
+	return u, nil
+}
+
+// SubscribeReferred creates the referee, rewards the referer and records the referal in one transaction.
+// The welcome email is only queued once the transaction commits.
+func (ls LaunchService) SubscribeReferred(ctx context.Context, usr *domain.User, refererUsername, urlID string) (*domain.User, error) {
+	var created *domain.User
+	err := ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		referer, err := ls.GetReferer(ctx, refererUsername, urlID)
+		if err != nil {
+			return err
+		}
+
+		created, err = ls.createUser(ctx, usr, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		if err := ls.RewardReferer(ctx, referer); err != nil {
+			return err
+		}
+
+		return ls.CreateReferal(ctx, referer.ID, created.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.Signups(metrics.SignupReferred, 1)
+	metrics.Referral()
+	ls.sendWelcome(ctx, created)
+	return created, nil
+}
+
+// ValidateSubscriber normalizes the email and checks a new subscriber, signups and imports share these
+// rules. The id, role and position are assigned when the user is created so they aren't checked here.
+func (ls LaunchService) ValidateSubscriber(usr *domain.User) error {
+	usr.Email = eml.Normalize(usr.Email)
+	return ls.validator.StructExcept(usr, "ID", "RoleID", "Role", "QuePosition")
+}
+
+// createUser places the user in line and inserts them. A zero signedUp is a signup happening now, imports
+// pass the time the user signed up with the tool they came from so they keep their place.
+func (ls LaunchService) createUser(ctx context.Context, usr *domain.User, signedUp time.Time) (*domain.User, error) {
+	if err := prepareUser(usr); err != nil {
+		return nil, err
+	}
+
+	var created *domain.User
+	err := ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		usr.QuePosition, err = ls.usrRepo.Place(ctx, placeAt(signedUp))
+		if err != nil {
+			return err
+		}
+
+		created, err = ls.insertUser(ctx, usr, signedUp)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// prepareUser gives a new subscriber their id and username, the que position is picked when they're inserted
+func prepareUser(usr *domain.User) error {
 	var err error
+	if usr.Role != nil {
+		usr.RoleID = usr.Role.ID
+	}
+	// only an admin can verify a subscriber, a signup body can't claim it
+	usr.VerifiedAt = time.Time{}
+
 	usr.ID, err = uuid.NewRandom()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	emailBase := eml.StripDomain(usr.Email)
 	if emailBase == "" {
-		return nil, fmt.Errorf("email address is required to generate username")
+		return fmt.Errorf("email address is required to generate username")
 	}
 
 	usr.Username = emailBase
+	return nil
+}
+
+// insertUser writes a prepared and placed user, imports keep their original signup time
+func (ls LaunchService) insertUser(ctx context.Context, usr *domain.User, signedUp time.Time) (*domain.User, error) {
+	if signedUp.IsZero() {
+		return ls.usrRepo.Create(ctx, usr)
+	}
+	return ls.usrRepo.Import(ctx, usr, signedUp)
+}
+
+// placeAt is the time a user is placed in line by, a zero signedUp is a signup happening now
+func placeAt(signedUp time.Time) time.Time {
+	if signedUp.IsZero() {
+		return time.Now()
+	}
+	return signedUp
+}
+
+// sendWelcome queues the welcome email without holding up the signup
+func (ls LaunchService) sendWelcome(ctx context.Context, usr *domain.User) {
+	ls.sendEmail(ctx, usr, "welcome", "Welcome to launch list")
+}
 
-	u, err := ls.usrRepo.Create(ctx, usr)
+// sendEmail queues an email from template without holding up the request, the job keeps the request id
+// from ctx but not its cancellation so the write outlives the request. The goroutine is tracked so
+// shutdown waits for it. Every email carries a session token for a sign in link to GET /user/session.
+func (ls LaunchService) sendEmail(ctx context.Context, usr *domain.User, template, subject string) {
+	ctx = context.WithoutCancel(ctx)
+	ls.tasks.Go(func() {
+		token, _, err := auth.GenerateSessionToken(usr.ID.String(), usr.Username)
+		if err != nil {
+			ls.log.Ctx(ctx).MustError(fmt.Errorf("failed to sign %s email session token %w", template, err))
+			return
+		}
+
+		data, err := ls.createEmailPayload(usr, template, subject, map[string]any{
+			"username":     usr.Username,
+			"sessionToken": token,
+		})
+		if err != nil {
+			ls.log.Ctx(ctx).MustTrace("could not create email json payload for notification stream")
+			return
+		}
+
+		msgID, err := ls.streamWriter.WriteJob(ctx, notificationType, notificationTarget, notificationSrc, data)
+		if err != nil {
+			ls.log.Ctx(ctx).MustError(fmt.Errorf("failed to write %s job to stream %w", template, err))
+			return
+		}
+		ls.log.Ctx(ctx).With(crane.Zfields{"messageId": msgID}).MustDebug(template + " job written to stream")
+	})
+}
+
+// Session checks a sign in link token still belongs to a subscriber and issues them a fresh one
+func (ls LaunchService) Session(ctx context.Context, token string) (*domain.User, string, time.Time, error) {
+	claims, err := auth.ValidateToken(token)
 	if err != nil {
-		return nil, err
+		return nil, "", time.Time{}, errors.Join(ErrInvalidSession, err)
+	}
+
+	usr, err := ls.usrRepo.GetByUsername(ctx, claims.Username)
+	if err != nil {
+		if errors.Is(err, repos.ErrNoRecords) {
+			return nil, "", time.Time{}, errors.Join(ErrInvalidSession, err)
+		}
+		return nil, "", time.Time{}, err
+	}
+	if usr.ID.String() != claims.ID {
+		return nil, "", time.Time{}, ErrInvalidSession
 	}
 
-	// TODO: start here
-	go func() {
-		// returns message id, err
-		data, err := ls.createEmailPayload(usr, "welcome", "Welcome to launch list")
+	fresh, expires, err := auth.GenerateSessionToken(usr.ID.String(), usr.Username)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	return usr, fresh, expires, nil
+}
+
+// InviteWave lets in the next size users in line that haven't been invited yet and emails them their
+// invite once the wave is committed. The wave is audited as one entry listing who it let in.
+func (ls LaunchService) InviteWave(ctx context.Context, size int) (uuid.UUID, []*domain.User, error) {
+	waveID := uuid.New()
+	var invited []*domain.User
+	err := ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		invited, err = ls.usrRepo.InviteNext(ctx, size)
 		if err != nil {
-			ls.log.MustTrace("could not create email json payload for notification stream")
+			return err
 		}
-		if _, err := ls.streamWriter.WriteJob(ctx, notificationType, notificationTarget, notificationSrc, data); err != nil {
-			ls.log.MustTrace(fmt.Sprintf("failed to write job to stream %v", err))
+
+		ids := make([]string, len(invited))
+		for i, usr := range invited {
+			ids[i] = usr.ID.String()
 		}
-		// TODO: remove this log before deploying
-		ls.log.MustDebug("notification successfuly wrote to stream")
-	}()
 
-	return u, nil
+		return ls.audit.Record(ctx, domain.AuditInviteWave, "invite_wave", waveID.String(), nil, map[string]any{
+			"size":  size,
+			"users": ids,
+		})
+	})
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	for _, usr := range invited {
+		ls.sendEmail(ctx, usr, "invite", "You're invited to launch list")
+	}
+	return waveID, invited, nil
 }
 
 func (ls LaunchService) UpdateUser(ctx context.Context, usr domain.User) (*domain.User, error) {
@@ -127,6 +329,18 @@ func (ls LaunchService) GetAllUsers(ctx context.Context) ([]*domain.User, error)
 	return usrs, nil
 }
 
+func (ls LaunchService) ListUsers(ctx context.Context, spec repos.QuerySpec) ([]*domain.User, int, error) {
+	return ls.usrRepo.Find(ctx, spec)
+}
+
+func (ls LaunchService) ListReferals(ctx context.Context, spec repos.QuerySpec) ([]*domain.Referal, int, error) {
+	return ls.refRepo.Find(ctx, spec)
+}
+
+func (ls LaunchService) ListSurveyResponses(ctx context.Context, spec repos.QuerySpec) ([]*domain.SurveyResponse, int, error) {
+	return ls.questnRepo.Find(ctx, spec)
+}
+
 func (ls LaunchService) CheckQue(ctx context.Context, usrname string) (int64, error) {
 	pos, err := ls.usrRepo.GetQuePosition(ctx, usrname)
 	if err != nil {
@@ -152,27 +366,176 @@ func (ls LaunchService) DeleteUserByEmail(ctx context.Context, email string) err
 }
 
 func (ls LaunchService) DeleteUserByUsername(ctx context.Context, usrname string) error {
-	if err := ls.usrRepo.DeleteByUsername(ctx, usrname); err != nil {
-		return err
+	return ls.deleteAudited(ctx, usrname, domain.AuditUserDelete, ls.usrRepo.DeleteByUsername)
+}
+
+func (ls LaunchService) HardDeleteUserByUsername(ctx context.Context, usrname string) error {
+	return ls.deleteAudited(ctx, usrname, domain.AuditUserPurge, ls.usrRepo.HardDeleteByUsername)
+}
+
+func (ls LaunchService) deleteAudited(ctx context.Context, usrname string, action domain.AuditAction, del func(context.Context, string) error) error {
+	return ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := ls.usrRepo.GetByUsername(repos.WithDeleted(ctx), usrname)
+		if err != nil {
+			return err
+		}
+
+		if err := del(ctx, usrname); err != nil {
+			return err
+		}
+
+		return ls.audit.Record(ctx, action, "user", before.ID.String(), before, nil)
+	})
+}
+
+// AdminUpdateUser applies an admins partial edit and records who made it.
+// The edit is re-applied to a fresh read if someone else updated the user in between.
+func (ls LaunchService) AdminUpdateUser(ctx context.Context, usrname string, edit dto.AdminUserUpdate) (*domain.User, error) {
+	var updated *domain.User
+	var verified bool
+	err := retryOnConflict(ctx, conflictRetries, func() error {
+		return ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+			before, err := ls.usrRepo.GetByUsername(ctx, usrname)
+			if err != nil {
+				return err
+			}
+
+			after := *before
+			verified = false
+			if edit.Verified != nil {
+				switch {
+				case !*edit.Verified:
+					after.VerifiedAt = time.Time{}
+				case before.VerifiedAt.IsZero():
+					after.VerifiedAt = time.Now()
+					verified = true
+				}
+			}
+			if edit.WouldUse != nil {
+				after.WouldUse = *edit.WouldUse
+			}
+			if edit.CompanyName != nil {
+				after.CompanyName = *edit.CompanyName
+			}
+			if edit.Comments != nil {
+				after.Comments = *edit.Comments
+			}
+			if edit.FirstName != nil {
+				after.FirstName = *edit.FirstName
+			}
+			if edit.LastName != nil {
+				after.LastName = *edit.LastName
+			}
+
+			updated, err = ls.usrRepo.Update(ctx, after)
+			if err != nil {
+				return err
+			}
+
+			// positions have to stay unique so a new position shifts the users in between
+			if edit.QuePosition != nil && *edit.QuePosition != updated.QuePosition {
+				updated, err = ls.usrRepo.MoveTo(ctx, updated.ID.String(), *edit.QuePosition)
+				if err != nil {
+					return err
+				}
+			}
+
+			return ls.audit.Record(ctx, domain.AuditUserUpdate, "user", before.ID.String(), before, updated)
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	if verified {
+		metrics.Verified()
+	}
+	return updated, nil
 }
 
-func (ls LaunchService) AddSurveyResponses(ctx context.Context, usrID, questionID, optionID uuid.UUID, text string) error {
-	if _, err := ls.questnRepo.Create(ctx, &domain.SurveyResponse{QuestionID: questionID, UserID: usrID, OptionID: optionID, WrittenResponse: text}); err != nil {
-		return err
+// retryOnConflict reruns fn while it loses optimistic locks, backing off a little more each attempt
+func retryOnConflict(ctx context.Context, attempts int, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); !errors.Is(err, repos.ErrConflict) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(i+1) * 10 * time.Millisecond):
+		}
 	}
 
-	return nil
+	return err
 }
 
-func (ls LaunchService) RewardReferer(ctx context.Context, referer domain.User) error {
-	referer.QuePosition += 1
-	if _, err := ls.UpdateUser(ctx, referer); err != nil {
-		return err
+func (ls LaunchService) FindAuditEntries(ctx context.Context, spec repos.QuerySpec) ([]*domain.AuditEntry, int, error) {
+	return ls.audit.Find(ctx, spec)
+}
+
+// Campaign is the survey campaign a request asked for, or the configured one when it didn't name one
+func (ls LaunchService) Campaign(requested string) string {
+	if requested = strings.TrimSpace(requested); requested != "" {
+		return requested
 	}
-	return nil
+	return ls.campaign
+}
+
+// GetActiveSurvey serves the active survey of the campaign without questions whose showIf conditions can never be met
+func (ls LaunchService) GetActiveSurvey(ctx context.Context, campaign string) (*domain.Survey, error) {
+	active, err := ls.surveyRepo.GetActive(ctx, campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	return survey.Reachable(active), nil
+}
+
+// SubmitSurvey checks answers against the active survey of the campaign and stores them as the users submission in one
+// transaction. Submitting again replaces the earlier answers and keeps the submission id.
+func (ls LaunchService) SubmitSurvey(ctx context.Context, usrname, campaign string, answers dto.SurveyResponses) (*domain.SurveySubmission, error) {
+	var sub *domain.SurveySubmission
+	err := ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		usr, err := ls.usrRepo.GetByUsername(ctx, usrname)
+		if err != nil {
+			return err
+		}
+
+		active, err := ls.surveyRepo.GetActive(ctx, campaign)
+		if err != nil {
+			return err
+		}
+
+		if errs := survey.ValidateAnswers(active, answers); len(errs) > 0 {
+			return errs
+		}
+
+		responses := make([]domain.SurveyResponse, 0, len(answers))
+		for _, a := range answers {
+			responses = append(responses, domain.SurveyResponse{
+				QuestionID:      a.QuestionID,
+				OptionID:        a.OptionID,
+				WrittenResponse: strings.TrimSpace(a.TextAnwser),
+			})
+		}
+
+		sub = &domain.SurveySubmission{ID: uuid.New(), SurveyID: active.ID, UserID: usr.ID}
+		return ls.submissions.Replace(ctx, sub, responses)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sub, nil
+}
+
+// RewardReferer bumps the referers position by the configured referal boost
+func (ls LaunchService) RewardReferer(ctx context.Context, referer domain.User) error {
+	return ls.tx.RunInTx(ctx, func(ctx context.Context) error {
+		return ls.rewards.Referal(ctx, referer)
+	})
 }
 
 func (ls LaunchService) GetReferer(ctx context.Context, usrname, urlID string) (domain.User, error) {
@@ -186,6 +549,7 @@ func (ls LaunchService) GetReferer(ctx context.Context, usrname, urlID string) (
 
 func (ls LaunchService) CreateReferal(ctx context.Context, refererID, refereeID uuid.UUID) error {
 	ref := domain.Referal{
+		ID:        uuid.New(),
 		RefereeID: refereeID,
 		RefererID: refererID,
 	}
@@ -196,7 +560,7 @@ func (ls LaunchService) CreateReferal(ctx context.Context, refererID, refereeID
 	return nil
 }
 
-func (ls LaunchService) createEmailPayload(usr *domain.User, notificationType, subject string) ([]byte, error) {
+func (ls LaunchService) createEmailPayload(usr *domain.User, notificationType, subject string, data map[string]any) ([]byte, error) {
 	emailCfg := config.LoadEmailConfig()
 	to := []string{usr.Email}
 	ejob := noti.EmailJob{
@@ -205,12 +569,13 @@ func (ls LaunchService) createEmailPayload(usr *domain.User, notificationType, s
 		Template:        notificationType,
 		TemplateVersion: strconv.Itoa(emailCfg.TemplateVersion),
 		Subject:         subject,
+		Data:            data,
 	}
 
-	data, err := json.Marshal(ejob)
+	payload, err := json.Marshal(ejob)
 	if err != nil {
-		return data, err
+		return payload, err
 	}
 
-	return data, nil
+	return payload, nil
 }
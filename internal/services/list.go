@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+// Finder is implemented by service list methods so every admin list endpoint shares one handler
+type Finder[M any] func(ctx context.Context, spec repos.QuerySpec) ([]*M, int, error)
+
+// HandleList parses the filter, sort and paging params against fields and writes the matching page under key
+func HandleList[M any](key string, fields repos.Fields, find Finder[M]) APIHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := r.Context().Err(); err != nil {
+			return APIErr{Status: http.StatusGatewayTimeout, Err: err}
+		}
+
+		spec, err := repos.ParseQuery(r.URL.Query(), fields)
+		if err != nil {
+			return APIErr{Status: http.StatusBadRequest, Err: err}
+		}
+
+		items, total, err := find(r.Context(), spec)
+		if err != nil && !errors.Is(err, repos.ErrNoRecords) {
+			return APIErr{Status: http.StatusInternalServerError, Err: err}
+		}
+
+		if items == nil {
+			items = make([]*M, 0)
+		}
+
+		res := request.JSON{
+			key:     items,
+			"total": total,
+			"page":  spec.Page,
+			"limit": spec.Limit,
+		}
+
+		return request.WriteJSON(w, http.StatusOK, res)
+	}
+}
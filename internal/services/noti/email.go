@@ -6,14 +6,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/metrics"
+	"github.com/zrp9/launchl/internal/request"
 	vk "github.com/zrp9/launchl/internal/services/valkaree"
+	"github.com/zrp9/launchl/internal/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Notifier interface {
@@ -29,16 +35,17 @@ type EmailJob struct {
 	Subject         string         `json:"subject,omitempty"`
 }
 
+// ErrNoSender is returned until an email provider is wired in, jobs it fails stay pending on the stream
+var ErrNoSender = errors.New("no email sender is configured")
+
 type EmailNoti struct{}
 
 func (e EmailNoti) Send(ctx context.Context, job vk.Job) error {
-	payload, err := e.decodeEmailJob(job)
-	if err != nil {
+	if _, err := e.decodeEmailJob(job); err != nil {
 		return err
 	}
 
-	log.Printf("payload %v", payload)
-	return nil
+	return ErrNoSender
 }
 
 type EmailQueConsumer struct {
@@ -54,6 +61,7 @@ type EmailQueConsumer struct {
 func NewEmailConsumer(reader vk.StreamReader, emailNoti EmailNoti, retries int64, maxRoutines int, timeout, minIdle time.Duration) EmailQueConsumer {
 	return EmailQueConsumer{
 		streamReader: reader,
+		logger:       *crane.DefaultLogger,
 		MaxWorkers:   maxRoutines,
 		Retries:      retries,
 		Timeout:      timeout,
@@ -73,7 +81,8 @@ func (e EmailQueConsumer) Run(ctx context.Context) error {
 	}
 
 	var resultWg sync.WaitGroup
-	go e.monitorResults(ctx, results, &resultWg)
+	resultWg.Add(1)
+	go e.monitorResults(results, &resultWg)
 
 	defer func() {
 		close(jobs)
@@ -82,14 +91,24 @@ func (e EmailQueConsumer) Run(ctx context.Context) error {
 		resultWg.Wait()
 	}()
 
+	var claimAt time.Time
 	for {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
 
 		free := cap(jobs) - len(jobs)
-		msgs, err := e.streamReader.ReadGroup(ctx, int64(free))
-		if err != nil || len(msgs) == 0 {
+		msgs, err := e.next(ctx, int64(free), &claimAt)
+		if err != nil {
+			// back off instead of spinning while valkey is unreachable
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+		if len(msgs) == 0 {
 			continue
 		}
 
@@ -104,45 +123,77 @@ func (e EmailQueConsumer) Run(ctx context.Context) error {
 
 }
 
+// next reads new jobs. Jobs that failed to send stay pending, so every MinIdle the jobs that have sat
+// pending that long are claimed first and sent again.
+func (e EmailQueConsumer) next(ctx context.Context, count int64, claimAt *time.Time) ([]vk.Message, error) {
+	if e.MinIdle > 0 && !time.Now().Before(*claimAt) {
+		*claimAt = time.Now().Add(e.MinIdle)
+		_, msgs, err := e.streamReader.ClaimIdle(ctx, e.MinIdle)
+		if err != nil || len(msgs) > 0 {
+			return msgs, err
+		}
+	}
+
+	return e.streamReader.ReadGroup(ctx, count)
+}
+
+// processMessage works until msgs is closed, jobs already handed to a worker are finished on
+// shutdown instead of being cut off half sent
 func (e EmailQueConsumer) processMessage(ctx context.Context, msgs <-chan vk.Message, results chan<- vk.JobResult, wg *sync.WaitGroup) {
 	defer wg.Done()
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case m, ok := <-msgs:
-			if !ok {
-				return
-			}
-			log.Printf("message %s recieved", m)
-			// need to update this to either handle a single field named json or multiple field value pairs
-			// extract json payload
-			job, err := e.decodeJob(m)
-			if err != nil {
-				_, _ = e.streamReader.AckDel(ctx, m.ID)
-				e.logger.MustDebug(fmt.Sprintf("invalid message will be deleted: msgId: %v, %v", m.ID, err))
-			}
-
-			// sendCtx := ctx
-			// if e.Timeout > 0 {
-			// 	var cancel context.CancelFunc
-			// 	sendCtx, cancel = context.WithTimeout(ctx, e.Timeout)
-			// 	defer func() {
-			// 		cancel()
-			// 	}()
-			// }
-			if err := e.Notifier.Send(ctx, job); err != nil {
-				results <- vk.JobResult{Success: false, Error: err.Error(), MsgID: m.ID}
-			}
+	ctx = context.WithoutCancel(ctx)
+	for m := range msgs {
+		results <- e.handleMessage(ctx, m)
+	}
+}
 
-			if _, err := e.streamReader.AckDel(ctx, m.ID); err != nil {
-				results <- vk.JobResult{Success: false, Error: fmt.Sprintf("ackdel failed: %v", err), MsgID: m.ID}
-			}
+// handleMessage sends one job, a job that fails to send is left pending so it can be claimed and retried
+func (e EmailQueConsumer) handleMessage(ctx context.Context, m vk.Message) vk.JobResult {
+	start := time.Now()
+	// need to update this to either handle a single field named json or multiple field value pairs
+	// extract json payload
+	job, err := e.decodeJob(m)
+	if err != nil {
+		_, _ = e.streamReader.AckDel(ctx, m.ID)
+		e.logger.MustDebug(fmt.Sprintf("invalid message will be deleted: msgId: %v, %v", m.ID, err))
+		return vk.JobResult{MsgID: m.ID, Error: err.Error(), Duration: time.Since(start)}
+	}
 
-			results <- vk.JobResult{Success: true, MsgID: m.ID}
+	// the job carries the trace and request id of the request that queued it so sending shows up
+	// in the same trace and log lines are tied back to it
+	ctx, span := startJob(ctx, job)
+	defer span.End()
+	e.logger.Ctx(ctx).MustDebug("email job received")
+
+	result := vk.JobResult{JID: job.JID, MsgID: m.ID, RetryLimit: job.RetryLimit}
+
+	// sendCtx := ctx
+	// if e.Timeout > 0 {
+	// 	var cancel context.CancelFunc
+	// 	sendCtx, cancel = context.WithTimeout(ctx, e.Timeout)
+	// 	defer func() {
+	// 		cancel()
+	// 	}()
+	// }
+	if err := e.Notifier.Send(ctx, job); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		e.logger.Ctx(ctx).MustError(err)
+		result.Error = err.Error()
+		result.Duration = time.Since(start)
+		return result
+	}
 
-		}
+	if _, err := e.streamReader.AckDel(ctx, m.ID); err != nil {
+		span.RecordError(err)
+		result.Error = fmt.Sprintf("ackdel failed: %v", err)
+		result.Duration = time.Since(start)
+		return result
 	}
+
+	result.Success = true
+	result.Duration = time.Since(start)
+	return result
 }
 
 // todo handle single json field
@@ -178,6 +229,19 @@ func (e EmailQueConsumer) decodeJob(msg vk.Message) (vk.Job, error) {
 		job.Source = src
 	}
 
+	if requestID, ok := values["requestId"]; ok {
+		job.RequestID = requestID
+	}
+
+	for _, key := range otel.GetTextMapPropagator().Fields() {
+		if v, ok := values[key]; ok {
+			if job.TraceContext == nil {
+				job.TraceContext = make(map[string]string)
+			}
+			job.TraceContext[key] = v
+		}
+	}
+
 	if retries, ok := values["retryLimit"]; ok {
 		r, err := e.toInt64(retries)
 		if err != nil {
@@ -189,6 +253,31 @@ func (e EmailQueConsumer) decodeJob(msg vk.Message) (vk.Job, error) {
 	return job, nil
 }
 
+// startJob continues the trace the job was written in and puts the jobs ids on ctx for logging
+// and for anything the job writes like audit entries
+func startJob(ctx context.Context, job vk.Job) (context.Context, trace.Span) {
+	ctx = telemetry.Extract(ctx, job.TraceContext)
+	ctx, span := telemetry.Tracer().Start(ctx, "email "+job.Kind,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "valkey"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.message.id", job.MessageID),
+		),
+	)
+
+	fields := crane.Zfields{"messageId": job.MessageID, "jobId": job.JID, "kind": job.Kind}
+	if job.RequestID != "" {
+		ctx = request.WithRequestID(ctx, job.RequestID)
+		fields["requestId"] = job.RequestID
+	}
+	if id := telemetry.TraceID(ctx); id != "" {
+		fields["traceId"] = id
+	}
+
+	return crane.ContextWithFields(ctx, fields), span
+}
+
 func (e EmailNoti) decodeEmailJob(job vk.Job) (EmailJob, error) {
 	var ejob EmailJob
 	if err := json.Unmarshal([]byte(job.Payload), &ejob); err != nil {
@@ -206,22 +295,12 @@ func (e EmailQueConsumer) toInt64(s string) (int64, error) {
 	return strconv.ParseInt(s, 10, 64)
 }
 
-func (e EmailQueConsumer) monitorResults(ctx context.Context, results <-chan vk.JobResult, wg *sync.WaitGroup) {
+func (e EmailQueConsumer) monitorResults(results <-chan vk.JobResult, wg *sync.WaitGroup) {
 	defer wg.Done()
-	var ok, fail int
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case r, okCh := <-results:
-			if okCh {
-				e.logger.MustTrace(fmt.Sprintf("email results: success=%d fail=%d", ok, fail))
-			}
-			if r.Success {
-				ok++
-			} else {
-				fail++
-			}
+	for r := range results {
+		metrics.ObserveJob("email", r.Success, r.Duration)
+		if !r.Success {
+			e.logger.MustTrace(fmt.Sprintf("email job %s failed: %s", r.MsgID, r.Error))
 		}
 	}
 }
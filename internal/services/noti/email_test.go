@@ -0,0 +1,54 @@
+package noti
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vk "github.com/zrp9/launchl/internal/services/valkaree"
+)
+
+// fakeReader hands out claimed jobs from idle and new jobs from fresh
+type fakeReader struct {
+	vk.StreamReader
+	idle   []vk.Message
+	fresh  []vk.Message
+	claims int
+}
+
+func (f *fakeReader) ClaimIdle(_ context.Context, _ time.Duration) (string, []vk.Message, error) {
+	f.claims++
+	msgs := f.idle
+	f.idle = nil
+	return "0-0", msgs, nil
+}
+
+func (f *fakeReader) ReadGroup(_ context.Context, _ int64) ([]vk.Message, error) {
+	return f.fresh, nil
+}
+
+func TestNextClaimsIdleJobs(t *testing.T) {
+	r := &fakeReader{
+		idle:  []vk.Message{{ID: "1-0"}},
+		fresh: []vk.Message{{ID: "2-0"}},
+	}
+	e := EmailQueConsumer{streamReader: r, MinIdle: time.Minute}
+	ctx := context.Background()
+
+	var claimAt time.Time
+	want := []string{"1-0", "2-0", "2-0"}
+	for i, id := range want {
+		msgs, err := e.next(ctx, 1, &claimAt)
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		if len(msgs) != 1 || msgs[0].ID != id {
+			t.Errorf("read %d = %v, want %s", i, msgs, id)
+		}
+	}
+
+	// nothing is claimed again until MinIdle has passed
+	if r.claims != 1 {
+		t.Errorf("claimed %d times, want 1", r.claims)
+	}
+}
@@ -0,0 +1,65 @@
+// Package retention runs the job that anonymizes soft deleted users after the retention period
+package retention
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+)
+
+// defaultInterval is used when the configured interval is zero or negative, a ticker can't run on it
+const defaultInterval = time.Hour
+
+type Job struct {
+	usrRepo userrepo.UserRepo
+	cfg     config.RetentionCfg
+	logger  *crane.Zlogrus
+}
+
+func New(u userrepo.UserRepo, cfg config.RetentionCfg, l *crane.Zlogrus) Job {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+
+	return Job{
+		usrRepo: u,
+		cfg:     cfg,
+		logger:  l,
+	}
+}
+
+// Run anonymizes expired users once and then every interval until ctx is done
+func (j Job) Run(ctx context.Context) error {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.RunOnce(ctx); err != nil {
+			j.logger.MustError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j Job) RunOnce(ctx context.Context) (int64, error) {
+	cutoff := time.Now().Add(-j.cfg.AnonymizeAfter)
+	n, err := j.usrRepo.AnonymizeDeleted(ctx, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("retention job failed %w", err)
+	}
+
+	if n > 0 {
+		j.logger.MustInfo(fmt.Sprintf("retention job anonymized %d users deleted before %v", n, cutoff))
+	}
+
+	return n, nil
+}
@@ -0,0 +1,30 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+)
+
+func TestNewInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		want     time.Duration
+	}{
+		{name: "configured", interval: 10 * time.Minute, want: 10 * time.Minute},
+		{name: "zero", interval: 0, want: defaultInterval},
+		{name: "negative", interval: -time.Minute, want: defaultInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := New(userrepo.UserRepo{}, config.RetentionCfg{Interval: tt.interval}, nil)
+			if j.cfg.Interval != tt.want {
+				t.Errorf("interval = %v, want %v", j.cfg.Interval, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package reward moves users up the waitlist for actions that help the launch, how far each action
+// moves them is set by config.RewardCfg
+package reward
+
+import (
+	"context"
+
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos/userrepo"
+	"github.com/zrp9/launchl/internal/services/audit"
+)
+
+// positions moves users along the line, position 1 is the front
+type positions interface {
+	Promote(ctx context.Context, id string, delta int64) (*domain.User, error)
+}
+
+type auditor interface {
+	Record(ctx context.Context, action domain.AuditAction, entityType, entityID string, before, after any) error
+}
+
+type Rewarder struct {
+	users positions
+	audit auditor
+	cfg   config.RewardCfg
+}
+
+func New(u userrepo.UserRepo, a audit.Recorder, cfg config.RewardCfg) Rewarder {
+	return Rewarder{
+		users: u,
+		audit: a,
+		cfg:   cfg,
+	}
+}
+
+// MaxVotes is how many features a user may vote for at once, 0 means no limit
+func (r Rewarder) MaxVotes() int {
+	return r.cfg.MaxVotes
+}
+
+// VoteBoost is the position boost a new vote pays out
+func (r Rewarder) VoteBoost() int64 {
+	return r.cfg.VoteBoost
+}
+
+// Referal rewards a referer for someone signing up with their link
+func (r Rewarder) Referal(ctx context.Context, referer domain.User) error {
+	return r.Boost(ctx, referer, r.cfg.ReferalBoost, domain.AuditRewardReferer)
+}
+
+// Boost moves usr delta places toward the front of the line and audits it under action, a negative
+// delta takes a reward back and a delta of 0 is a disabled reward that does nothing. Call it inside the
+// transaction of the action being rewarded so the reward rolls back with it.
+func (r Rewarder) Boost(ctx context.Context, usr domain.User, delta int64, action domain.AuditAction) error {
+	if delta == 0 {
+		return nil
+	}
+
+	after, err := r.users.Promote(ctx, usr.ID.String(), delta)
+	if err != nil {
+		return err
+	}
+
+	return r.audit.Record(ctx, action, "user", usr.ID.String(), usr, after)
+}
@@ -0,0 +1,88 @@
+package reward
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/domain"
+)
+
+// line keeps users in que order, index 0 is position 1
+type line []*domain.User
+
+func (l *line) Promote(_ context.Context, id string, delta int64) (*domain.User, error) {
+	from := -1
+	for i, u := range *l {
+		if u.ID.String() == id {
+			from = i
+		}
+	}
+	to := max(0, min(int64(len(*l)-1), int64(from)-delta))
+
+	usr := (*l)[from]
+	rest := append((*l)[:from:from], (*l)[from+1:]...)
+	*l = append(rest[:to:to], append([]*domain.User{usr}, rest[to:]...)...)
+	for i, u := range *l {
+		u.QuePosition = int64(i + 1)
+	}
+
+	after := *usr
+	return &after, nil
+}
+
+type audits []domain.AuditAction
+
+func (a *audits) Record(_ context.Context, action domain.AuditAction, _, _ string, _, _ any) error {
+	*a = append(*a, action)
+	return nil
+}
+
+func newLine(n int) line {
+	l := make(line, n)
+	for i := range l {
+		l[i] = &domain.User{ID: uuid.New(), QuePosition: int64(i + 1)}
+	}
+	return l
+}
+
+func TestBoost(t *testing.T) {
+	tests := []struct {
+		name  string
+		pos   int64
+		delta int64
+		want  int64
+	}{
+		{name: "boost moves to a smaller position", pos: 5, delta: 2, want: 3},
+		{name: "revoke moves to a larger position", pos: 3, delta: -2, want: 5},
+		{name: "disabled reward", pos: 4, delta: 0, want: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLine(6)
+			var recorded audits
+			r := Rewarder{users: &l, audit: &recorded, cfg: config.RewardCfg{}}
+
+			usr := *l[tt.pos-1]
+			if err := r.Boost(context.Background(), usr, tt.delta, domain.AuditRewardVote); err != nil {
+				t.Fatalf("Boost: %v", err)
+			}
+
+			if got := l[tt.want-1].ID; got != usr.ID {
+				t.Errorf("user is not at position %d", tt.want)
+			}
+			seen := map[int64]bool{}
+			for _, u := range l {
+				if seen[u.QuePosition] {
+					t.Errorf("position %d is shared", u.QuePosition)
+				}
+				seen[u.QuePosition] = true
+			}
+			if tt.delta != 0 && len(recorded) != 1 {
+				t.Errorf("recorded %d audits, want 1", len(recorded))
+			}
+		})
+	}
+}
@@ -1,8 +1,144 @@
 // Package services defines service interface and other functionality
 package services
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/request"
+)
 
 type Service interface {
 	RegisterRoutes(mr *http.ServeMux)
 }
+
+// APIHandler is a handler that returns its error instead of writing it
+type APIHandler func(w http.ResponseWriter, r *http.Request) error
+
+type APIErr struct {
+	Status int
+	Err    error
+}
+
+func (a APIErr) Error() string {
+	return a.Err.Error()
+}
+
+func (a APIErr) Unwrap() error {
+	return a.Err
+}
+
+// Status is the response status for err. APIErrs keep theirs unless they are internal errors wrapping
+// a repo sentinel, handlers wrap whatever the service returned as a 500 so those are classified by the
+// sentinels they wrap like any other error and anything unrecognised is an internal error.
+func Status(err error) int {
+	status, _ := classify(err)
+	return status
+}
+
+// Problem describes err for the client of r
+func Problem(r *http.Request, err error) request.Problem {
+	status, clientErr := classify(err)
+	p := request.NewProblem(status, clientErr)
+	var queryErrs repos.QueryErrs
+	if errors.As(err, &queryErrs) {
+		p.Errors = queryFieldErrors(queryErrs)
+	}
+	p.Instance = r.URL.Path
+	p.RequestID = request.RequestID(r.Context())
+	return p
+}
+
+// classify returns the status for err and the error the client is shown, repo errors are reduced to
+// their sentinel so driver messages stay in the logs
+func classify(err error) (int, error) {
+	var apiErr APIErr
+	if errors.As(err, &apiErr) && apiErr.Status != http.StatusInternalServerError {
+		return apiErr.Status, err
+	}
+
+	var conflict repos.ConflictErr
+	var verrs validator.ValidationErrors
+	var queryErrs repos.QueryErrs
+	switch {
+	case errors.Is(err, repos.ErrNoRecords):
+		return http.StatusNotFound, repos.ErrNoRecords
+	case errors.As(err, &conflict):
+		return http.StatusConflict, conflict
+	case errors.Is(err, repos.ErrDuplicate):
+		return http.StatusConflict, repos.ErrDuplicate
+	case errors.Is(err, repos.ErrConflict):
+		return http.StatusConflict, repos.ErrConflict
+	case errors.As(err, &verrs):
+		return http.StatusUnprocessableEntity, err
+	case errors.As(err, &queryErrs):
+		return http.StatusBadRequest, err
+	default:
+		return http.StatusInternalServerError, err
+	}
+}
+
+func queryFieldErrors(q repos.QueryErrs) []request.FieldErr {
+	out := make([]request.FieldErr, 0, len(q))
+	for _, e := range q {
+		out = append(out, request.FieldErr{Field: e.Param, Message: e.Reason})
+	}
+	return out
+}
+
+// Handle adapts an APIHandler to http, every returned error is logged in full and written to the
+// client as a problem unless the handler had already started its response
+func Handle(logger *crane.Zlogrus, hn APIHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		err := hn(tw, r)
+		if err == nil {
+			return
+		}
+
+		p := Problem(r, err)
+		logger.Ctx(r.Context()).With(crane.Zfields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"status": p.Status,
+		}).MustError(err)
+		if tw.wrote {
+			return
+		}
+
+		if err := request.WriteProblem(w, p); err != nil {
+			logger.MustError(err)
+		}
+	}
+}
+
+// trackingWriter remembers whether the response was started so a late error doesn't corrupt it
+type trackingWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (t *trackingWriter) WriteHeader(status int) {
+	t.wrote = true
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	t.wrote = true
+	return t.ResponseWriter.Write(p)
+}
+
+func (t *trackingWriter) Flush() {
+	if fl, ok := t.ResponseWriter.(http.Flusher); ok {
+		t.wrote = true
+		fl.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (t *trackingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
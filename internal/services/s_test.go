@@ -0,0 +1,117 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+// testLogger writes to a temp dir so test runs don't leave logs in the package
+func testLogger(t *testing.T) *crane.Zlogrus {
+	t.Helper()
+	return crane.NewLogger(crane.NewLogFile(crane.WithFilename(filepath.Join(t.TempDir(), crane.LogName))))
+}
+
+func TestHandleProblems(t *testing.T) {
+	driverErr := errors.New(`ERROR: duplicate key value violates unique constraint "users_email_key"`)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   request.Kind
+		wantDetail string
+	}{
+		{
+			// handlers like HandleGetUser wrap whatever the service returned as a 500
+			name:       "missing user wrapped as internal",
+			err:        APIErr{Status: http.StatusInternalServerError, Err: repos.ErrNoRecords},
+			wantStatus: http.StatusNotFound,
+			wantCode:   request.KindNotFound,
+			wantDetail: repos.ErrNoRecords.Error(),
+		},
+		{
+			name:       "duplicate subscriber wrapped as internal",
+			err:        APIErr{Status: http.StatusInternalServerError, Err: errors.Join(repos.ErrDuplicate, driverErr)},
+			wantStatus: http.StatusConflict,
+			wantCode:   request.KindConflict,
+			wantDetail: repos.ErrDuplicate.Error(),
+		},
+		{
+			name:       "lost optimistic lock",
+			err:        APIErr{Status: http.StatusInternalServerError, Err: repos.ConflictErr{ID: "abc", Version: 2}},
+			wantStatus: http.StatusConflict,
+			wantCode:   request.KindConflict,
+			wantDetail: repos.ConflictErr{ID: "abc", Version: 2}.Error(),
+		},
+		{
+			name:       "explicit status is kept",
+			err:        APIErr{Status: http.StatusBadRequest, Err: repos.ErrNoRecords},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   request.KindValidation,
+			wantDetail: repos.ErrNoRecords.Error(),
+		},
+		{
+			name:       "unrecognised error",
+			err:        APIErr{Status: http.StatusInternalServerError, Err: errors.Join(repos.ErrDBRead, driverErr)},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   request.KindInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Handle(testLogger(t), func(w http.ResponseWriter, r *http.Request) error {
+				return tt.err
+			})
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/user/jane", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != request.ProblemContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, request.ProblemContentType)
+			}
+
+			var p struct {
+				Status int          `json:"status"`
+				Code   request.Kind `json:"code"`
+				Detail string       `json:"detail"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if p.Status != tt.wantStatus || p.Code != tt.wantCode {
+				t.Errorf("problem = %d %s, want %d %s", p.Status, p.Code, tt.wantStatus, tt.wantCode)
+			}
+			if tt.wantDetail != "" && p.Detail != tt.wantDetail {
+				t.Errorf("detail = %q, want %q", p.Detail, tt.wantDetail)
+			}
+			if strings.Contains(p.Detail, "users_email_key") {
+				t.Errorf("detail leaked the driver error: %q", p.Detail)
+			}
+		})
+	}
+}
+
+func TestProblemQueryErrors(t *testing.T) {
+	err := APIErr{Status: http.StatusBadRequest, Err: repos.QueryErrs{{Param: "limit", Reason: "must be between 1 and 500"}}}
+	p := Problem(httptest.NewRequest(http.MethodGet, "/admin/users?limit=0", nil), err)
+
+	if p.Status != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", p.Status, http.StatusBadRequest)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "limit" {
+		t.Errorf("errors = %+v, want one for limit", p.Errors)
+	}
+}
@@ -0,0 +1,184 @@
+package survey
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/request"
+)
+
+// DefaultMaxTextLength caps text answers whose question metadata sets no maxLength
+const DefaultMaxTextLength = 2000
+
+// QuestionErr lists everything wrong with the answers to one question
+type QuestionErr struct {
+	QuestionID uuid.UUID `json:"questionId"`
+	Errors     []string  `json:"errors"`
+}
+
+// AnswerErrs is returned when a submission doesn't fit the survey definition
+type AnswerErrs []QuestionErr
+
+func (a AnswerErrs) Error() string {
+	msgs := make([]string, 0, len(a))
+	for _, e := range a {
+		msgs = append(msgs, fmt.Sprintf("question %v: %s", e.QuestionID, strings.Join(e.Errors, ", ")))
+	}
+	return fmt.Sprintf("invalid survey answers: %s", strings.Join(msgs, "; "))
+}
+
+// FieldErrors reports every problem under the id of the question it belongs to
+func (a AnswerErrs) FieldErrors() []request.FieldErr {
+	out := make([]request.FieldErr, 0, len(a))
+	for _, e := range a {
+		for _, msg := range e.Errors {
+			out = append(out, request.FieldErr{Field: e.QuestionID.String(), Message: msg})
+		}
+	}
+	return out
+}
+
+// ValidateAnswers checks answers against the active questions of s: choice answers must use the
+// questions own options, single choice questions take exactly one, text answers must fit the
+// length limits, required questions must be answered and metadata selection limits apply.
+// Questions hidden by their showIf conditions must not be answered and are never required.
+func ValidateAnswers(s *domain.Survey, answers dto.SurveyResponses) AnswerErrs {
+	byQuestion := make(map[uuid.UUID][]dto.SurveyResponse)
+	order := make([]uuid.UUID, 0)
+	for _, a := range answers {
+		if _, seen := byQuestion[a.QuestionID]; !seen {
+			order = append(order, a.QuestionID)
+		}
+		byQuestion[a.QuestionID] = append(byQuestion[a.QuestionID], a)
+	}
+
+	var errs AnswerErrs
+	known := make(map[uuid.UUID]bool, len(s.Questions))
+	chosen := make(map[uuid.UUID]map[uuid.UUID]bool)
+	// questions are in position order so conditions only ever look at answers already accepted
+	for _, q := range s.Questions {
+		if !q.Active {
+			continue
+		}
+		known[q.ID] = true
+
+		meta, err := q.Meta()
+		if err != nil {
+			errs = append(errs, QuestionErr{QuestionID: q.ID, Errors: []string{"question has invalid metadata"}})
+			continue
+		}
+
+		given := byQuestion[q.ID]
+		if !meta.Shown(chosen) {
+			if len(given) > 0 {
+				errs = append(errs, QuestionErr{QuestionID: q.ID, Errors: []string{"question is hidden by the answers to earlier questions"}})
+			}
+			continue
+		}
+
+		if msgs := validateQuestion(q, meta, given); len(msgs) > 0 {
+			errs = append(errs, QuestionErr{QuestionID: q.ID, Errors: msgs})
+			continue
+		}
+
+		for _, a := range given {
+			if a.OptionID == uuid.Nil {
+				continue
+			}
+			if chosen[q.ID] == nil {
+				chosen[q.ID] = make(map[uuid.UUID]bool)
+			}
+			chosen[q.ID][a.OptionID] = true
+		}
+	}
+
+	for _, id := range order {
+		if !known[id] {
+			errs = append(errs, QuestionErr{QuestionID: id, Errors: []string{"question is not part of the active survey"}})
+		}
+	}
+
+	return errs
+}
+
+func validateQuestion(q domain.SurveyQuestion, meta domain.QuestionMeta, answers []dto.SurveyResponse) []string {
+	if len(answers) == 0 {
+		if q.Required {
+			return []string{"an answer is required"}
+		}
+		return nil
+	}
+
+	switch q.QuestionType {
+	case domain.CHECK, domain.DROPDOWN:
+		if len(answers) != 1 {
+			return []string{"exactly one option must be selected"}
+		}
+		return validateOptions(q, answers)
+	case domain.MULTICHECK:
+		msgs := validateOptions(q, answers)
+		minSel := max(meta.MinSelections, 1)
+		if len(answers) < minSel {
+			msgs = append(msgs, fmt.Sprintf("at least %d options must be selected", minSel))
+		}
+		if meta.MaxSelections > 0 && len(answers) > meta.MaxSelections {
+			msgs = append(msgs, fmt.Sprintf("at most %d options can be selected", meta.MaxSelections))
+		}
+		return msgs
+	case domain.TEXT:
+		return validateText(q, meta, answers)
+	default:
+		return []string{fmt.Sprintf("unsupported question type %q", q.QuestionType)}
+	}
+}
+
+func validateOptions(q domain.SurveyQuestion, answers []dto.SurveyResponse) []string {
+	var msgs []string
+	seen := make(map[uuid.UUID]bool, len(answers))
+	for _, a := range answers {
+		switch {
+		case a.OptionID == uuid.Nil:
+			msgs = append(msgs, "an option must be selected")
+		case !q.HasOption(a.OptionID):
+			msgs = append(msgs, fmt.Sprintf("option %v does not belong to this question", a.OptionID))
+		case seen[a.OptionID]:
+			msgs = append(msgs, fmt.Sprintf("option %v was selected more than once", a.OptionID))
+		}
+		seen[a.OptionID] = true
+	}
+	return msgs
+}
+
+func validateText(q domain.SurveyQuestion, meta domain.QuestionMeta, answers []dto.SurveyResponse) []string {
+	if len(answers) != 1 {
+		return []string{"exactly one text answer is allowed"}
+	}
+
+	a := answers[0]
+	if a.OptionID != uuid.Nil && !q.HasOption(a.OptionID) {
+		return []string{fmt.Sprintf("option %v does not belong to this question", a.OptionID)}
+	}
+
+	text := strings.TrimSpace(a.TextAnwser)
+	n := utf8.RuneCountInString(text)
+	maxLen := meta.MaxLength
+	if maxLen <= 0 {
+		maxLen = DefaultMaxTextLength
+	}
+
+	var msgs []string
+	if n == 0 && q.Required {
+		msgs = append(msgs, "an answer is required")
+	}
+	if n > 0 && n < meta.MinLength {
+		msgs = append(msgs, fmt.Sprintf("answer must be at least %d characters", meta.MinLength))
+	}
+	if n > maxLen {
+		msgs = append(msgs, fmt.Sprintf("answer must be at most %d characters", maxLen))
+	}
+	return msgs
+}
@@ -0,0 +1,328 @@
+// Package survey contains the admin api and service for authoring, versioning and publishing surveys
+package survey
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/idempotency"
+	"github.com/zrp9/launchl/internal/middleware"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/surveyrepo"
+	"github.com/zrp9/launchl/internal/request"
+	"github.com/zrp9/launchl/internal/services"
+)
+
+type SurveyAPI struct {
+	s      SurveyService
+	logger *crane.Zlogrus
+	idem   *idempotency.Guard
+}
+
+func Initialize(s SurveyService, l *crane.Zlogrus, idem *idempotency.Guard) SurveyAPI {
+	return SurveyAPI{
+		s:      s,
+		logger: l,
+		idem:   idem,
+	}
+}
+
+func (a SurveyAPI) Name() string {
+	return "survey"
+}
+
+func (a SurveyAPI) RegisterRoutes(m *http.ServeMux) {
+	admin := middleware.Authorize(middleware.AdminRole)
+	m.HandleFunc("GET /admin/surveys", admin(a.HandleLogging(services.HandleList("surveys", surveyrepo.SurveyFields, a.s.List))))
+	m.HandleFunc("POST /admin/surveys", admin(a.idem.Wrap(a.HandleLogging(a.HandleCreate))))
+	m.HandleFunc("GET /admin/surveys/{id}", admin(a.HandleLogging(a.HandleGet)))
+	m.HandleFunc("POST /admin/surveys/{id}/publish", admin(a.idem.Wrap(a.HandleLogging(a.HandlePublish))))
+	m.HandleFunc("POST /admin/surveys/{id}/draft", admin(a.idem.Wrap(a.HandleLogging(a.HandleCreateDraft))))
+	m.HandleFunc("GET /admin/surveys/{id}/results", admin(a.HandleLogging(a.HandleResults)))
+
+	m.HandleFunc("POST /admin/surveys/{id}/questions", admin(a.idem.Wrap(a.HandleLogging(a.HandleAddQuestion))))
+	m.HandleFunc("PUT /admin/surveys/{id}/questions/order", admin(a.HandleLogging(a.HandleReorderQuestions)))
+	m.HandleFunc("PATCH /admin/surveys/{id}/questions/{questionId}", admin(a.HandleLogging(a.HandleUpdateQuestion)))
+	m.HandleFunc("DELETE /admin/surveys/{id}/questions/{questionId}", admin(a.HandleLogging(a.HandleDeleteQuestion)))
+
+	m.HandleFunc("POST /admin/surveys/{id}/questions/{questionId}/options", admin(a.idem.Wrap(a.HandleLogging(a.HandleAddOption))))
+	m.HandleFunc("PUT /admin/surveys/{id}/questions/{questionId}/options/order", admin(a.HandleLogging(a.HandleReorderOptions)))
+	m.HandleFunc("PATCH /admin/surveys/{id}/questions/{questionId}/options/{optionId}", admin(a.HandleLogging(a.HandleUpdateOption)))
+	m.HandleFunc("DELETE /admin/surveys/{id}/questions/{questionId}/options/{optionId}", admin(a.HandleLogging(a.HandleDeleteOption)))
+}
+
+func (a SurveyAPI) HandleLogging(hn services.APIHandler) http.HandlerFunc {
+	return services.Handle(a.logger, hn)
+}
+
+func (a SurveyAPI) HandleCreate(w http.ResponseWriter, r *http.Request) error {
+	var payload dto.SurveyDto
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	survey, err := a.s.Create(r.Context(), payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusCreated, request.JSON{"survey": survey})
+}
+
+func (a SurveyAPI) HandleGet(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	survey, err := a.s.Get(r.Context(), id)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"survey": survey})
+}
+
+func (a SurveyAPI) HandlePublish(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	survey, err := a.s.Publish(r.Context(), id)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"survey": survey})
+}
+
+func (a SurveyAPI) HandleCreateDraft(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	survey, err := a.s.CreateDraft(r.Context(), id)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusCreated, request.JSON{"survey": survey})
+}
+
+// HandleResults takes the text answer filter, sort and paging params of surveyrepo.TextAnswerFields
+func (a SurveyAPI) HandleResults(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	spec, err := repos.ParseQuery(r.URL.Query(), surveyrepo.TextAnswerFields)
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	results, err := a.s.Results(r.Context(), id, spec)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"results": results})
+}
+
+func (a SurveyAPI) HandleAddQuestion(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	var payload dto.QuestionDto
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	question, err := a.s.AddQuestion(r.Context(), id, payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusCreated, request.JSON{"question": question})
+}
+
+func (a SurveyAPI) HandleUpdateQuestion(w http.ResponseWriter, r *http.Request) error {
+	id, questionID, err := parseQuestionPath(r)
+	if err != nil {
+		return err
+	}
+
+	var payload dto.QuestionUpdate
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	question, err := a.s.UpdateQuestion(r.Context(), id, questionID, payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"question": question})
+}
+
+func (a SurveyAPI) HandleDeleteQuestion(w http.ResponseWriter, r *http.Request) error {
+	id, questionID, err := parseQuestionPath(r)
+	if err != nil {
+		return err
+	}
+
+	if err := a.s.DeleteQuestion(r.Context(), id, questionID); err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"success": true})
+}
+
+func (a SurveyAPI) HandleReorderQuestions(w http.ResponseWriter, r *http.Request) error {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	var payload dto.OrderDto
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	if err := a.s.ReorderQuestions(r.Context(), id, payload.IDs); err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"success": true})
+}
+
+func (a SurveyAPI) HandleAddOption(w http.ResponseWriter, r *http.Request) error {
+	id, questionID, err := parseQuestionPath(r)
+	if err != nil {
+		return err
+	}
+
+	var payload dto.OptionDto
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	option, err := a.s.AddOption(r.Context(), id, questionID, payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusCreated, request.JSON{"option": option})
+}
+
+func (a SurveyAPI) HandleUpdateOption(w http.ResponseWriter, r *http.Request) error {
+	id, questionID, err := parseQuestionPath(r)
+	if err != nil {
+		return err
+	}
+
+	optionID, err := request.ParsePathUUID(r, "optionId")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	var payload dto.OptionUpdate
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	option, err := a.s.UpdateOption(r.Context(), id, questionID, optionID, payload)
+	if err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"option": option})
+}
+
+func (a SurveyAPI) HandleDeleteOption(w http.ResponseWriter, r *http.Request) error {
+	id, questionID, err := parseQuestionPath(r)
+	if err != nil {
+		return err
+	}
+
+	optionID, err := request.ParsePathUUID(r, "optionId")
+	if err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if err := a.s.DeleteOption(r.Context(), id, questionID, optionID); err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"success": true})
+}
+
+func (a SurveyAPI) HandleReorderOptions(w http.ResponseWriter, r *http.Request) error {
+	id, questionID, err := parseQuestionPath(r)
+	if err != nil {
+		return err
+	}
+
+	var payload dto.OrderDto
+	if err := parseValid(r, &payload); err != nil {
+		return err
+	}
+
+	if err := a.s.ReorderOptions(r.Context(), id, questionID, payload.IDs); err != nil {
+		return statusErr(err)
+	}
+
+	return request.WriteJSON(w, http.StatusOK, request.JSON{"success": true})
+}
+
+type validated interface {
+	Validate() error
+}
+
+func parseValid[T any](r *http.Request, payload *T) error {
+	if err := request.ParseJSON(r, payload); err != nil {
+		return services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	if v, ok := any(*payload).(validated); ok {
+		if err := v.Validate(); err != nil {
+			return services.APIErr{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	return nil
+}
+
+func parseQuestionPath(r *http.Request) (uuid.UUID, uuid.UUID, error) {
+	id, err := request.ParsePathUUID(r, "id")
+	if err != nil {
+		return uuid.Nil, uuid.Nil, services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	questionID, err := request.ParsePathUUID(r, "questionId")
+	if err != nil {
+		return uuid.Nil, uuid.Nil, services.APIErr{Status: http.StatusBadRequest, Err: err}
+	}
+
+	return id, questionID, nil
+}
+
+func statusErr(err error) error {
+	switch {
+	case errors.Is(err, repos.ErrNoRecords):
+		return services.APIErr{Status: http.StatusNotFound, Err: err}
+	case errors.Is(err, ErrSurveyPublished), errors.Is(err, repos.ErrConflict):
+		return services.APIErr{Status: http.StatusConflict, Err: err}
+	case errors.Is(err, ErrNotInSurvey), errors.Is(err, ErrNotInQuestion), errors.Is(err, ErrSurveyIncomplete), errors.Is(err, ErrInvalidCondition), errors.Is(err, surveyrepo.ErrReorderMismatch):
+		return services.APIErr{Status: http.StatusUnprocessableEntity, Err: err}
+	default:
+		return services.APIErr{Status: http.StatusInternalServerError, Err: err}
+	}
+}
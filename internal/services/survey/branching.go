@@ -0,0 +1,130 @@
+package survey
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/domain"
+)
+
+// checkConditions requires every showIf condition of an active question to point at options
+// of an earlier active choice question, so the survey can always be answered top to bottom
+func checkConditions(s *domain.Survey) error {
+	earlier := make(map[uuid.UUID]domain.SurveyQuestion)
+	for _, q := range s.Questions {
+		if !q.Active {
+			continue
+		}
+
+		meta, err := q.Meta()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCondition, err)
+		}
+
+		for _, c := range meta.ShowIf {
+			if err := checkCondition(q, c, earlier); err != nil {
+				return err
+			}
+		}
+
+		earlier[q.ID] = q
+	}
+
+	return nil
+}
+
+func checkCondition(q domain.SurveyQuestion, c domain.Condition, earlier map[uuid.UUID]domain.SurveyQuestion) error {
+	target, ok := earlier[c.QuestionID]
+	if !ok {
+		return fmt.Errorf("%w: question %v depends on %v which is not an earlier active question", ErrInvalidCondition, q.ID, c.QuestionID)
+	}
+
+	if target.QuestionType == domain.TEXT {
+		return fmt.Errorf("%w: question %v depends on text question %v", ErrInvalidCondition, q.ID, c.QuestionID)
+	}
+
+	if len(c.OptionIDs) == 0 {
+		return fmt.Errorf("%w: question %v has a condition without options", ErrInvalidCondition, q.ID)
+	}
+
+	for _, id := range c.OptionIDs {
+		if !target.HasOption(id) {
+			return fmt.Errorf("%w: option %v is not an option of question %v", ErrInvalidCondition, id, c.QuestionID)
+		}
+	}
+
+	return nil
+}
+
+// Reachable drops the questions of s whose conditions can never be met because they depend on a
+// question or option that isn't served, clients then only have to evaluate the showIf rules left
+func Reachable(s *domain.Survey) *domain.Survey {
+	served := *s
+	served.Questions = make([]domain.SurveyQuestion, 0, len(s.Questions))
+
+	earlier := make(map[uuid.UUID]domain.SurveyQuestion)
+	for _, q := range s.Questions {
+		meta, err := q.Meta()
+		if err != nil {
+			continue
+		}
+
+		reachable := true
+		for _, c := range meta.ShowIf {
+			if checkCondition(q, c, earlier) != nil {
+				reachable = false
+				break
+			}
+		}
+
+		if reachable {
+			earlier[q.ID] = q
+			served.Questions = append(served.Questions, q)
+		}
+	}
+
+	return &served
+}
+
+// remapConditions points the showIf conditions in raw at the copies of questions and options
+// a draft was cloned into, any other metadata keys are kept as they are
+func remapConditions(raw json.RawMessage, ids map[uuid.UUID]uuid.UUID) (json.RawMessage, error) {
+	if len(raw) == 0 {
+		return raw, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	showIf, ok := fields["showIf"]
+	if !ok {
+		return raw, nil
+	}
+
+	var conditions []domain.Condition
+	if err := json.Unmarshal(showIf, &conditions); err != nil {
+		return nil, err
+	}
+
+	for i, c := range conditions {
+		if id, ok := ids[c.QuestionID]; ok {
+			conditions[i].QuestionID = id
+		}
+		for j, o := range c.OptionIDs {
+			if id, ok := ids[o]; ok {
+				conditions[i].OptionIDs[j] = id
+			}
+		}
+	}
+
+	remapped, err := json.Marshal(conditions)
+	if err != nil {
+		return nil, err
+	}
+	fields["showIf"] = remapped
+
+	return json.Marshal(fields)
+}
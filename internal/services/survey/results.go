@@ -0,0 +1,164 @@
+package survey
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/surveyrepo"
+)
+
+// Share is a count and the percentage it makes up of its base
+type Share struct {
+	Count   int64   `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+// Breakdown splits a share by respondent segment, each percentage is taken within the segment
+type Breakdown struct {
+	WouldUse       Share `json:"wouldUse"`
+	WouldNotUse    Share `json:"wouldNotUse"`
+	WithCompany    Share `json:"withCompany"`
+	WithoutCompany Share `json:"withoutCompany"`
+	Referred       Share `json:"referred"`
+	Organic        Share `json:"organic"`
+}
+
+type OptionResult struct {
+	OptionID uuid.UUID `json:"optionId"`
+	Label    string    `json:"label"`
+	Share
+	Segments Breakdown `json:"segments"`
+}
+
+type QuestionResult struct {
+	QuestionID   uuid.UUID           `json:"questionId"`
+	Prompt       string              `json:"prompt"`
+	QuestionType domain.QuestionType `json:"questionType"`
+	// ResponseRate is the share of the surveys respondents who answered this question
+	ResponseRate Share                   `json:"responseRate"`
+	Segments     Breakdown               `json:"segments"`
+	Options      []OptionResult          `json:"options,omitempty"`
+	CoOccurrence []surveyrepo.OptionPair `json:"coOccurrence,omitempty"`
+}
+
+type TextAnswers struct {
+	Answers []surveyrepo.TextAnswer `json:"answers"`
+	Total   int                     `json:"total"`
+	Page    int                     `json:"page"`
+	Limit   int                     `json:"limit"`
+}
+
+type Results struct {
+	SurveyID    uuid.UUID        `json:"surveyId"`
+	Respondents surveyrepo.Tally `json:"respondents"`
+	Questions   []QuestionResult `json:"questions"`
+	TextAnswers TextAnswers      `json:"textAnswers"`
+}
+
+// Results aggregates the responses to a survey. Option percentages are of the respondents who answered
+// the question, question response rates are of everyone who answered any question and segment
+// breakdowns use the same bases restricted to the segment. textSpec pages the text answers.
+func (ss SurveyService) Results(ctx context.Context, id uuid.UUID, textSpec repos.QuerySpec) (*Results, error) {
+	survey, err := ss.surveys.GetWithQuestions(ctx, id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	respondents, err := ss.results.Respondents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	questions, err := ss.results.Questions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := ss.results.Options(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, err := ss.results.CoOccurrence(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	texts, total, err := ss.results.TextAnswers(ctx, id, textSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	answered := make(map[uuid.UUID]surveyrepo.Tally, len(questions))
+	for _, q := range questions {
+		answered[q.QuestionID] = q.Tally
+	}
+
+	picked := make(map[uuid.UUID]surveyrepo.Tally, len(options))
+	for _, o := range options {
+		picked[o.OptionID] = o.Tally
+	}
+
+	together := make(map[uuid.UUID][]surveyrepo.OptionPair)
+	for _, p := range pairs {
+		together[p.QuestionID] = append(together[p.QuestionID], p)
+	}
+
+	res := &Results{
+		SurveyID:    id,
+		Respondents: respondents,
+		Questions:   make([]QuestionResult, 0, len(survey.Questions)),
+		TextAnswers: TextAnswers{Answers: texts, Total: total, Page: textSpec.Page, Limit: textSpec.Limit},
+	}
+
+	for _, q := range survey.Questions {
+		base := answered[q.ID]
+		qr := QuestionResult{
+			QuestionID:   q.ID,
+			Prompt:       q.Prompt,
+			QuestionType: q.QuestionType,
+			ResponseRate: share(base.Total, respondents.Total),
+			Segments:     breakdown(base, respondents),
+			CoOccurrence: together[q.ID],
+		}
+
+		if q.QuestionType != domain.TEXT {
+			qr.Options = make([]OptionResult, 0, len(q.Options))
+			for _, o := range q.Options {
+				count := picked[o.ID]
+				qr.Options = append(qr.Options, OptionResult{
+					OptionID: o.ID,
+					Label:    o.Label,
+					Share:    share(count.Total, base.Total),
+					Segments: breakdown(count, base),
+				})
+			}
+		}
+
+		res.Questions = append(res.Questions, qr)
+	}
+
+	return res, nil
+}
+
+func breakdown(t, base surveyrepo.Tally) Breakdown {
+	return Breakdown{
+		WouldUse:       share(t.WouldUse, base.WouldUse),
+		WouldNotUse:    share(t.WouldNotUse, base.WouldNotUse),
+		WithCompany:    share(t.WithCompany, base.WithCompany),
+		WithoutCompany: share(t.WithoutCompany, base.WithoutCompany),
+		Referred:       share(t.Referred, base.Referred),
+		Organic:        share(t.Organic, base.Organic),
+	}
+}
+
+// share rounds to two decimals, an empty base is 0% rather than NaN
+func share(count, base int64) Share {
+	if base == 0 {
+		return Share{Count: count}
+	}
+	pct := float64(count) * 100 / float64(base)
+	return Share{Count: count, Percent: float64(int64(pct*100+0.5)) / 100}
+}
@@ -0,0 +1,485 @@
+package survey
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/zrp9/launchl/internal/database/store"
+	"github.com/zrp9/launchl/internal/domain"
+	"github.com/zrp9/launchl/internal/dto"
+	"github.com/zrp9/launchl/internal/repos"
+	"github.com/zrp9/launchl/internal/repos/surveyrepo"
+	"github.com/zrp9/launchl/internal/services/audit"
+)
+
+const defaultCampaign = "default"
+
+var (
+	ErrSurveyPublished  = errors.New("survey is published, create a draft to edit it")
+	ErrNotInSurvey      = errors.New("question does not belong to survey")
+	ErrNotInQuestion    = errors.New("option does not belong to question")
+	ErrSurveyIncomplete = errors.New("survey needs at least one active question and every choice question needs options")
+	ErrInvalidCondition = errors.New("question conditions must use options of an earlier active choice question")
+)
+
+type SurveyService struct {
+	tx        store.Transactor
+	surveys   surveyrepo.SurveyRepo
+	questions surveyrepo.QuestionRepo
+	options   surveyrepo.QuestionOptionRepo
+	results   surveyrepo.ResultsRepo
+	audit     audit.Recorder
+}
+
+func New(tx store.Transactor, s surveyrepo.SurveyRepo, q surveyrepo.QuestionRepo, o surveyrepo.QuestionOptionRepo, r surveyrepo.ResultsRepo, a audit.Recorder) SurveyService {
+	return SurveyService{
+		tx:        tx,
+		surveys:   s,
+		questions: q,
+		options:   o,
+		results:   r,
+		audit:     a,
+	}
+}
+
+func (ss SurveyService) List(ctx context.Context, spec repos.QuerySpec) ([]*domain.Survey, int, error) {
+	return ss.surveys.Find(ctx, spec)
+}
+
+func (ss SurveyService) Get(ctx context.Context, id uuid.UUID) (*domain.Survey, error) {
+	return ss.surveys.GetWithQuestions(ctx, id.String())
+}
+
+// Create starts a new draft survey at the next version of its campaign
+func (ss SurveyService) Create(ctx context.Context, d dto.SurveyDto) (*domain.Survey, error) {
+	campaign := d.Campaign
+	if campaign == "" {
+		campaign = defaultCampaign
+	}
+
+	var created *domain.Survey
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		version, err := ss.surveys.NextVersion(ctx, campaign)
+		if err != nil {
+			return err
+		}
+
+		created, err = ss.surveys.Create(ctx, &domain.Survey{
+			ID:       uuid.New(),
+			Name:     d.Name,
+			Campaign: campaign,
+			Version:  strconv.Itoa(version),
+			Status:   domain.DRAFT,
+		})
+		if err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyCreate, "survey", created.ID.String(), nil, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (ss SurveyService) AddQuestion(ctx context.Context, surveyID uuid.UUID, d dto.QuestionDto) (*domain.SurveyQuestion, error) {
+	var created *domain.SurveyQuestion
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := ss.draft(ctx, surveyID); err != nil {
+			return err
+		}
+
+		pos, err := ss.questions.NextPosition(ctx, surveyID)
+		if err != nil {
+			return err
+		}
+
+		question := domain.SurveyQuestion{
+			ID:           uuid.New(),
+			SurveyID:     surveyID,
+			QuestionType: domain.QuestionType(d.QuestionType),
+			Prompt:       d.Prompt,
+			Position:     pos,
+			Required:     boolOr(d.Required, true),
+			Active:       boolOr(d.Active, true),
+			MetaData:     d.MetaData,
+		}
+		if len(question.MetaData) == 0 {
+			question.MetaData = []byte("{}")
+		}
+
+		if created, err = ss.questions.Create(ctx, &question); err != nil {
+			return err
+		}
+
+		for i, o := range d.Options {
+			opt, err := ss.options.Create(ctx, &domain.SurveyQuestionOption{
+				ID:         uuid.New(),
+				QuestionID: created.ID,
+				Position:   i,
+				Label:      o.Label,
+				Value:      o.Value,
+			})
+			if err != nil {
+				return err
+			}
+			created.Options = append(created.Options, *opt)
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question", created.ID.String(), nil, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (ss SurveyService) UpdateQuestion(ctx context.Context, surveyID, questionID uuid.UUID, d dto.QuestionUpdate) (*domain.SurveyQuestion, error) {
+	var updated domain.SurveyQuestion
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := ss.draftQuestion(ctx, surveyID, questionID)
+		if err != nil {
+			return err
+		}
+
+		updated = *before
+		if d.Prompt != nil {
+			updated.Prompt = *d.Prompt
+		}
+		if d.QuestionType != nil {
+			updated.QuestionType = domain.QuestionType(*d.QuestionType)
+		}
+		if d.Required != nil {
+			updated.Required = *d.Required
+		}
+		if d.Active != nil {
+			updated.Active = *d.Active
+		}
+		if len(d.MetaData) > 0 {
+			updated.MetaData = d.MetaData
+		}
+
+		if err := ss.questions.Save(ctx, &updated); err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question", questionID.String(), before, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (ss SurveyService) DeleteQuestion(ctx context.Context, surveyID, questionID uuid.UUID) error {
+	return ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := ss.draftQuestion(ctx, surveyID, questionID)
+		if err != nil {
+			return err
+		}
+
+		if err := ss.questions.Delete(ctx, questionID.String()); err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question", questionID.String(), before, nil)
+	})
+}
+
+func (ss SurveyService) ReorderQuestions(ctx context.Context, surveyID uuid.UUID, ids []uuid.UUID) error {
+	return ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := ss.draft(ctx, surveyID); err != nil {
+			return err
+		}
+
+		if err := ss.questions.Reorder(ctx, surveyID, ids); err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey", surveyID.String(), nil, map[string]any{"questionOrder": ids})
+	})
+}
+
+func (ss SurveyService) AddOption(ctx context.Context, surveyID, questionID uuid.UUID, d dto.OptionDto) (*domain.SurveyQuestionOption, error) {
+	var created *domain.SurveyQuestionOption
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := ss.draftQuestion(ctx, surveyID, questionID); err != nil {
+			return err
+		}
+
+		pos, err := ss.options.NextPosition(ctx, questionID)
+		if err != nil {
+			return err
+		}
+
+		created, err = ss.options.Create(ctx, &domain.SurveyQuestionOption{
+			ID:         uuid.New(),
+			QuestionID: questionID,
+			Position:   pos,
+			Label:      d.Label,
+			Value:      d.Value,
+		})
+		if err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question_option", created.ID.String(), nil, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (ss SurveyService) UpdateOption(ctx context.Context, surveyID, questionID, optionID uuid.UUID, d dto.OptionUpdate) (*domain.SurveyQuestionOption, error) {
+	var updated domain.SurveyQuestionOption
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := ss.draftOption(ctx, surveyID, questionID, optionID)
+		if err != nil {
+			return err
+		}
+
+		updated = *before
+		if d.Label != nil {
+			updated.Label = *d.Label
+		}
+		if d.Value != nil {
+			updated.Value = *d.Value
+		}
+
+		if err := ss.options.Update(ctx, &updated); err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question_option", optionID.String(), before, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (ss SurveyService) DeleteOption(ctx context.Context, surveyID, questionID, optionID uuid.UUID) error {
+	return ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		before, err := ss.draftOption(ctx, surveyID, questionID, optionID)
+		if err != nil {
+			return err
+		}
+
+		if err := ss.options.Delete(ctx, optionID.String()); err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question_option", optionID.String(), before, nil)
+	})
+}
+
+func (ss SurveyService) ReorderOptions(ctx context.Context, surveyID, questionID uuid.UUID, ids []uuid.UUID) error {
+	return ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := ss.draftQuestion(ctx, surveyID, questionID); err != nil {
+			return err
+		}
+
+		if err := ss.options.Reorder(ctx, questionID, ids); err != nil {
+			return err
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyEdit, "survey_question", questionID.String(), nil, map[string]any{"optionOrder": ids})
+	})
+}
+
+// Publish freezes the draft and makes it the active survey of its campaign. Responses reference
+// the published questions from then on so further edits have to go through CreateDraft.
+func (ss SurveyService) Publish(ctx context.Context, surveyID uuid.UUID) (*domain.Survey, error) {
+	var published *domain.Survey
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		survey, err := ss.surveys.GetWithQuestions(ctx, surveyID.String())
+		if err != nil {
+			return err
+		}
+
+		if !survey.IsDraft() {
+			return ErrSurveyPublished
+		}
+
+		if !publishable(survey) {
+			return ErrSurveyIncomplete
+		}
+
+		if err := checkConditions(survey); err != nil {
+			return err
+		}
+
+		before := *survey
+		if err := ss.surveys.Publish(ctx, survey); err != nil {
+			return err
+		}
+		published = survey
+
+		return ss.audit.Record(ctx, domain.AuditSurveyPublish, "survey", surveyID.String(), before, survey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return published, nil
+}
+
+// CreateDraft copies a published survey with its questions and options into a new draft version.
+// If a draft of the survey is already open that draft is returned instead.
+func (ss SurveyService) CreateDraft(ctx context.Context, surveyID uuid.UUID) (*domain.Survey, error) {
+	var draft *domain.Survey
+	err := ss.tx.RunInTx(ctx, func(ctx context.Context) error {
+		src, err := ss.surveys.GetWithQuestions(ctx, surveyID.String())
+		if err != nil {
+			return err
+		}
+
+		if src.IsDraft() {
+			draft = src
+			return nil
+		}
+
+		existing, err := ss.surveys.GetDraftOf(ctx, surveyID.String())
+		if err == nil {
+			draft, err = ss.surveys.GetWithQuestions(ctx, existing.ID.String())
+			return err
+		}
+		if !errors.Is(err, repos.ErrNoRecords) {
+			return err
+		}
+
+		version, err := ss.surveys.NextVersion(ctx, src.Campaign)
+		if err != nil {
+			return err
+		}
+
+		draft, err = ss.surveys.Create(ctx, &domain.Survey{
+			ID:       uuid.New(),
+			Name:     src.Name,
+			Campaign: src.Campaign,
+			Version:  strconv.Itoa(version),
+			Status:   domain.DRAFT,
+			ParentID: src.ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		// ids are assigned up front so conditions on later questions can be pointed at the copies
+		ids := make(map[uuid.UUID]uuid.UUID)
+		for _, q := range src.Questions {
+			ids[q.ID] = uuid.New()
+			for _, o := range q.Options {
+				ids[o.ID] = uuid.New()
+			}
+		}
+
+		for _, q := range src.Questions {
+			clone := q
+			clone.ID = ids[q.ID]
+			clone.SurveyID = draft.ID
+			clone.Options = nil
+			if clone.MetaData, err = remapConditions(q.MetaData, ids); err != nil {
+				return err
+			}
+			if _, err := ss.questions.Create(ctx, &clone); err != nil {
+				return err
+			}
+
+			for _, o := range q.Options {
+				opt := o
+				opt.ID = ids[o.ID]
+				opt.QuestionID = clone.ID
+				if _, err := ss.options.Create(ctx, &opt); err != nil {
+					return err
+				}
+				clone.Options = append(clone.Options, opt)
+			}
+			draft.Questions = append(draft.Questions, clone)
+		}
+
+		return ss.audit.Record(ctx, domain.AuditSurveyCreate, "survey", draft.ID.String(), nil, draft)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return draft, nil
+}
+
+func (ss SurveyService) draft(ctx context.Context, surveyID uuid.UUID) (*domain.Survey, error) {
+	survey, err := ss.surveys.Get(ctx, surveyID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if !survey.IsDraft() {
+		return nil, ErrSurveyPublished
+	}
+
+	return survey, nil
+}
+
+func (ss SurveyService) draftQuestion(ctx context.Context, surveyID, questionID uuid.UUID) (*domain.SurveyQuestion, error) {
+	if _, err := ss.draft(ctx, surveyID); err != nil {
+		return nil, err
+	}
+
+	question, err := ss.questions.Get(ctx, questionID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if question.SurveyID != surveyID {
+		return nil, ErrNotInSurvey
+	}
+
+	return question, nil
+}
+
+func (ss SurveyService) draftOption(ctx context.Context, surveyID, questionID, optionID uuid.UUID) (*domain.SurveyQuestionOption, error) {
+	if _, err := ss.draftQuestion(ctx, surveyID, questionID); err != nil {
+		return nil, err
+	}
+
+	option, err := ss.options.Get(ctx, optionID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if option.QuestionID != questionID {
+		return nil, ErrNotInQuestion
+	}
+
+	return option, nil
+}
+
+func publishable(s *domain.Survey) bool {
+	active := 0
+	for _, q := range s.Questions {
+		if !q.Active {
+			continue
+		}
+		active++
+		if q.QuestionType != domain.TEXT && len(q.Options) == 0 {
+			return false
+		}
+	}
+	return active > 0
+}
+
+func boolOr(b *bool, fallback bool) bool {
+	if b == nil {
+		return fallback
+	}
+	return *b
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// Tasks tracks goroutines that outlive the request that started them, like queueing a welcome
+// email, so shutdown can wait for them instead of cutting them off
+type Tasks struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	closed bool
+}
+
+func NewTasks() *Tasks {
+	return &Tasks{}
+}
+
+// Go runs fn in the background, once Wait has been called fn runs before Go returns so nothing
+// is started that shutdown can't see. A nil Tasks runs fn untracked.
+func (t *Tasks) Go(fn func()) {
+	if t == nil {
+		go fn()
+		return
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		fn()
+		return
+	}
+	t.wg.Add(1)
+	t.mu.Unlock()
+
+	go func() {
+		defer t.wg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until every tracked goroutine is done or ctx is
+func (t *Tasks) Wait(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+package valkaree
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/valkey-io/valkey-go"
+	"github.com/zrp9/launchl/internal/config"
+	"github.com/zrp9/launchl/internal/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewClient connects to valkey with every command traced
+func NewClient(cfg config.ValkeyCfg) (valkey.Client, error) {
+	client, err := valkey.NewClient(valkey.ClientOption{
+		InitAddress: []string{fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tracedClient{Client: client}, nil
+}
+
+// tracedClient records a client span per command, only command names are recorded since
+// arguments hold emails and payloads
+type tracedClient struct {
+	valkey.Client
+}
+
+func (t tracedClient) Do(ctx context.Context, cmd valkey.Completed) valkey.ValkeyResult {
+	ctx, span := startSpan(ctx, cmd.Commands())
+	res := t.Client.Do(ctx, cmd)
+	endSpan(span, res.Error())
+	return res
+}
+
+func (t tracedClient) DoMulti(ctx context.Context, multi ...valkey.Completed) []valkey.ValkeyResult {
+	ctx, span := startSpan(ctx, pipelineNames(len(multi), func(i int) []string { return multi[i].Commands() }))
+	res := t.Client.DoMulti(ctx, multi...)
+	endSpan(span, firstErr(res))
+	return res
+}
+
+func (t tracedClient) DoCache(ctx context.Context, cmd valkey.Cacheable, ttl time.Duration) valkey.ValkeyResult {
+	ctx, span := startSpan(ctx, cmd.Commands())
+	res := t.Client.DoCache(ctx, cmd, ttl)
+	endSpan(span, res.Error())
+	return res
+}
+
+func (t tracedClient) DoMultiCache(ctx context.Context, multi ...valkey.CacheableTTL) []valkey.ValkeyResult {
+	ctx, span := startSpan(ctx, pipelineNames(len(multi), func(i int) []string { return multi[i].Cmd.Commands() }))
+	res := t.Client.DoMultiCache(ctx, multi...)
+	endSpan(span, firstErr(res))
+	return res
+}
+
+func startSpan(ctx context.Context, args []string) (context.Context, trace.Span) {
+	name := "valkey"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	return telemetry.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "valkey"),
+			attribute.String("db.operation.name", name),
+		),
+	)
+}
+
+func endSpan(span trace.Span, err error) {
+	// a nil reply is a miss not a failure
+	if err != nil && !valkey.IsValkeyNil(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func pipelineNames(n int, args func(int) []string) []string {
+	names := make([]string, 0, n)
+	for i := range n {
+		if a := args(i); len(a) > 0 {
+			names = append(names, a[0])
+		}
+	}
+	return []string{"pipeline " + strings.Join(names, " ")}
+}
+
+func firstErr(res []valkey.ValkeyResult) error {
+	for _, r := range res {
+		if err := r.Error(); err != nil && !valkey.IsValkeyNil(err) {
+			return err
+		}
+	}
+	return nil
+}
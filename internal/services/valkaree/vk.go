@@ -9,12 +9,15 @@ import (
 	"log"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/valkey-io/valkey-go"
 	"github.com/zrp9/launchl/internal/config"
 	"github.com/zrp9/launchl/internal/crane"
+	"github.com/zrp9/launchl/internal/request"
+	"github.com/zrp9/launchl/internal/telemetry"
 )
 
 type Cacher interface {
@@ -40,6 +43,10 @@ type Job struct {
 	Source     string          `json:"source"`
 	RetryLimit int64           `json:"retryLimit"`
 	Payload    json.RawMessage `json:"payload"`
+	// RequestID is the id of the request that queued the job so its work can be traced back to it
+	RequestID string `json:"requestId,omitempty"`
+	// TraceContext holds the w3c trace headers the job was written with
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 type JobResult struct {
@@ -59,6 +66,14 @@ type PendingInfo struct {
 	Group    string
 }
 
+// GroupInfo is a consumer groups row from XINFO GROUPS, Lag is -1 when valkey can't tell
+type GroupInfo struct {
+	Name      string
+	Consumers int64
+	Pending   int64
+	Lag       int64
+}
+
 type StreamEntry map[string]string
 
 type Stream struct {
@@ -132,13 +147,9 @@ type ValkeyService struct {
 }
 
 func NewValkeyService(ctx context.Context) (ValkeyService, error) {
-	confi := config.LoadValkey()
-	client, err := valkey.NewClient(valkey.ClientOption{
-		InitAddress: []string{fmt.Sprintf("%s:%s", confi.Host, confi.Port)},
-	})
-
+	client, err := NewClient(config.LoadValkey())
 	if err != nil {
-		return ValkeyService{}, nil
+		return ValkeyService{}, err
 	}
 
 	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
@@ -157,6 +168,11 @@ func NewValkeyService(ctx context.Context) (ValkeyService, error) {
 	}, nil
 }
 
+// Client is the traced client the service was connected with
+func (v ValkeyService) Client() valkey.Client {
+	return v.client
+}
+
 func (v ValkeyService) Set(ctx context.Context, key, value string) error {
 	return v.client.Do(ctx, v.client.B().Set().Key(key).Value(value).Build()).Error()
 }
@@ -174,6 +190,59 @@ func NewStream(client valkey.Client, key string, threshold int64, log crane.Zlog
 	}
 }
 
+// Ping checks the server the stream lives on answers
+func (s *Stream) Ping(ctx context.Context) error {
+	return s.client.Do(ctx, s.client.B().Ping().Build()).Error()
+}
+
+// Length is the number of entries in the stream, a missing stream is empty
+func (s *Stream) Length(ctx context.Context) (int64, error) {
+	return s.client.Do(ctx, s.client.B().Xlen().Key(s.Key).Build()).AsInt64()
+}
+
+// Groups lists the consumer groups reading the stream with their pending count and lag
+func (s *Stream) Groups(ctx context.Context) ([]GroupInfo, error) {
+	rows, err := s.client.Do(ctx, s.client.B().XinfoGroups().Key(s.Key).Build()).ToArray()
+	if err != nil {
+		if valkey.IsValkeyNil(err) || isNoSuchKey(err) {
+			return []GroupInfo{}, nil
+		}
+		return nil, err
+	}
+
+	groups := make([]GroupInfo, 0, len(rows))
+	for _, row := range rows {
+		fields, err := row.AsMap()
+		if err != nil {
+			return nil, err
+		}
+
+		g := GroupInfo{Lag: -1}
+		if v, ok := fields["name"]; ok {
+			g.Name, _ = v.ToString()
+		}
+		if v, ok := fields["consumers"]; ok {
+			g.Consumers, _ = v.AsInt64()
+		}
+		if v, ok := fields["pending"]; ok {
+			g.Pending, _ = v.AsInt64()
+		}
+		// lag is nil when entries were deleted past the groups last delivered id
+		if v, ok := fields["lag"]; ok && !v.IsNil() {
+			g.Lag, _ = v.AsInt64()
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+// isNoSuchKey reports the error XINFO gives for a stream that hasn't been created yet
+func isNoSuchKey(err error) bool {
+	var vErr *valkey.ValkeyError
+	return errors.As(err, &vErr) && strings.Contains(vErr.Error(), "no such key")
+}
+
 func (s *Stream) Writer() StreamWriter { return writer{s: s} }
 
 func (s *Stream) Reader(group, consumer string, block time.Duration, count int64) StreamReader {
@@ -245,7 +314,12 @@ func (w writer) Writer(ctx context.Context, fields StreamEntry) (string, error)
 	return w.s.client.Do(ctx, cmd.Build()).ToString()
 }
 
+// WriteJob adds a job to the stream, the request id and trace context on ctx go with it so the
+// consumer's work shows up in the same trace and logs as the request that queued it
 func (w writer) WriteJob(ctx context.Context, kind, target, src string, payload json.RawMessage) (string, error) {
+	requestID := request.RequestID(ctx)
+	carrier := make(map[string]string, 2)
+	telemetry.Inject(ctx, carrier)
 	cmd := w.s.client.B().Xadd().Key(w.s.Key).Maxlen().Almost().Threshold(w.s.Threshold()).Id("*").FieldValue().FieldValueIter(func(yield func(string, string) bool) {
 		if !yield("jid", uuid.NewString()) {
 			return
@@ -267,6 +341,16 @@ func (w writer) WriteJob(ctx context.Context, kind, target, src string, payload
 			return
 		}
 
+		if requestID != "" && !yield("requestId", requestID) {
+			return
+		}
+
+		for k, v := range carrier {
+			if !yield(k, v) {
+				return
+			}
+		}
+
 		if !yield("payload", valkey.BinaryString(payload)) {
 			return
 		}
@@ -283,8 +367,8 @@ func (w writer) WriteJSON(ctx context.Context, jsonField string, payload []byte)
 }
 
 func (r reader) ReadGroup(ctx context.Context, count int64) ([]Message, error) {
-	var c int64
-	if count == 0 {
+	c := count
+	if c == 0 {
 		c = r.Count
 	}
 
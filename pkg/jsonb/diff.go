@@ -0,0 +1,64 @@
+package jsonb
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Change is the before and after json value of a single top level field
+type Change struct {
+	From json.RawMessage `json:"from,omitempty"`
+	To   json.RawMessage `json:"to,omitempty"`
+}
+
+// Diff marshals before and after to json objects and returns the top level fields whose values differ.
+// A nil before or after is treated as an empty object so creates and deletes list every field.
+func Diff(before, after any) (map[string]Change, error) {
+	b, err := toFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := toFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for k, bv := range b {
+		av, ok := a[k]
+		if !ok || !bytes.Equal(bv, av) {
+			changes[k] = Change{From: bv, To: av}
+		}
+	}
+
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{To: av}
+		}
+	}
+
+	return changes, nil
+}
+
+func toFields(v any) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if v == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(data, []byte("null")) {
+		return fields, nil
+	}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
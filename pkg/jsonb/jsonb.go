@@ -20,7 +20,7 @@ func (j *JSONB[T]) Scan(src any) error {
 
 	switch v := src.(type) {
 	case []byte:
-		return json.Unmarshal(v, &j)
+		return json.Unmarshal(v, &j.V)
 	case string:
 		return json.Unmarshal([]byte(v), &j.V)
 	default:
@@ -59,3 +59,13 @@ func (n *NullJSONB[T]) Scan(src any) error {
 		return fmt.Errorf("unsupported type %T", src)
 	}
 }
+
+func (j JSONB[T]) MarshalJSON() ([]byte, error) { return json.Marshal(j.V) }
+
+func (n NullJSONB[T]) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+
+	return json.Marshal(n.V)
+}